@@ -0,0 +1,147 @@
+// Command primgo-disasm writes an annotated Z80 listing of a ROM image, or of a memory range of a
+// save state.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+
+	"primgo/primo"
+	"primgo/primo/disasm"
+)
+
+var ErrInvalidFlag = errors.New("invalid command line flag")
+
+// config holds the values of the command line flags.
+type config struct {
+	romType string
+	romFile string
+	state   string
+	start   string
+	end     string
+	symbols string
+	output  string
+}
+
+func parseFlags() config {
+	var c config
+	flag.StringVar(&c.romType, "rom", "a", "built-in ROM version to disassemble: a, b or c")
+	flag.StringVar(&c.romFile, "rom-file", "", "disassemble this 16K ROM image instead of a built-in one")
+	flag.StringVar(&c.state, "state", "", "disassemble the memory of this save state, with the ROM it was saved with")
+	flag.StringVar(&c.start, "start", "0x0000", "first address to disassemble")
+	flag.StringVar(&c.end, "end", "0x3FFF", "last address to disassemble")
+	flag.StringVar(&c.symbols, "symbols", "", "JSON file of additional symbols, like {\"loop\": \"0x4300\"}")
+	flag.StringVar(&c.output, "o", "", "write the listing to this file instead of the standard output")
+	flag.Parse()
+	return c
+}
+
+// loadMemory creates the memory to disassemble, along with the name of the model it belongs to.
+func loadMemory(c config) (*primo.Memory, string, error) {
+	rom := primo.BuiltInROM(primo.ROMType(c.romType))
+	if !rom.Type.Validate() {
+		return nil, "", fmt.Errorf("%w: unknown ROM version %q", ErrInvalidFlag, c.romType)
+	}
+	if c.romFile != "" {
+		data, err := os.ReadFile(c.romFile)
+		if err != nil {
+			return nil, "", fmt.Errorf("cannot read ROM image: %w", err)
+		}
+		if rom, err = primo.NewROM(data); err != nil {
+			return nil, "", fmt.Errorf("cannot load ROM image: %w", err)
+		}
+	}
+
+	if c.state == "" {
+		mem := primo.NewMemory(rom, primo.RAMSize48K)
+		return mem, primo.ModelName(rom.Type, primo.RAMSize48K), nil
+	}
+
+	data, err := os.ReadFile(c.state)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot read save state: %w", err)
+	}
+	snapshot, err := primo.DecodeSnapshot(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot load save state: %w", err)
+	}
+	if !snapshot.MatchesROM(rom) {
+		rom = primo.BuiltInROM(snapshot.ROMType)
+	}
+	mem := primo.NewMemory(rom, snapshot.RAMSize)
+	if err = snapshot.Restore(mem, primo.NewTapePlayer(), primo.NewTapeSignal(), primo.NewTapeRecorder(), primo.NewKeyQueue()); err != nil {
+		return nil, "", fmt.Errorf("cannot restore save state: %w", err)
+	}
+	return mem, primo.ModelName(snapshot.ROMType, snapshot.RAMSize), nil
+}
+
+// loadSymbols returns the labels of the ROM, and the symbols of the file given by -symbols.
+func loadSymbols(c config, rom *primo.ROM) (disasm.Symbols, error) {
+	symbols := disasm.ROMSymbols(rom)
+	if c.symbols == "" {
+		return symbols, nil
+	}
+
+	data, err := os.ReadFile(c.symbols)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read symbols: %w", err)
+	}
+	user, err := disasm.ParseSymbols(data)
+	if err != nil {
+		return nil, err
+	}
+	symbols.Add(user)
+	return symbols, nil
+}
+
+func parseAddress(text string) (uint16, error) {
+	address, err := strconv.ParseUint(text, 0, 16)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid address %q", ErrInvalidFlag, text)
+	}
+	return uint16(address), nil
+}
+
+func run(c config) error {
+	start, err := parseAddress(c.start)
+	if err != nil {
+		return err
+	}
+	end, err := parseAddress(c.end)
+	if err != nil {
+		return err
+	}
+
+	mem, model, err := loadMemory(c)
+	if err != nil {
+		return err
+	}
+	symbols, err := loadSymbols(c, mem.ROM())
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if c.output != "" {
+		file, err := os.Create(c.output)
+		if err != nil {
+			return fmt.Errorf("cannot create listing: %w", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	fmt.Fprintf(out, "; %s $%04X-$%04X\n", model, start, end)
+	return disasm.WriteListing(out, mem, start, end, symbols)
+}
+
+func main() {
+	if err := run(parseFlags()); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// condition tells whether the run should stop, it's checked after every instruction.
+type condition func(r *runner) bool
+
+// parseCondition parses the condition given by the -until flag:
+//   - pc=ADDR: the CPU is about to execute the instruction at the address
+//   - mem:ADDR=VALUE: the byte at the address has the value
+//   - loaded: loading a program from the tape has finished
+//   - typed: every text given to type has been typed
+//
+// Addresses and values can be decimal, or hexadecimal with the 0x prefix.
+func parseCondition(text string) (condition, error) {
+	name, arg, _ := strings.Cut(text, "=")
+	switch {
+	case text == "":
+		return func(*runner) bool { return false }, nil
+	case text == "loaded":
+		return func(r *runner) bool { return r.loaded }, nil
+	case text == "typed":
+		return func(r *runner) bool { return len(r.script) == 0 && !r.machine.Typing() }, nil
+	case name == "pc":
+		address, err := parseNumber(arg, 16)
+		if err != nil {
+			return nil, err
+		}
+		return func(r *runner) bool { return r.machine.CPU().PC == uint16(address) }, nil
+	case strings.HasPrefix(name, "mem:"):
+		return memoryCondition(strings.TrimPrefix(name, "mem:"), arg)
+	}
+	return nil, fmt.Errorf("%w: unknown condition %q", ErrInvalidFlag, text)
+}
+
+func memoryCondition(addressText, valueText string) (condition, error) {
+	address, err := parseNumber(addressText, 16)
+	if err != nil {
+		return nil, err
+	}
+	value, err := parseNumber(valueText, 8)
+	if err != nil {
+		return nil, err
+	}
+	return func(r *runner) bool { return r.machine.Memory().Get(uint16(address)) == uint8(value) }, nil
+}
+
+func parseNumber(text string, bitSize int) (uint64, error) {
+	n, err := strconv.ParseUint(text, 0, bitSize)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid number %q", ErrInvalidFlag, text)
+	}
+	return n, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"primgo/primo/disasm"
+	"primgo/primo/gdbserver"
+	"primgo/primo/machine"
+)
+
+// startDebugging starts the GDB server, the trace and the profiler, as given on the command line.
+func (r *runner) startDebugging() error {
+	if err := r.startGDBServer(); err != nil {
+		return err
+	}
+	if r.config.profile != "" || r.config.hotspots != "" {
+		r.machine.Profiler().Start()
+	}
+	return r.startTrace()
+}
+
+// startGDBServer accepts GDB clients on the port given on the command line. The machine is stopped
+// at power-on until a client connects and resumes it, so the run can be debugged from the start.
+func (r *runner) startGDBServer() error {
+	if r.config.gdb == 0 {
+		return nil
+	}
+
+	var err error
+	if r.gdb, err = gdbserver.Listen(r.machine, r.config.gdb); err != nil {
+		return err
+	}
+	r.machine.Debugger().Break()
+	return nil
+}
+
+// waitForDebugger serves the GDB client, and reports whether the machine is stopped by the
+// debugger. The frames don't advance while it's stopped, so the run only ends after it's resumed.
+func (r *runner) waitForDebugger() bool {
+	if r.gdb == nil {
+		return false
+	}
+
+	r.gdb.Update()
+	if _, stopped := r.machine.Debugger().Stopped(); stopped {
+		time.Sleep(time.Millisecond)
+		return true
+	}
+	return false
+}
+
+// startTrace streams the trace of the executed instructions into the file given on the command
+// line.
+func (r *runner) startTrace() error {
+	if r.config.trace == "" {
+		return nil
+	}
+
+	options, err := traceOptions(r.config)
+	if err != nil {
+		return err
+	}
+	if r.traceFile, err = os.Create(r.config.trace); err != nil {
+		return fmt.Errorf("cannot create trace: %w", err)
+	}
+	r.machine.Tracer().Start(r.traceFile, options)
+	return nil
+}
+
+func traceOptions(c config) (machine.TraceOptions, error) {
+	var options machine.TraceOptions
+	if c.traceRange != "" {
+		traceRange, err := machine.ParseTraceRange(c.traceRange)
+		if err != nil {
+			return options, fmt.Errorf("%w: %w", ErrInvalidFlag, err)
+		}
+		options.Range = &traceRange
+	}
+
+	if err := parseTraceAddress(c.traceStart, &options.StartAt); err != nil {
+		return options, err
+	}
+	return options, parseTraceAddress(c.traceStop, &options.StopAt)
+}
+
+// parseTraceAddress sets the address of a trigger, if it was given.
+func parseTraceAddress(text string, trigger **uint16) error {
+	if text == "" {
+		return nil
+	}
+	address, err := parseNumber(text, 16)
+	if err != nil {
+		return err
+	}
+	a := uint16(address)
+	*trigger = &a
+	return nil
+}
+
+func (r *runner) stopTrace() error {
+	if r.traceFile == nil {
+		return nil
+	}
+
+	err := r.machine.Tracer().Stop()
+	if closeErr := r.traceFile.Close(); closeErr != nil && err == nil {
+		err = fmt.Errorf("cannot write trace: %w", closeErr)
+	}
+	return err
+}
+
+// saveProfile writes the profile collected during the run into the files given on the command line.
+func (r *runner) saveProfile() error {
+	p := r.machine.Profiler().Stop()
+	if p == nil {
+		return nil
+	}
+
+	symbols := disasm.ROMSymbols(r.machine.Memory().ROM())
+	if r.config.profile != "" {
+		err := writeFile(r.config.profile, func(w io.Writer) error {
+			return p.WriteCallgrind(w, symbols)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if r.config.hotspots != "" {
+		return writeFile(r.config.hotspots, func(w io.Writer) error {
+			return p.WriteReport(w, r.machine.Memory(), symbols)
+		})
+	}
+	return nil
+}
+
+// writeFile creates a file, and writes its contents with the function.
+func writeFile(name string, write func(w io.Writer) error) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("cannot create profile: %w", err)
+	}
+	defer file.Close()
+
+	if err = write(file); err != nil {
+		return err
+	}
+	return file.Close()
+}
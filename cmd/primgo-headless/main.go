@@ -0,0 +1,161 @@
+// Command primgo-headless runs the emulator without a window or an audio device, for testing PRIMO
+// programs in scripts and pipelines. It boots a ROM, inserts a tape, types the given keystrokes,
+// and runs for a number of frames or until a condition holds, then writes screenshots and a JSON
+// report of the final state of the machine.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"primgo/primo"
+	"primgo/primo/machine"
+)
+
+const (
+	// exit status when the condition given by -until didn't hold within the frames
+	exitConditionNotMet = 2
+	// exit status when a movie played with -play-movie diverged from the recording
+	exitMovieDiverged = 3
+)
+
+var ErrInvalidFlag = errors.New("invalid command line flag")
+
+// config holds the values of the command line flags.
+type config struct {
+	romType     string
+	ramSize     int
+	romFile     string
+	clock       string
+	tape        string
+	signal      bool
+	frames      int
+	until       string
+	typeText    string
+	script      string
+	load        bool
+	run         bool
+	screenshot  string
+	every       int
+	report      string
+	recordAudio string
+	recordMovie string
+	recordFrom  int
+	playMovie   string
+	gdb         int
+	trace       string
+	traceRange  string
+	traceStart  string
+	traceStop   string
+	profile     string
+	hotspots    string
+}
+
+func parseFlags() config {
+	var c config
+	flag.StringVar(&c.romType, "rom", "a", "ROM version to use: a, b or c")
+	flag.IntVar(&c.ramSize, "ram", 48, "RAM size in kilobytes: 16, 32 or 48")
+	flag.StringVar(&c.romFile, "rom-file", "", "custom 16K ROM image to use instead of the built-in one")
+	flag.StringVar(&c.clock, "clock", "normal", "CPU frequency: normal, spectrum or turbo")
+	flag.StringVar(&c.tape, "tape", "", "PTP, WAV or PRI file, or the name of a built-in tape to insert")
+	flag.BoolVar(&c.signal, "signal", false, "load PTP files by following the tape signal")
+	flag.IntVar(&c.frames, "frames", 3000, "maximum number of frames to run")
+	flag.StringVar(&c.until, "until", "",
+		"stop as soon as this condition holds: pc=ADDR, mem:ADDR=VALUE, loaded or typed")
+	flag.StringVar(&c.typeText, "type", "", `text to type after booting, \n types Return`)
+	flag.StringVar(&c.script, "script", "", "file with lines of a frame number and the text to type at that frame")
+	flag.BoolVar(&c.load, "load", false, "type LOAD after booting")
+	flag.BoolVar(&c.run, "run", false, "type RUN after booting, or after loading finished with -load")
+	flag.StringVar(&c.screenshot, "screenshot", "", "save the last frame to this PNG file")
+	flag.IntVar(&c.every, "screenshot-every", 0,
+		"also save a screenshot every this many frames, numbered by the frame")
+	flag.StringVar(&c.report, "report", "", "write the JSON report to this file instead of the standard output")
+	flag.StringVar(&c.recordAudio, "record-audio", "", "record the audio to this WAV file")
+	flag.StringVar(&c.recordMovie, "record-movie", "", "record the inputs from power-on to this movie file")
+	flag.IntVar(&c.recordFrom, "record-from", 0,
+		"start recording the movie from the state at this frame instead of from power-on")
+	flag.StringVar(&c.playMovie, "play-movie", "", "replay this movie file until it ends, checking for divergence")
+	flag.IntVar(&c.gdb, "gdb", 0,
+		"wait for a GDB remote protocol debugger to connect on this localhost port, and run while it's attached")
+	flag.StringVar(&c.trace, "trace", "", "write a trace of the executed instructions to this file")
+	flag.StringVar(&c.traceRange, "trace-range", "", "only trace the instructions in this range: FIRST-LAST, rom or ram")
+	flag.StringVar(&c.traceStart, "trace-start", "", "start tracing when the instruction at this address is reached")
+	flag.StringVar(&c.traceStop, "trace-stop", "", "stop tracing when the instruction at this address is reached")
+	flag.StringVar(&c.profile, "profile", "", "write a profile of the executed cycles to this callgrind file")
+	flag.StringVar(&c.hotspots, "hotspots", "", "write the hotspots and the cycles of the ROM routines to this text file")
+	flag.Parse()
+	return c
+}
+
+// newMachine creates the machine of the model given by the flags.
+func newMachine(c config) (*machine.Machine, error) {
+	romType := primo.ROMType(c.romType)
+	if !romType.Validate() {
+		return nil, fmt.Errorf("%w: unknown ROM version %q", ErrInvalidFlag, c.romType)
+	}
+	ramSize := primo.RAMSize(c.ramSize)
+	if !ramSize.Validate() {
+		return nil, fmt.Errorf("%w: unsupported RAM size %d", ErrInvalidFlag, c.ramSize)
+	}
+	clockSpeed, ok := clockSpeeds()[c.clock]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown CPU frequency %q", ErrInvalidFlag, c.clock)
+	}
+
+	rom := primo.BuiltInROM(romType)
+	if c.romFile != "" {
+		data, err := os.ReadFile(c.romFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read ROM image: %w", err)
+		}
+		if rom, err = primo.NewROM(data); err != nil {
+			return nil, fmt.Errorf("cannot load ROM image: %w", err)
+		}
+	}
+
+	m := machine.New(rom, ramSize)
+	m.ClockSpeed = clockSpeed
+	m.FastTape = !c.signal
+	return m, nil
+}
+
+func clockSpeeds() map[string]machine.ClockSpeed {
+	return map[string]machine.ClockSpeed{
+		"normal":   machine.ClockSpeedNormal,
+		"spectrum": machine.ClockSpeedSpectrum,
+		"turbo":    machine.ClockSpeedTurbo,
+	}
+}
+
+// unescape turns the \n sequences of the text given on the command line into line breaks.
+func unescape(text string) string {
+	return strings.NewReplacer(`\n`, "\n", `\\`, `\`).Replace(text)
+}
+
+func main() {
+	c := parseFlags()
+
+	r, err := newRunner(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	met, err := r.run()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = r.finish(met); err != nil {
+		log.Fatal(err)
+	}
+
+	if c.until != "" && !met {
+		os.Exit(exitConditionNotMet)
+	}
+	if r.machine.MoviePlayback().Divergences > 0 {
+		os.Exit(exitMovieDiverged)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"primgo/primo"
+)
+
+// report is the summary of a headless run written as JSON.
+type report struct {
+	Model        string       `json:"model"`
+	Frames       int          `json:"frames"`
+	Cycles       int          `json:"cycles"`
+	ConditionMet bool         `json:"condition_met"`
+	Registers    registers    `json:"registers"`
+	Tape         tapeReport   `json:"tape"`
+	Screenshots  []string     `json:"screenshots"`
+	Audio        string       `json:"audio,omitempty"`
+	Movie        *movieReport `json:"movie,omitempty"`
+}
+
+// movieReport tells how the playback of a movie went, FirstDivergence being -1 if every frame
+// ended in the same state as in the recording.
+type movieReport struct {
+	Frame           int `json:"frame"`
+	Frames          int `json:"frames"`
+	Divergences     int `json:"divergences"`
+	FirstDivergence int `json:"first_divergence"`
+}
+
+type registers struct {
+	PC uint16 `json:"pc"`
+	SP uint16 `json:"sp"`
+	AF uint16 `json:"af"`
+	BC uint16 `json:"bc"`
+	DE uint16 `json:"de"`
+	HL uint16 `json:"hl"`
+	IX uint16 `json:"ix"`
+	IY uint16 `json:"iy"`
+}
+
+// tapeReport tells how far the tape was read, in bytes of the PTP file by fast loading, and in
+// milliseconds of the signal by real signal loading.
+type tapeReport struct {
+	Byte       int   `json:"byte"`
+	Length     int   `json:"length"`
+	PlayedMS   int64 `json:"played_ms"`
+	DurationMS int64 `json:"duration_ms"`
+}
+
+func (r *runner) report(conditionMet bool) report {
+	cpu := r.machine.CPU()
+	tape := r.machine.TapePosition()
+	return report{
+		Model:        primo.ModelName(r.machine.ROMType(), r.machine.RAMSize()),
+		Frames:       r.frame,
+		Cycles:       r.cycles,
+		ConditionMet: conditionMet,
+		Registers: registers{
+			PC: cpu.PC, SP: cpu.SP, AF: cpu.AF.U16(), BC: cpu.BC.U16(),
+			DE: cpu.DE.U16(), HL: cpu.HL.U16(), IX: cpu.IX, IY: cpu.IY,
+		},
+		Tape: tapeReport{
+			Byte:       tape.Byte,
+			Length:     tape.Length,
+			PlayedMS:   tape.Played.Milliseconds(),
+			DurationMS: tape.Duration.Milliseconds(),
+		},
+		Screenshots: r.screenshots,
+		Audio:       r.config.recordAudio,
+		Movie:       r.movieReport(),
+	}
+}
+
+func (r *runner) movieReport() *movieReport {
+	if r.config.playMovie == "" {
+		return nil
+	}
+
+	playback := r.machine.MoviePlayback()
+	return &movieReport{
+		Frame:           playback.Frame,
+		Frames:          playback.Frames,
+		Divergences:     playback.Divergences,
+		FirstDivergence: playback.FirstDivergence,
+	}
+}
+
+// writeReport writes the report to the file given by the -report flag, or to the standard output.
+func (r *runner) writeReport(conditionMet bool) error {
+	data, err := json.MarshalIndent(r.report(conditionMet), "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot encode report: %w", err)
+	}
+	data = append(data, '\n')
+
+	if r.config.report == "" {
+		_, err = os.Stdout.Write(data)
+	} else {
+		err = os.WriteFile(r.config.report, data, 0600)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot write report: %w", err)
+	}
+	return nil
+}
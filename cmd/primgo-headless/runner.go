@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"primgo/primo"
+	"primgo/primo/gdbserver"
+	"primgo/primo/machine"
+	"primgo/primo/tapes"
+)
+
+const sampleRate = 44100
+
+// runner drives the machine through the frames of a headless run.
+type runner struct {
+	config    config
+	machine   *machine.Machine
+	recorder  *primo.AudioRecorder
+	script    []scriptLine
+	condition condition
+	gdb       *gdbserver.Server
+	traceFile *os.File
+
+	frame        int
+	cycles       int
+	screenshots  []string
+	runAfterLoad bool
+	loadStarted  bool
+	loaded       bool
+}
+
+func newRunner(c config) (*runner, error) {
+	m, err := newMachine(c)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &runner{config: c, machine: m}
+	if r.condition, err = parseCondition(c.until); err != nil {
+		return nil, err
+	}
+	if c.script != "" {
+		if r.script, err = readScript(c.script); err != nil {
+			return nil, err
+		}
+	}
+	if err = r.startMovie(); err != nil {
+		return nil, err
+	}
+	if c.tape != "" {
+		if err = r.insertTape(c.tape); err != nil {
+			return nil, err
+		}
+	}
+	if err = r.startDebugging(); err != nil {
+		return nil, err
+	}
+	if c.recordAudio != "" {
+		m.SampleRate = sampleRate
+		r.recorder = primo.NewAudioRecorder(sampleRate)
+	}
+
+	r.typeText(unescape(c.typeText))
+	if c.load {
+		r.typeText("LOAD\n")
+		r.runAfterLoad = c.run
+	} else if c.run {
+		r.typeText("RUN\n")
+	}
+	return r, nil
+}
+
+// startMovie starts recording a movie from power-on, or restores the starting state of the movie to
+// play, as given on the command line. Movies recorded from a later frame are started by run.
+func (r *runner) startMovie() error {
+	if r.config.recordMovie != "" && (r.config.recordFrom < 0 || r.config.recordFrom >= r.config.frames) {
+		return fmt.Errorf("%w: -record-from %d is not within the %d frames of the run", ErrInvalidFlag,
+			r.config.recordFrom, r.config.frames)
+	}
+	if r.config.recordMovie != "" && r.config.recordFrom == 0 {
+		r.machine.RecordMovie(true)
+	}
+	if r.config.playMovie == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(r.config.playMovie)
+	if err != nil {
+		return fmt.Errorf("cannot read movie: %w", err)
+	}
+	movie, err := primo.DecodeMovie(data)
+	if err != nil {
+		return fmt.Errorf("cannot load movie: %w", err)
+	}
+	return r.machine.PlayMovie(movie)
+}
+
+// insertTape inserts a tape file, or loads it into the memory if it's a PRI file.
+func (r *runner) insertTape(name string) error {
+	name, data, err := tapes.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".pri":
+		pri, err := primo.ParsePRI(data)
+		if err != nil {
+			return fmt.Errorf("cannot load PRI file: %w", err)
+		}
+		r.machine.LoadPRI(pri)
+	case ".wav":
+		pulses, err := primo.DecodeWAV(data)
+		if err != nil {
+			return fmt.Errorf("cannot load WAV file: %w", err)
+		}
+		r.machine.ChangeTapeSignal(pulses)
+		r.machine.FastTape = false
+	default:
+		r.machine.ChangeTape(data)
+	}
+	return nil
+}
+
+// typeText queues the keystrokes typing the text, warning about the characters without a key.
+func (r *runner) typeText(text string) {
+	strokes, skipped := primo.TextKeystrokes(text, r.machine.ROMType())
+	if len(skipped) > 0 {
+		log.Printf("Characters without a key were not typed: %q\n", string(skipped))
+	}
+	r.machine.TypeKeys(strokes)
+}
+
+// run emulates the frames until the condition holds or the frames run out, and returns whether
+// the condition was met. A movie being played is always played until its end.
+func (r *runner) run() (bool, error) {
+	for r.frame < r.config.frames || r.machine.MoviePlayback().Playing {
+		if r.waitForDebugger() {
+			continue
+		}
+		r.typeScriptedText()
+		if r.config.recordMovie != "" && r.config.recordFrom > 0 && r.frame == r.config.recordFrom {
+			r.machine.RecordMovie(false)
+		}
+
+		cycles, met := r.machine.RunFrameUntil(func() bool {
+			return r.condition(r)
+		})
+		r.cycles += cycles
+		r.frame++
+
+		r.updateLoading()
+		if r.recorder != nil {
+			r.recorder.AddSamples(r.machine.AudioSamples())
+		}
+		if r.config.every > 0 && r.frame%r.config.every == 0 {
+			if err := r.saveScreenshot(numberedName(r.config.screenshot, r.frame)); err != nil {
+				return false, err
+			}
+		}
+		if met {
+			return true, nil
+		}
+		if r.config.playMovie != "" && !r.machine.MoviePlayback().Playing {
+			break
+		}
+	}
+	return false, nil
+}
+
+// typeScriptedText queues the text of the script lines due in the current frame.
+func (r *runner) typeScriptedText() {
+	for len(r.script) > 0 && r.script[0].frame <= r.frame {
+		r.typeText(r.script[0].text)
+		r.script = r.script[1:]
+	}
+}
+
+// updateLoading notices when the tape has finished loading, and types RUN if it was asked for.
+func (r *runner) updateLoading() {
+	if r.machine.Typing() {
+		return
+	}
+
+	r.loadStarted = r.loadStarted || r.machine.TapeLoading()
+	if r.loadStarted && !r.machine.TapeLoading() {
+		r.loaded = true
+		if r.runAfterLoad {
+			r.typeText("RUN\n")
+			r.runAfterLoad = false
+		}
+	}
+}
+
+// saveScreenshot writes the last frame into a PNG file.
+func (r *runner) saveScreenshot(name string) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("cannot create screenshot: %w", err)
+	}
+	defer file.Close()
+
+	if err = png.Encode(file, r.machine.Screen()); err != nil {
+		return fmt.Errorf("cannot encode screenshot: %w", err)
+	}
+	r.screenshots = append(r.screenshots, name)
+	return nil
+}
+
+// numberedName inserts the frame number before the extension of the screenshot's file name.
+func numberedName(name string, frame int) string {
+	if name == "" {
+		name = "screenshot.png"
+	}
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s-%06d%s", strings.TrimSuffix(name, ext), frame, ext)
+}
+
+// finish saves the last screenshot, the audio recording, the profile and the report, and closes the
+// trace.
+func (r *runner) finish(conditionMet bool) error {
+	if err := r.stopTrace(); err != nil {
+		return err
+	}
+	if err := r.saveProfile(); err != nil {
+		return err
+	}
+
+	if r.config.screenshot != "" {
+		if err := r.saveScreenshot(r.config.screenshot); err != nil {
+			return err
+		}
+	}
+
+	if r.recorder != nil {
+		if err := os.WriteFile(r.config.recordAudio, r.recorder.WAV(), 0600); err != nil {
+			return fmt.Errorf("cannot save audio recording: %w", err)
+		}
+	}
+
+	if movie := r.machine.StopMovieRecording(); movie != nil {
+		if err := os.WriteFile(r.config.recordMovie, movie.Encode(), 0600); err != nil {
+			return fmt.Errorf("cannot save movie: %w", err)
+		}
+	}
+
+	return r.writeReport(conditionMet)
+}
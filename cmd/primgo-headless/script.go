@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidScript = errors.New("invalid script")
+
+// scriptLine is a text to type, starting at the given frame.
+type scriptLine struct {
+	frame int
+	text  string
+}
+
+// readScript reads the keystroke script, where every line is a frame number and the text to type
+// at that frame separated by a space, like "100 RUN\n". Empty lines and lines starting with # are
+// skipped.
+func readScript(name string) ([]scriptLine, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read script: %w", err)
+	}
+	defer file.Close()
+
+	var script []scriptLine
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		frame, text, _ := strings.Cut(line, " ")
+		number, err := strconv.Atoi(frame)
+		if err != nil || number < 0 {
+			return nil, fmt.Errorf("%w: invalid frame number in line %d", ErrInvalidScript, n)
+		}
+		script = append(script, scriptLine{frame: number, text: unescape(text)})
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read script: %w", err)
+	}
+
+	sort.SliceStable(script, func(i, j int) bool { return script[i].frame < script[j].frame })
+	return script, nil
+}
@@ -0,0 +1,99 @@
+// Command primgo-list writes the BASIC programs of a PTP tape, or the BASIC program in the memory
+// of a save state, as plain text.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"primgo/primo"
+	"primgo/primo/basic"
+)
+
+var ErrInvalidFlag = errors.New("invalid command line flag")
+
+// config holds the values of the command line flags.
+type config struct {
+	romType string
+	tape    string
+	state   string
+	output  string
+}
+
+func parseFlags() config {
+	var c config
+	flag.StringVar(&c.romType, "rom", "a", "ROM version the tape was saved with: a, b or c")
+	flag.StringVar(&c.tape, "tape", "", "list the BASIC programs of this PTP file")
+	flag.StringVar(&c.state, "state", "", "list the BASIC program in the memory of this save state")
+	flag.StringVar(&c.output, "o", "", "write the listing to this file instead of the standard output")
+	flag.Parse()
+	return c
+}
+
+func listTape(c config) (string, error) {
+	romType := primo.ROMType(c.romType)
+	if !romType.Validate() {
+		return "", fmt.Errorf("%w: unknown ROM version %q", ErrInvalidFlag, c.romType)
+	}
+
+	data, err := os.ReadFile(c.tape)
+	if err != nil {
+		return "", fmt.Errorf("cannot read tape: %w", err)
+	}
+	return basic.ListTape(data, romType)
+}
+
+func listState(c config) (string, error) {
+	data, err := os.ReadFile(c.state)
+	if err != nil {
+		return "", fmt.Errorf("cannot read save state: %w", err)
+	}
+	snapshot, err := primo.DecodeSnapshot(data)
+	if err != nil {
+		return "", fmt.Errorf("cannot load save state: %w", err)
+	}
+	mem := primo.NewMemory(primo.BuiltInROM(snapshot.ROMType), snapshot.RAMSize)
+	if err = snapshot.Restore(mem, primo.NewTapePlayer(), primo.NewTapeSignal(), primo.NewTapeRecorder(), primo.NewKeyQueue()); err != nil {
+		return "", fmt.Errorf("cannot restore save state: %w", err)
+	}
+
+	listing, err := basic.ListMemory(mem)
+	if err != nil {
+		return "", err
+	}
+	return listing.String(), nil
+}
+
+func run(c config) error {
+	var listing string
+	var err error
+	switch {
+	case c.tape != "" && c.state == "":
+		listing, err = listTape(c)
+	case c.state != "" && c.tape == "":
+		listing, err = listState(c)
+	default:
+		return fmt.Errorf("%w: either -tape or -state has to be given", ErrInvalidFlag)
+	}
+	if err != nil {
+		return err
+	}
+
+	if c.output == "" {
+		_, err = fmt.Print(listing)
+		return err
+	}
+	if err = os.WriteFile(c.output, []byte(listing), 0600); err != nil {
+		return fmt.Errorf("cannot write listing: %w", err)
+	}
+	return nil
+}
+
+func main() {
+	if err := run(parseFlags()); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+)
+
+// startConsole reads the lines typed on the terminal in the background, they are executed as
+// debugger commands between two ticks.
+func startConsole() chan string {
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	fmt.Println("Debugger console started, type help for the list of commands")
+	return lines
+}
+
+// stoppedByDebugger reports whether the debugger has stopped the machine, at a breakpoint or
+// between two steps.
+func (e *Emulator) stoppedByDebugger() bool {
+	_, stopped := e.machine.Debugger().Stopped()
+	return stopped
+}
+
+// updateDebugger reports on the terminal when the machine is stopped, and executes the command
+// typed on it, if there is one.
+func (e *Emulator) updateDebugger() {
+	if e.stoppedByDebugger() && !e.debuggerStopped && e.console != nil {
+		fmt.Println(e.monitor.Status())
+	}
+
+	select {
+	case line, ok := <-e.console:
+		if !ok {
+			e.console = nil
+			break
+		}
+		out, err := e.monitor.Execute(line)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+		} else if out != "" {
+			fmt.Println(out)
+		}
+	default:
+	}
+
+	// checked after the command, so stopping again after a step is reported too
+	e.debuggerStopped = e.stoppedByDebugger()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"primgo/primo"
+	"primgo/ui"
+)
+
+var ErrInvalidFlag = errors.New("invalid command line flag")
+
+// commandLine holds the values of the command line flags. The ones overriding the settings are
+// only applied for the session.
+type commandLine struct {
+	options     ui.Options
+	tape        string
+	load        bool
+	run         bool
+	fullscreen  bool
+	recordAudio string
+	recordMovie string
+	playMovie   string
+	debug       bool
+	gdb         int
+	trace       string
+	traceRange  string
+	traceStart  string
+	traceStop   string
+}
+
+func clockSpeeds() map[string]ui.ClockSpeed {
+	return map[string]ui.ClockSpeed{
+		"normal":   ui.ClockSpeedNormal,
+		"spectrum": ui.ClockSpeedSpectrum,
+		"turbo":    ui.ClockSpeedTurbo,
+	}
+}
+
+// overrideFlags holds the raw values of the flags overriding the settings, which are only used if
+// the flag was given.
+type overrideFlags struct {
+	romType    string
+	ramSize    int
+	clock      string
+	wholeScale bool
+	mute       bool
+}
+
+func parseCommandLine() (commandLine, error) {
+	var cl commandLine
+	var of overrideFlags
+	flag.StringVar(&of.romType, "rom", "", "ROM version to use: a, b or c")
+	flag.IntVar(&of.ramSize, "ram", 0, "RAM size in kilobytes: 16, 32 or 48")
+	flag.StringVar(&of.clock, "clock", "", "CPU frequency: normal, spectrum or turbo")
+	flag.BoolVar(&of.wholeScale, "whole-scale", false, "only upscale the screen by whole numbers")
+	flag.BoolVar(&of.mute, "mute", false, "start with the sound muted")
+	flag.StringVar(&cl.options.SettingsFile, "settings", "", "use this settings file instead of the default one")
+	flag.StringVar(&cl.tape, "tape", "", "PTP, WAV or PRI file, or the name of a built-in tape to insert")
+	flag.BoolVar(&cl.load, "load", false, "type LOAD after booting")
+	flag.BoolVar(&cl.run, "run", false, "type RUN after booting, or after loading finished with -load")
+	flag.BoolVar(&cl.fullscreen, "fullscreen", false, "start in full-screen mode")
+	flag.StringVar(&cl.recordAudio, "record-audio", "", "record the audio to this WAV file until exiting")
+	flag.StringVar(&cl.recordMovie, "record-movie", "", "record the inputs from power-on to this movie file until exiting")
+	flag.StringVar(&cl.playMovie, "play-movie", "", "replay this movie file")
+	flag.BoolVar(&cl.debug, "debug", false, "read debugger commands from the terminal")
+	flag.IntVar(&cl.gdb, "gdb", 0, "accept GDB remote protocol debugger connections on this localhost port")
+	flag.StringVar(&cl.trace, "trace", "", "write a trace of the executed instructions to this file until exiting")
+	flag.StringVar(&cl.traceRange, "trace-range", "", "only trace the instructions in this range: FIRST-LAST, rom or ram")
+	flag.StringVar(&cl.traceStart, "trace-start", "",
+		"start tracing at the instruction at this address, at the first breakpoint with break, or by Scroll Lock with key")
+	flag.StringVar(&cl.traceStop, "trace-stop", "", "stop tracing when the instruction at this address is reached")
+	flag.Parse()
+
+	var err error
+	flag.Visit(func(f *flag.Flag) {
+		if flagErr := cl.override(f.Name, of); flagErr != nil && err == nil {
+			err = flagErr
+		}
+	})
+	return cl, err
+}
+
+// override sets the option of the given flag.
+func (cl *commandLine) override(name string, of overrideFlags) error {
+	switch name {
+	case "rom":
+		cl.options.ROMType = ptr(primo.ROMType(of.romType))
+		if !cl.options.ROMType.Validate() {
+			return fmt.Errorf("%w: unknown ROM version %q", ErrInvalidFlag, of.romType)
+		}
+	case "ram":
+		cl.options.RAMSize = ptr(primo.RAMSize(of.ramSize))
+		if !cl.options.RAMSize.Validate() {
+			return fmt.Errorf("%w: unsupported RAM size %d", ErrInvalidFlag, of.ramSize)
+		}
+	case "clock":
+		speed, ok := clockSpeeds()[of.clock]
+		if !ok {
+			return fmt.Errorf("%w: unknown CPU frequency %q", ErrInvalidFlag, of.clock)
+		}
+		cl.options.ClockSpeed = &speed
+	case "whole-scale":
+		cl.options.WholeScaleOnly = &of.wholeScale
+	case "mute":
+		cl.options.Muted = &of.mute
+	}
+	return nil
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+
+	"primgo/primo/basic"
+)
+
+// listProgram lists the BASIC program in the memory of the machine.
+func (e *Emulator) listProgram() (string, error) {
+	listing, err := basic.ListMemory(e.machine.Memory())
+	if err != nil {
+		return "", err
+	}
+	return listing.String(), nil
+}
+
+// listTape lists the BASIC programs on the tape inserted, which has to be a PTP file, as tape
+// recordings are not decoded.
+func (e *Emulator) listTape() (string, error) {
+	tape := e.machine.Tape()
+	if tape == nil {
+		return "", fmt.Errorf("%w: the tape is not a PTP file", basic.ErrNoProgram)
+	}
+	return basic.ListTape(tape, e.machine.ROMType())
+}
@@ -4,36 +4,58 @@ import (
 	"fmt"
 	"image"
 	"log"
+	"os"
 	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/audio"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
-	"github.com/koron-go/z80"
 	"golang.org/x/exp/slices"
 
 	"primgo/primo"
+	"primgo/primo/gdbserver"
+	"primgo/primo/machine"
+	"primgo/primo/monitor"
+	"primgo/primo/tapes"
 	"primgo/ui"
 )
 
 const (
-	tickPerSec          = 50
-	vblankLength        = 0.0016
 	audioBufferSizeInMS = 100
 	sampleRate          = 44100
+	// warp mode emulates frames for this long in every tick, leaving the rest of it for drawing
+	warpTickLength = 15 * time.Millisecond
 )
 
 type Emulator struct {
 	primoScreen *ebiten.Image
 
-	memory *primo.Memory
-	io     *primo.IO
-	tape   *primo.TapePlayer
-	audio  *primo.AudioBuffer
-	cpu    *z80.CPU
+	machine    *machine.Machine
+	audio      *primo.AudioBuffer
+	audioStats primo.AudioStats
 
-	lastSoundSample float64
-	ramInitialized  bool
+	// recordings started from the UI and by the command line flag are independent of each other
+	uiRecorder   *primo.AudioRecorder
+	flagRecorder *primo.AudioRecorder
+
+	frameBudget float64
+	stepFrame   bool
+
+	// typing RUN waits for the tape to be loaded when both were asked for on the command line
+	runAfterLoad bool
+	loadStarted  bool
+
+	moviePlaying  bool
+	movieDiverged bool
+
+	// debugger commands typed on the terminal, and whether the debugger has stopped the machine
+	monitor         *monitor.Monitor
+	console         chan string
+	debuggerStopped bool
+	// the server of the debugger clients connected by the GDB protocol
+	gdb *gdbserver.Server
+	// the file the trace of the executed instructions is written to
+	traceFile *os.File
 
 	ui *ui.UI
 
@@ -43,13 +65,11 @@ type Emulator struct {
 	keyMappings ui.KeyMappings
 }
 
-func NewEmulator() *Emulator {
-	emuUI := ui.New(ui.NewResources())
+func NewEmulator(options ui.Options) *Emulator {
+	emuUI := ui.New(ui.NewResources(), options)
 
-	mem := primo.NewMemory(emuUI.ROMType)
-	io := primo.NewIO()
-	cpu := z80.Build(z80.WithMemory(mem), z80.WithIO(io), z80.WithNMI(io))
-	tapePlayer := primo.NewTapePlayer()
+	primoMachine := machine.New(emuUI.ROM, emuUI.RAMSize)
+	primoMachine.SampleRate = sampleRate
 	audioBuffer := primo.NewAudioBuffer(sampleRate)
 
 	audioPlayer, _ := audio.NewContext(sampleRate).NewPlayer(audioBuffer)
@@ -57,109 +77,150 @@ func NewEmulator() *Emulator {
 	audioPlayer.Play()
 
 	emu := &Emulator{
-		memory:      mem,
-		io:          io,
-		tape:        tapePlayer,
+		machine:     primoMachine,
+		monitor:     monitor.New(primoMachine),
 		audio:       audioBuffer,
-		cpu:         cpu,
 		ui:          emuUI,
 		keyMappings: ui.GetKeyMappings(),
 	}
 
-	emuUI.OnTapeChange = func(data []byte) {
-		tapePlayer.ChangeTape(data)
+	emuUI.OnTapeChange = primoMachine.ChangeTape
+	emuUI.OnTapeSignal = primoMachine.ChangeTapeSignal
+	emuUI.OnTapeSave = primoMachine.RecordedTape
+	emuUI.OnTapeSaved = primoMachine.ClearRecordedTape
+	emuUI.OnPRILoad = primoMachine.LoadPRI
+	emuUI.OnROMChange = primoMachine.ChangeROM
+	emuUI.OnStateSave = primoMachine.Snapshot
+	emuUI.OnStateLoad = primoMachine.LoadSnapshot
+	emuUI.OnAudioStart = emu.startAudioRecording
+	emuUI.OnAudioStop = emu.stopAudioRecording
+	emuUI.OnFrameStep = func() { emu.stepFrame = true }
+	emuUI.OnTypeText = emu.typeText
+	emuUI.OnMovieRecord = primoMachine.RecordMovie
+	emuUI.OnMovieStop = primoMachine.StopMovieRecording
+	emuUI.OnMoviePlay = primoMachine.PlayMovie
+	emuUI.OnDebugCommand = emu.monitor.Execute
+	emuUI.OnDebugView = emu.monitor.View
+	emuUI.OnMemoryView = emu.monitor.MemoryView
+	emuUI.OnMemoryLocate = emu.monitor.Locate
+	emuUI.OnMemoryFind = emu.monitor.Find
+	emuUI.OnProfileStart = primoMachine.Profiler().Start
+	emuUI.OnProfileStop = emu.stopProfiling
+	emuUI.OnListProgram = emu.listProgram
+	emuUI.OnListTape = emu.listTape
+
+	return emu
+}
+
+func (e *Emulator) updateKeyboardInput() {
+	var keys []ebiten.Key
+	keys = inpututil.AppendPressedKeys(keys)
+	keys = e.ui.AppendPressedKeys(keys)
+
+	e.updateMachineKeys(keys)
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyF11) {
+		ebiten.SetFullscreen(!ebiten.IsFullscreen())
 	}
 
-	emuUI.OnROMTypeChange = func(romType primo.ROMType) {
-		emu.memory = primo.NewMemory(romType)
-		emu.hardReset()
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) && slices.Contains(keys, ebiten.KeyControl) {
+		e.machine.HardReset()
 	}
 
-	return emu
-}
+	if inpututil.IsKeyJustPressed(ebiten.KeyF2) {
+		e.ui.SaveState()
+	}
 
-func (e *Emulator) hardReset() {
-	e.io = primo.NewIO()
-	e.cpu = z80.Build(z80.WithMemory(e.memory), z80.WithIO(e.io), z80.WithNMI(e.io))
-	e.ramInitialized = false
-	e.tape.Reset()
-}
+	if inpututil.IsKeyJustPressed(ebiten.KeyF3) {
+		e.ui.LoadState()
+	}
 
-// patchPTPLoad applies runtime ROM patches to load data from a PTP file instead of the tape
-// recorder IO ports.
-func (e *Emulator) patchPTPLoad() {
-	// skip sync reading in RDSYN subroutine
-	if e.cpu.PC == e.memory.ROMLabelAddress(primo.ROMLabelRDSYN) {
-		e.cpu.PC += 8
+	if inpututil.IsKeyJustPressed(ebiten.KeyF4) {
+		e.ui.NextStateSlot()
 	}
 
-	// overwrite INBYTE subroutine
-	if e.cpu.PC == e.memory.ROMLabelAddress(primo.ROMLabelINBYTE) {
-		nextByte := e.tape.NextByte()        // read next byte from PTP
-		e.cpu.DE.Hi = nextByte + e.cpu.DE.Hi // store checksum in D register
-		e.cpu.AF.Hi = nextByte               // store byte in A register
-		e.cpu.PC += 13                       // jump to RET in original subroutine
+	if inpututil.IsKeyJustPressed(ebiten.KeyF5) {
+		e.ui.ToggleAudioRecording()
 	}
 
-	// skip cassette handling in RDHEAD subroutine
-	if e.cpu.PC == e.memory.ROMLabelAddress(primo.ROMLabelRDHEAD)+9 {
-		e.cpu.PC += 110
+	if inpututil.IsKeyJustPressed(ebiten.KeyF12) {
+		e.ui.PasteText()
 	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyScrollLock) {
+		e.toggleTrace()
+	}
+
+	e.updateSpeedHotkeys()
 }
 
-// patchStuckNMIHandler works around the issue of getting the execution stuck in the NMI handlers
-// after a hard reset in the "C" version of the ROM.
-func (e *Emulator) patchStuckNMIHandler() {
-	if e.memory.ROMType != primo.ROMTypeC {
-		return
+// updateMachineKeys passes the pressed keys to the keyboard and the joysticks of the machine, except
+// while they are typed into the debugger panel or the memory viewer, or scroll the listing panel.
+func (e *Emulator) updateMachineKeys(keys []ebiten.Key) {
+	if e.ui.DebuggerOpen() || e.ui.MemoryViewerOpen() || e.ui.ListingOpen() {
+		keys = nil
 	}
+	e.machine.SetJoysticks(e.ui.Joysticks(keys))
+	e.machine.SetKeys(e.keyMappings.Translate(e.ui.RemoveJoystickKeys(slices.Clone(keys))))
+	e.machine.SetResetButton(slices.Contains(keys, ebiten.KeyF1))
+}
 
-	if e.cpu.PC == e.memory.ROMLabelAddress(primo.ROMLabelNMIStuck) {
-		e.cpu.PC++ // skip a jump that gets us stuck
+// typeText queues the keystrokes typing the text, using the keyboard layout of the current ROM.
+func (e *Emulator) typeText(text string) {
+	strokes, skipped := primo.TextKeystrokes(text, e.machine.ROMType())
+	if len(skipped) > 0 {
+		log.Printf("Characters without a key were not typed: %q\n", string(skipped))
 	}
+	e.machine.TypeKeys(strokes)
 }
 
-// patchStuckNMIFlag works around the issue of getting the CPU's InNMI flag stuck after a soft reset
-// is executed in the "A" and "B" versions of the ROM.
-func (e *Emulator) patchStuckNMIFlag() {
-	if e.memory.ROMType != primo.ROMTypeA && e.memory.ROMType != primo.ROMTypeB {
-		return
+func (e *Emulator) updateSpeedHotkeys() {
+	if inpututil.IsKeyJustPressed(ebiten.KeyF6) {
+		e.ui.TogglePause()
 	}
 
-	if e.cpu.PC == e.memory.ROMLabelAddress(primo.ROMLabelRESET) {
-		e.cpu.InNMI = false // we have to manually reset the CPU's NMI state
+	if inpututil.IsKeyJustPressed(ebiten.KeyF7) {
+		e.ui.StepFrame()
 	}
-}
 
-// sampleAudio appends the current state of the speaker output to the audio stream's buffer,
-// taking the sample rate into account.
-func (e *Emulator) sampleAudio() {
-	if e.ui.Muted {
-		return
+	if inpututil.IsKeyJustPressed(ebiten.KeyF8) {
+		e.ui.ToggleWarp()
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyF9) {
+		e.ui.ChangeSpeed(-1)
 	}
 
-	e.lastSoundSample += float64(e.cpu.LastOpCycles)
-	sampleCycles := float64(e.ui.ClockSpeed) / sampleRate
-	if e.lastSoundSample > sampleCycles {
-		e.lastSoundSample -= sampleCycles
-		e.audio.AddSample(e.io.Speaker)
+	if inpututil.IsKeyJustPressed(ebiten.KeyF10) {
+		e.ui.ChangeSpeed(1)
 	}
 }
 
-func (e *Emulator) updateKeyboardInput() {
-	var keys []ebiten.Key
-	keys = inpututil.AppendPressedKeys(keys)
-	keys = e.ui.AppendPressedKeys(keys)
+func (e *Emulator) startAudioRecording() {
+	e.uiRecorder = primo.NewAudioRecorder(sampleRate)
+}
 
-	e.io.Keys = e.keyMappings.Translate(keys)
-	e.io.Reset = slices.Contains(keys, ebiten.KeyF1)
+func (e *Emulator) stopAudioRecording() []byte {
+	wav := e.uiRecorder.WAV()
+	e.uiRecorder = nil
+	return wav
+}
 
-	if inpututil.IsKeyJustPressed(ebiten.KeyF11) {
-		ebiten.SetFullscreen(!ebiten.IsFullscreen())
+// addAudioSamples passes the samples of the frames emulated during the last tick to the player and
+// the recordings. The recordings get every sample, while the player only plays them when the
+// emulation runs in real time, otherwise it plays silence for the length of the tick.
+func (e *Emulator) addAudioSamples(samples []int16) {
+	e.audio.SetVolume(e.ui.OutputVolume())
+	if e.ui.RealTime() && !e.warp() && !e.debuggerStopped {
+		e.audio.AddSamples(samples)
+	} else {
+		e.audio.AddSamples(make([]int16, sampleRate/machine.FrameRate))
 	}
 
-	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) && slices.Contains(keys, ebiten.KeyControl) {
-		e.hardReset()
+	for _, recorder := range []*primo.AudioRecorder{e.uiRecorder, e.flagRecorder} {
+		if recorder != nil {
+			recorder.AddSamples(samples)
+		}
 	}
 }
 
@@ -167,41 +228,154 @@ func (e *Emulator) updateFreqCounter() {
 	now := time.Now().UnixMilli()
 	if now-e.freqCountStart > 1000 {
 		e.ui.MesauredClock = fmt.Sprintf("%.2f MHz", float64(e.freqCounter)/1000000.0)
+		if e.ui.Paused {
+			e.ui.MesauredClock = "Paused"
+		}
+		if e.debuggerStopped {
+			e.ui.MesauredClock = "Stopped"
+		}
 		e.freqCountStart = now
 		e.freqCounter = 0
+		e.logAudioStats()
 	}
 }
 
-func (e *Emulator) Update() error {
-	e.updateKeyboardInput()
+// logAudioStats reports if the audio buffer ran dry or overflowed since the last check.
+func (e *Emulator) logAudioStats() {
+	stats := e.audio.Stats()
+	if stats != e.audioStats {
+		log.Printf("Audio buffer underruns: %d, overruns: %d\n", stats.Underruns, stats.Overruns)
+		e.audioStats = stats
+	}
+}
 
-	vblankCycles := int(vblankLength * float64(e.ui.ClockSpeed))
-	cyclesPerTick := int(e.ui.ClockSpeed) / tickPerSec
+// runFrames emulates the frames due in this tick. Normally a tick is 1/machine.FrameRate second,
+// so one frame is emulated, while other speeds run more or less frames on average.
+func (e *Emulator) runFrames() {
+	switch {
+	case e.ui.Paused:
+		if e.stepFrame {
+			e.freqCounter += e.machine.RunFrame()
+		}
+	case e.warp():
+		start := time.Now()
+		for time.Since(start) < warpTickLength && e.warp() && !e.stoppedByDebugger() {
+			e.freqCounter += e.machine.RunFrame()
+		}
+	default:
+		e.frameBudget += float64(e.ui.Speed) / 100
+		for ; e.frameBudget >= 1; e.frameBudget-- {
+			e.freqCounter += e.machine.RunFrame()
+		}
+	}
+	e.stepFrame = false
+}
+
+// applyCommandLine inserts the tape, queues the commands to type, and starts recording the audio
+// as given on the command line.
+func (e *Emulator) applyCommandLine(cl commandLine) error {
+	// the movie starts from power-on, so it has to be started before everything else
+	if cl.recordMovie != "" {
+		e.machine.RecordMovie(true)
+	}
+	if cl.playMovie != "" {
+		data, err := os.ReadFile(cl.playMovie)
+		if err != nil {
+			return fmt.Errorf("cannot read movie: %w", err)
+		}
+		e.ui.PlayMovie(data)
+	}
+
+	if cl.tape != "" {
+		name, data, err := tapes.ReadFile(cl.tape)
+		if err != nil {
+			return err
+		}
+		e.ui.LoadFile(name, data)
+	}
+
+	if cl.load {
+		e.typeText("LOAD\n")
+		e.runAfterLoad = cl.run
+	} else if cl.run {
+		e.typeText("RUN\n")
+	}
 
-	if e.ramInitialized {
-		e.io.NMINext = true
+	if cl.recordAudio != "" {
+		e.flagRecorder = primo.NewAudioRecorder(sampleRate)
 	}
 
-	// Emulate 1/tickPerSec second worth of CPU time
-	for i := 0; i < cyclesPerTick; i += e.cpu.LastOpCycles {
-		// Simulated 50Hz VBlank signal
-		e.io.VBlank = i < vblankCycles
+	return e.startDebugging(cl)
+}
 
-		// INIT subroutine is called
-		if e.cpu.PC == e.memory.ROMLabelAddress(primo.ROMLabelINIT) {
-			e.ramInitialized = true
+// startDebugging reads debugger commands from the terminal, accepts GDB clients, and starts the
+// trace, as given on the command line.
+func (e *Emulator) startDebugging(cl commandLine) error {
+	if cl.debug {
+		e.console = startConsole()
+	}
+	if cl.gdb != 0 {
+		var err error
+		if e.gdb, err = gdbserver.Listen(e.machine, cl.gdb); err != nil {
+			return err
 		}
+		log.Printf("GDB server listening on %s\n", e.gdb.Addr())
+	}
+	return e.startTrace(cl)
+}
+
+// updateAutoRun types RUN once the program typed LOAD for has finished loading.
+func (e *Emulator) updateAutoRun() {
+	if !e.runAfterLoad || e.machine.Typing() {
+		return
+	}
+
+	e.loadStarted = e.loadStarted || e.machine.TapeLoading()
+	if e.loadStarted && !e.machine.TapeLoading() {
+		e.typeText("RUN\n")
+		e.runAfterLoad = false
+	}
+}
+
+// updateMoviePlayback reports when the movie being played diverges from the recording, and when it
+// ends.
+func (e *Emulator) updateMoviePlayback() {
+	playback := e.machine.MoviePlayback()
+	if playback.Playing && !e.moviePlaying {
+		e.movieDiverged = false
+	}
+
+	if playback.Divergences > 0 && !e.movieDiverged {
+		log.Printf("Movie playback diverged from the recording at frame %d\n", playback.FirstDivergence)
+		e.movieDiverged = true
+	}
+	if e.moviePlaying && !playback.Playing {
+		log.Printf("Movie playback ended at frame %d of %d, %d frames diverged\n",
+			playback.Frame, playback.Frames, playback.Divergences)
+	}
+	e.moviePlaying = playback.Playing
+}
+
+// warp reports whether the emulation should run as fast as possible, either because it was asked
+// to, or because a tape is loading with auto warp turned on.
+func (e *Emulator) warp() bool {
+	return e.ui.Warp || (e.ui.AutoWarp && e.machine.TapeLoading())
+}
 
-		e.patchPTPLoad()
-		e.patchStuckNMIHandler()
-		e.patchStuckNMIFlag()
-		e.sampleAudio()
+func (e *Emulator) Update() error {
+	e.updateKeyboardInput()
 
-		// execute a single instruction
-		e.cpu.Step()
+	e.machine.ClockSpeed = e.ui.ClockSpeed
+	e.machine.FastTape = e.ui.TapeMode == ui.TapeModeFast
 
-		e.freqCounter += e.cpu.LastOpCycles
+	if e.gdb != nil {
+		e.gdb.Update()
 	}
+	e.runFrames()
+	e.updateDebugger()
+	e.addAudioSamples(e.machine.AudioSamples())
+	e.updateAutoRun()
+	e.updateMoviePlayback()
 
 	e.ui.Update()
 	e.updateFreqCounter()
@@ -210,18 +384,15 @@ func (e *Emulator) Update() error {
 }
 
 func (e *Emulator) Draw(screen *ebiten.Image) {
-	screenPage := primo.ScreenPageSecondary
-	if e.io.PrimaryVideo {
-		screenPage = primo.ScreenPagePrimary
-	}
+	primoScreen := e.machine.Screen()
 
 	// ensure correct screen size
-	desiredSize := e.memory.ScreenResolution(screenPage)
+	desiredSize := primoScreen.Bounds().Size()
 	if e.primoScreen == nil || e.primoScreen.Bounds().Size() != desiredSize {
 		e.primoScreen = ebiten.NewImage(desiredSize.X, desiredSize.Y)
 	}
 
-	e.primoScreen.WritePixels(e.memory.GetRGBAScreenData(screenPage))
+	e.primoScreen.WritePixels(primoScreen.Pix)
 	e.ui.Draw(screen, e.primoScreen)
 }
 
@@ -230,7 +401,27 @@ func (e *Emulator) Layout(w, h int) (int, int) {
 	return w, h
 }
 
+// saveRecordings writes the audio and the movie recorded because of the command line flags.
+func (e *Emulator) saveRecordings(cl commandLine) {
+	if cl.recordAudio != "" {
+		if err := os.WriteFile(cl.recordAudio, e.flagRecorder.WAV(), 0600); err != nil {
+			log.Fatalf("Error saving audio recording: %s\n", err.Error())
+		}
+	}
+
+	if movie := e.machine.StopMovieRecording(); cl.recordMovie != "" && movie != nil {
+		if err := os.WriteFile(cl.recordMovie, movie.Encode(), 0600); err != nil {
+			log.Fatalf("Error saving movie: %s\n", err.Error())
+		}
+	}
+}
+
 func main() {
+	cl, err := parseCommandLine()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	ebiten.SetWindowSize(768, 624)
 	ebiten.SetWindowResizingMode(ebiten.WindowResizingModeEnabled)
 	ebiten.SetWindowTitle("PrimGO")
@@ -242,11 +433,19 @@ func main() {
 		ui.LoadPNGAsset("assets/icon48.png"),
 		ui.LoadPNGAsset("assets/icon32.png"),
 	})
-	ebiten.SetTPS(tickPerSec)
+	ebiten.SetTPS(machine.FrameRate)
+
+	ebiten.SetFullscreen(cl.fullscreen)
 
-	emu := NewEmulator()
+	emu := NewEmulator(cl.options)
+	if err = emu.applyCommandLine(cl); err != nil {
+		log.Fatal(err)
+	}
 
-	if err := ebiten.RunGame(emu); err != nil {
+	if err = ebiten.RunGame(emu); err != nil {
 		log.Fatal(err)
 	}
+
+	emu.saveRecordings(cl)
+	emu.stopTrace()
 }
@@ -1,39 +1,145 @@
 package primo
 
+import (
+	"sync"
+	"time"
+)
+
 const (
-	pcmLow  = 0x0
-	pcmHigh = 0x4000
+	// the buffer tries to keep this much audio queued, to have room for the emulation running a bit
+	// early or late
+	audioTargetLatency = 40 * time.Millisecond
+	// the most audio the buffer can hold, anything over it is dropped
+	audioBufferLength = 200 * time.Millisecond
+	// the playback speed is adjusted at most by this ratio to follow the emulation, which is small
+	// enough not to be heard
+	audioMaxDrift = 0.005
+	// weight of the latest fill level in its running average
+	audioFillSmoothing = 0.05
+	// bytes of a 16bit little endian 2 channel stereo PCM frame
+	audioFrameSize = 4
 )
 
+// AudioStats counts the problems of feeding the audio player since the buffer was created.
+type AudioStats struct {
+	// Underruns is the number of times the player wanted more audio than what was buffered.
+	Underruns int
+	// Overruns is the number of samples dropped because the buffer was full.
+	Overruns int
+}
+
+// AudioBuffer is a ring buffer between the emulation adding samples and the audio player reading
+// them on its own goroutine. The player reads slightly faster or slower depending on how full the
+// buffer is, so the small difference between the emulated and the real time doesn't make it run
+// dry or overflow.
 type AudioBuffer struct {
-	buf        []byte
-	sampleRate int
+	mu         sync.Mutex
+	samples    []int16
+	head       int
+	count      int
+	position   float64
+	last       int16
+	avgFill    float64
+	targetFill float64
+	volume     float64
+	stats      AudioStats
 }
 
 func NewAudioBuffer(sampleRate int) *AudioBuffer {
-	return &AudioBuffer{sampleRate: sampleRate}
+	targetFill := float64(sampleRate) * audioTargetLatency.Seconds()
+	return &AudioBuffer{
+		samples:    make([]int16, int(float64(sampleRate)*audioBufferLength.Seconds())),
+		targetFill: targetFill,
+		volume:     1,
+	}
 }
 
-// Read is the io.Reader implementation for the audio player to read the PCM stream.
+// Read is the io.Reader implementation for the audio player to read the PCM stream. It always fills
+// the whole slice, holding the last sample if the buffer runs dry.
 func (a *AudioBuffer) Read(p []byte) (int, error) {
-	if len(a.buf) == 0 {
-		// if the buffer is empty send 5ms of silence
-		for i := 0; i < (a.sampleRate/200)*4; i++ {
-			a.buf = append(a.buf, 0)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	frames := len(p) / audioFrameSize
+	step := a.playbackSpeed()
+	underrun := false
+
+	for i := 0; i < frames; i++ {
+		smp := a.last
+		if a.count >= 2 {
+			// interpolate between the two oldest samples
+			current, next := float64(a.at(0)), float64(a.at(1))
+			smp = int16(current + (next-current)*a.position)
+			a.advance(step)
+		} else {
+			underrun = true
 		}
+		a.last = smp
+		smp = int16(float64(smp) * a.volume)
+
+		// audio stream should be 16bit little endian 2 channel stereo PCM
+		p[i*audioFrameSize] = byte(smp)
+		p[i*audioFrameSize+1] = byte(smp >> 8)
+		p[i*audioFrameSize+2] = byte(smp)
+		p[i*audioFrameSize+3] = byte(smp >> 8)
 	}
 
-	length := copy(p, a.buf)
-	a.buf = a.buf[:0]
-	return length, nil
+	if underrun {
+		a.stats.Underruns++
+	}
+	return frames * audioFrameSize, nil
+}
+
+// playbackSpeed returns how many samples should be consumed for each one played, based on the
+// running average of the fill level.
+func (a *AudioBuffer) playbackSpeed() float64 {
+	a.avgFill += (float64(a.count) - a.avgFill) * audioFillSmoothing
+	drift := (a.avgFill - a.targetFill) / a.targetFill * audioMaxDrift
+	return 1 + min(max(drift, -audioMaxDrift), audioMaxDrift)
 }
 
-func (a *AudioBuffer) AddSample(high bool) {
-	smp := pcmLow
-	if high {
-		smp = pcmHigh
+// at returns the buffered sample at the given distance from the oldest one.
+func (a *AudioBuffer) at(n int) int16 {
+	return a.samples[(a.head+n)%len(a.samples)]
+}
+
+// advance moves the read position forward, dropping the samples that were passed.
+func (a *AudioBuffer) advance(step float64) {
+	a.position += step
+	for a.position >= 1 && a.count > 1 {
+		a.position--
+		a.head = (a.head + 1) % len(a.samples)
+		a.count--
+	}
+	// wait for the next sample instead of skipping past it
+	a.position = min(a.position, 1)
+}
+
+// AddSamples queues the 16bit PCM samples for playing.
+func (a *AudioBuffer) AddSamples(samples []int16) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, smp := range samples {
+		if a.count == len(a.samples) {
+			a.stats.Overruns++
+			continue
+		}
+		a.samples[(a.head+a.count)%len(a.samples)] = smp
+		a.count++
 	}
+}
+
+// SetVolume scales the samples played from now on, 0 is silent and 1 is the original volume.
+func (a *AudioBuffer) SetVolume(volume float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.volume = min(max(volume, 0), 1)
+}
 
-	// audio stream should be 16bit little endian 2 channel stereo PCM
-	a.buf = append(a.buf, []byte{byte(smp), byte(smp >> 8), byte(smp), byte(smp >> 8)}...)
+// Stats returns the number of underruns and overruns so far.
+func (a *AudioBuffer) Stats() AudioStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.stats
 }
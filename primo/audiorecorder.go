@@ -0,0 +1,21 @@
+package primo
+
+// AudioRecorder collects the samples of the speaker, and encodes them into a WAV file. It gets the
+// same samples as the AudioBuffer, before the volume is applied, so the recording doesn't depend
+// on the volume or on the audio being played at all.
+type AudioRecorder struct {
+	sampleRate int
+	samples    []int16
+}
+
+func NewAudioRecorder(sampleRate int) *AudioRecorder {
+	return &AudioRecorder{sampleRate: sampleRate}
+}
+
+func (a *AudioRecorder) AddSamples(samples []int16) {
+	a.samples = append(a.samples, samples...)
+}
+
+func (a *AudioRecorder) WAV() []byte {
+	return EncodeWAV(a.samples, a.sampleRate)
+}
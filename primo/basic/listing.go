@@ -0,0 +1,129 @@
+package basic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"primgo/primo"
+)
+
+var ErrInvalidProgram = errors.New("invalid BASIC program")
+
+// Line is a line of a BASIC program, with its keywords and characters converted to text.
+type Line struct {
+	Number uint16
+	Text   string
+}
+
+// Listing is the lines of a BASIC program in the order they are stored.
+type Listing []Line
+
+// String formats the listing like the LIST command, a line number and a space before every line.
+func (l Listing) String() string {
+	var sb strings.Builder
+	for _, line := range l {
+		fmt.Fprintf(&sb, "%d %s\n", line.Number, line.Text)
+	}
+	return sb.String()
+}
+
+// ListMemory lists the program in the memory, following the chain of lines from the start of the
+// program pointed to by TXTTAB. Every line starts with a pointer to the next one and the line
+// number, and ends with a zero byte, while the program ends with a zero pointer.
+func ListMemory(mem *primo.Memory) (Listing, error) {
+	txttab, ok := mem.LookupROMLabel(primo.ROMLabelTXTTAB)
+	if !ok {
+		return nil, fmt.Errorf("%w: the ROM has no BASIC program pointer", ErrInvalidProgram)
+	}
+
+	var listing Listing
+	line := getWord(mem, txttab)
+	for {
+		next := getWord(mem, line)
+		if next == 0 {
+			return listing, nil
+		}
+		// the lines follow each other, so the chain can't loop
+		if next <= line || next-line <= 4 || !mem.Populated(next) {
+			return listing, fmt.Errorf("%w: broken line chain at $%04X", ErrInvalidProgram, line)
+		}
+
+		tokens := make([]byte, 0, next-line-4)
+		for address := line + 4; address < next && mem.Get(address) != 0; address++ {
+			tokens = append(tokens, mem.Get(address))
+		}
+		listing = append(listing, Line{Number: getWord(mem, line+2), Text: Detokenize(tokens, mem.ROMType)})
+		line = next
+	}
+}
+
+// ListProgram lists a program saved from the memory, like the BASIC blocks of a tape file. The
+// pointers to the next lines are only valid where the program was saved, so the lines are found by
+// the zero bytes ending them.
+func ListProgram(program []byte, romType primo.ROMType) (Listing, error) {
+	var listing Listing
+	for pos := 0; pos+2 <= len(program); {
+		if program[pos] == 0 && program[pos+1] == 0 {
+			return listing, nil
+		}
+		if pos+4 > len(program) {
+			break
+		}
+
+		end := pos + 4
+		for end < len(program) && program[end] != 0 {
+			end++
+		}
+		if end == len(program) {
+			break
+		}
+		number := uint16(program[pos+2]) | uint16(program[pos+3])<<8
+		listing = append(listing, Line{Number: number, Text: Detokenize(program[pos+4:end], romType)})
+		pos = end + 1
+	}
+	return listing, fmt.Errorf("%w: the program is truncated", ErrInvalidProgram)
+}
+
+// Detokenize converts the contents of a line to text, replacing the tokens with their keywords
+// except in strings.
+func Detokenize(tokens []byte, romType primo.ROMType) string {
+	table := keywords(romType)
+	text := make([]byte, 0, len(tokens)*2)
+	quoted := false
+	for i := 0; i < len(tokens); i++ {
+		b := tokens[i]
+		switch {
+		case b == '"':
+			quoted = !quoted
+			text = append(text, b)
+		case quoted || (b < firstToken && b != ':'):
+			text = append(text, b)
+		case b == ':':
+			var skipped int
+			text, skipped = appendColon(text, tokens[i+1:])
+			i += skipped
+		case int(b-firstToken) < len(table):
+			text = append(text, table[b-firstToken]...)
+		default:
+			text = append(text, b)
+		}
+	}
+	return primo.DecodeText(text)
+}
+
+// appendColon appends a colon followed by the rest of the line, except the ones stored before
+// ELSE and the apostrophe, and returns the number of tokens of the rest it appended too.
+func appendColon(text, rest []byte) ([]byte, int) {
+	switch {
+	case len(rest) > 0 && rest[0] == tokenELSE:
+		return text, 0
+	case len(rest) > 1 && rest[0] == tokenREM && rest[1] == tokenApostrophe:
+		return append(text, '\''), 2
+	}
+	return append(text, ':'), 0
+}
+
+func getWord(mem *primo.Memory, address uint16) uint16 {
+	return uint16(mem.Get(address)) | uint16(mem.Get(address+1))<<8
+}
@@ -0,0 +1,46 @@
+package basic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"primgo/primo"
+)
+
+var ErrNoProgram = errors.New("no BASIC program")
+
+// ListTape lists the BASIC programs of the files on a PTP tape. When there are several of them,
+// every listing is preceded by the name of its file and an empty line.
+func ListTape(ptp []byte, romType primo.ROMType) (string, error) {
+	files, err := primo.ParsePTP(ptp)
+	if err != nil {
+		return "", err
+	}
+
+	var programs []primo.TapeFile
+	for _, file := range files {
+		if len(file.BASIC) > 0 {
+			programs = append(programs, file)
+		}
+	}
+	if len(programs) == 0 {
+		return "", fmt.Errorf("%w on the tape", ErrNoProgram)
+	}
+
+	var sb strings.Builder
+	for i, file := range programs {
+		listing, err := ListProgram(file.BASIC, romType)
+		if err != nil {
+			return "", fmt.Errorf("cannot list %q: %w", file.Name, err)
+		}
+		if len(programs) > 1 {
+			if i > 0 {
+				sb.WriteString("\n")
+			}
+			fmt.Fprintf(&sb, "%s\n\n", file.Name)
+		}
+		sb.WriteString(listing.String())
+	}
+	return sb.String(), nil
+}
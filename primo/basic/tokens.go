@@ -0,0 +1,68 @@
+// Package basic lists the BASIC programs of the PRIMO as text, from the memory of the machine or
+// from the files of a tape, the same way the LIST command of the ROM shows them.
+package basic
+
+import (
+	"primgo/primo"
+)
+
+const (
+	// the first byte standing for a keyword, the bytes below it are characters
+	firstToken = 0x80
+
+	tokenREM  = 0x93
+	tokenELSE = 0x95
+	// the apostrophe starting a comment is stored as ":REM'", and ELSE as ":ELSE"
+	tokenApostrophe = 0xFB
+)
+
+// keywords returns the keywords of the BASIC of the ROM version, indexed by their token from 0x80,
+// in the character set of the PRIMO. The C version has COLOR in place of an unused lowercase fn,
+// and REN and LINE in place of CLOAD and CSAVE.
+func keywords(romType primo.ROMType) []string {
+	table := keywordsA()
+	if romType == primo.ROMTypeC {
+		table[0xAC-firstToken] = "COLOR"
+		table[0xB9-firstToken] = "REN"
+		table[0xBA-firstToken] = "LINE"
+	}
+	return table
+}
+
+// keywordsA returns the keywords of the A and B versions, which follow the BASIC of the TRS-80.
+func keywordsA() []string {
+	return []string{
+		// 0x80
+		"END", "FOR", "RESET", "SET", "CLS", "CMD", "RANDOM", "NEXT",
+		// 0x88
+		"DATA", "INPUT", "DIM", "READ", "LET", "GOTO", "RUN", "IF",
+		// 0x90
+		"RESTORE", "GOSUB", "RETURN", "REM", "STOP", "ELSE", "TRON", "TROFF",
+		// 0x98
+		"DEFSTR", "DEFINT", "DEFSNG", "DEFDBL", "BEEP", "EDIT", "ERROR", "RESUME",
+		// 0xA0
+		"OUT", "ON", "OPEN", "FIELD", "GET", "PUT", "CLOSE", "LOAD",
+		// 0xA8
+		"MERGE", "TEST", "KILL", "CREATE", "fn", "SAVE", "SCREEN", "LPRINT",
+		// 0xB0
+		"DEF", "POKE", "PRINT", "CONT", "LIST", "LLIST", "DELETE", "AUTO",
+		// 0xB8
+		"CLEAR", "CLOAD", "CSAVE", "NEW", "TAB(", "TO", "FN", "USING",
+		// 0xC0
+		"VARPTR", "CALL", "ERL", "ERR", "STRING$", "INSTR", "POINT", "TIME$",
+		// 0xC8
+		"PI", "INKEY$", "THEN", "NOT", "STEP", "+", "-", "*",
+		// 0xD0
+		"/", "\x1f", "AND", "OR", ">", "=", "<", "SGN",
+		// 0xD8
+		"INT", "ABS", "FRE", "INP", "POS", "SQR", "RND", "LOG",
+		// 0xE0
+		"EXP", "COS", "SIN", "TAN", "ATN", "PEEK", "CVI", "CVS",
+		// 0xE8
+		"CVD", "EOF", "LOC", "LOF", "MKI$", "MKS$", "MKD$", "CINT",
+		// 0xF0
+		"CSNG", "CDBL", "FIX", "LEN", "STR$", "VAL", "ASC", "CHR$",
+		// 0xF8
+		"LEFT$", "RIGHT$", "MID$", "'",
+	}
+}
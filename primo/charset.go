@@ -0,0 +1,32 @@
+package primo
+
+// accentedRunes returns the Hungarian accented letters of the character set, which replace the
+// brackets and some other symbols of ASCII.
+func accentedRunes() map[byte]rune {
+	return map[byte]rune{
+		0x1e: 'í', 0x40: 'É', 0x5b: 'ó', 0x5c: 'Ö', 0x5d: 'Á', 0x5e: 'Ü', 0x5f: 'ú', 0x60: 'é',
+		0x7b: 'ő', 0x7c: 'ö', 0x7d: 'á', 0x7e: 'ü', 0x7f: 'ű',
+	}
+}
+
+// DecodeText converts text in the character set of the PRIMO into a string. It's ASCII, except for
+// the accented letters and the arrow used for raising to a power, while the control characters
+// are shown as dots.
+func DecodeText(data []byte) string {
+	accented := accentedRunes()
+	runes := make([]rune, 0, len(data))
+	for _, b := range data {
+		r, ok := accented[b]
+		switch {
+		case ok:
+		case b == 0x1f:
+			r = '↑'
+		case b < 0x20 || b > 0x7f:
+			r = '.'
+		default:
+			r = rune(b)
+		}
+		runes = append(runes, r)
+	}
+	return string(runes)
+}
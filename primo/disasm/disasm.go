@@ -0,0 +1,460 @@
+// Package disasm disassembles Z80 machine code, including the undocumented instructions, and
+// writes listings annotated with the labels of the PRIMO's ROM and user defined symbols.
+package disasm
+
+import (
+	"fmt"
+)
+
+// Reader is the memory interface the disassembler reads instructions from.
+type Reader interface {
+	Get(address uint16) uint8
+}
+
+// Instruction is a single decoded Z80 instruction.
+type Instruction struct {
+	Address      uint16
+	Bytes        []byte
+	Text         string
+	Undocumented bool
+
+	// Target is the absolute address referenced by the instruction, e.g. the destination of a jump
+	// or call, or the location of a memory operand.
+	Target    uint16
+	HasTarget bool
+}
+
+// Len returns the length of the instruction in bytes.
+func (i Instruction) Len() int {
+	return len(i.Bytes)
+}
+
+type indexMode int
+
+const (
+	indexNone indexMode = iota
+	indexIX
+	indexIY
+)
+
+func regs8(n uint8) string {
+	return [8]string{"B", "C", "D", "E", "H", "L", "(HL)", "A"}[n]
+}
+
+func regs16(n uint8) string {
+	return [4]string{"BC", "DE", "HL", "SP"}[n]
+}
+
+func regs16AF(n uint8) string {
+	return [4]string{"BC", "DE", "HL", "AF"}[n]
+}
+
+func conds(n uint8) string {
+	return [8]string{"NZ", "Z", "NC", "C", "PO", "PE", "P", "M"}[n]
+}
+
+func aluOps(n uint8) string {
+	return [8]string{"ADD A,", "ADC A,", "SUB ", "SBC A,", "AND ", "XOR ", "OR ", "CP "}[n]
+}
+
+func rotOps(n uint8) string {
+	return [8]string{"RLC", "RRC", "RL", "RR", "SLA", "SRA", "SLL", "SRL"}[n]
+}
+
+func accOps(n uint8) string {
+	return [8]string{"RLCA", "RRCA", "RLA", "RRA", "DAA", "CPL", "SCF", "CCF"}[n]
+}
+
+type decoder struct {
+	mem   Reader
+	start uint16
+	pos   uint16
+	index indexMode
+	disp  int8
+	inst  Instruction
+}
+
+// Decode disassembles the instruction at the given address.
+func Decode(mem Reader, address uint16) Instruction {
+	d := &decoder{mem: mem, start: address, pos: address}
+	d.inst.Address = address
+	d.inst.Text = d.decode()
+	for a := address; a != d.pos; a++ {
+		d.inst.Bytes = append(d.inst.Bytes, mem.Get(a))
+	}
+	return d.inst
+}
+
+func (d *decoder) fetch() uint8 {
+	b := d.mem.Get(d.pos)
+	d.pos++
+	return b
+}
+
+func (d *decoder) fetchWord() uint16 {
+	lo := d.fetch()
+	return uint16(lo) | uint16(d.fetch())<<8
+}
+
+func (d *decoder) undocumented() {
+	d.inst.Undocumented = true
+}
+
+func (d *decoder) target(address uint16) string {
+	d.inst.Target = address
+	d.inst.HasTarget = true
+	return fmt.Sprintf("$%04X", address)
+}
+
+func (d *decoder) byteOperand() string {
+	return fmt.Sprintf("$%02X", d.fetch())
+}
+
+func (d *decoder) wordOperand() string {
+	return fmt.Sprintf("$%04X", d.fetchWord())
+}
+
+func (d *decoder) addressOperand() string {
+	return d.target(d.fetchWord())
+}
+
+func (d *decoder) relativeOperand() string {
+	offset := int8(d.fetch())
+	return d.target(d.pos + uint16(offset))
+}
+
+func (d *decoder) indexName() string {
+	if d.index == indexIY {
+		return "IY"
+	}
+	return "IX"
+}
+
+func (d *decoder) indexedOperand() string {
+	if d.disp < 0 {
+		return fmt.Sprintf("(%s-$%02X)", d.indexName(), -int(d.disp))
+	}
+	return fmt.Sprintf("(%s+$%02X)", d.indexName(), d.disp)
+}
+
+// reg8 returns the name of an 8 bit register operand. When an index prefix is in effect H and L
+// refer to the halves of the index register, unless the instruction also has a memory operand.
+func (d *decoder) reg8(n uint8, hasMemOperand bool) string {
+	if d.index == indexNone {
+		return regs8(n)
+	}
+	switch {
+	case n == 6:
+		d.disp = int8(d.fetch())
+		return d.indexedOperand()
+	case (n == 4 || n == 5) && !hasMemOperand:
+		d.undocumented()
+		return d.indexName() + [2]string{"H", "L"}[n-4]
+	}
+	return regs8(n)
+}
+
+func (d *decoder) reg16(p uint8) string {
+	if p == 2 && d.index != indexNone {
+		return d.indexName()
+	}
+	return regs16(p)
+}
+
+func (d *decoder) reg16AF(p uint8) string {
+	if p == 2 && d.index != indexNone {
+		return d.indexName()
+	}
+	return regs16AF(p)
+}
+
+func (d *decoder) hl() string {
+	if d.index != indexNone {
+		return d.indexName()
+	}
+	return "HL"
+}
+
+func (d *decoder) decode() string {
+	op := d.fetch()
+	switch op {
+	case 0xcb:
+		return d.decodeCB()
+	case 0xed:
+		return d.decodeED()
+	case 0xdd, 0xfd:
+		return d.decodeIndexed(op)
+	}
+	return d.decodeMain(op)
+}
+
+// decodeIndexed handles the DD and FD prefixes. A prefix that doesn't affect the following
+// instruction behaves like a NOP.
+func (d *decoder) decodeIndexed(prefix uint8) string {
+	d.index = indexIX
+	if prefix == 0xfd {
+		d.index = indexIY
+	}
+
+	op := d.mem.Get(d.pos)
+	if op == 0xdd || op == 0xfd || op == 0xed || !usesHL(op) {
+		d.undocumented()
+		return "NOP"
+	}
+
+	d.pos++
+	if op == 0xcb {
+		return d.decodeIndexedCB()
+	}
+	return d.decodeMain(op)
+}
+
+// usesHL reports whether an unprefixed opcode refers to H, L, HL or (HL), and so is affected by
+// an index prefix.
+func usesHL(op uint8) bool {
+	x, y, z := op>>6, (op>>3)&7, op&7
+	switch x {
+	case 0:
+		return (z == 1 && y>>1 == 2) || (z == 1 && y&1 == 1) || (z == 2 && y>>1 == 2) ||
+			(z == 3 && y>>1 == 2) || (z >= 4 && z <= 6 && y >= 4 && y <= 6)
+	case 1:
+		return op != 0x76 && (y == 4 || y == 5 || y == 6 || z == 4 || z == 5 || z == 6)
+	case 2:
+		return z >= 4 && z <= 6
+	}
+	return op == 0xcb || op == 0xe1 || op == 0xe3 || op == 0xe5 || op == 0xe9 || op == 0xf9
+}
+
+func (d *decoder) decodeMain(op uint8) string {
+	x, y, z := op>>6, (op>>3)&7, op&7
+	switch x {
+	case 0:
+		return d.decodeX0(y, z)
+	case 1:
+		if op == 0x76 {
+			return "HALT"
+		}
+		hasMem := y == 6 || z == 6
+		dst := d.reg8(y, hasMem)
+		return "LD " + dst + "," + d.reg8(z, hasMem)
+	case 2:
+		return aluOps(y) + d.reg8(z, false)
+	}
+	return d.decodeX3(y, z)
+}
+
+func (d *decoder) decodeX0(y, z uint8) string {
+	p, q := y>>1, y&1
+	switch z {
+	case 0:
+		return d.decodeRelative(y)
+	case 1:
+		if q == 0 {
+			return "LD " + d.reg16(p) + "," + d.wordOperand()
+		}
+		return "ADD " + d.hl() + "," + d.reg16(p)
+	case 2:
+		return d.decodeIndirectLoad(p, q)
+	case 3:
+		return [2]string{"INC ", "DEC "}[q] + d.reg16(p)
+	case 4:
+		return "INC " + d.reg8(y, false)
+	case 5:
+		return "DEC " + d.reg8(y, false)
+	case 6:
+		dst := d.reg8(y, false)
+		return "LD " + dst + "," + d.byteOperand()
+	}
+	return accOps(y)
+}
+
+func (d *decoder) decodeRelative(y uint8) string {
+	switch y {
+	case 0:
+		return "NOP"
+	case 1:
+		return "EX AF,AF'"
+	case 2:
+		return "DJNZ " + d.relativeOperand()
+	case 3:
+		return "JR " + d.relativeOperand()
+	}
+	return "JR " + conds(y-4) + "," + d.relativeOperand()
+}
+
+func (d *decoder) decodeIndirectLoad(p, q uint8) string {
+	switch p<<1 | q {
+	case 0:
+		return "LD (BC),A"
+	case 1:
+		return "LD A,(BC)"
+	case 2:
+		return "LD (DE),A"
+	case 3:
+		return "LD A,(DE)"
+	case 4:
+		return "LD (" + d.addressOperand() + ")," + d.hl()
+	case 5:
+		return "LD " + d.hl() + ",(" + d.addressOperand() + ")"
+	case 6:
+		return "LD (" + d.addressOperand() + "),A"
+	}
+	return "LD A,(" + d.addressOperand() + ")"
+}
+
+//nolint:cyclop
+func (d *decoder) decodeX3(y, z uint8) string {
+	p, q := y>>1, y&1
+	switch z {
+	case 0:
+		return "RET " + conds(y)
+	case 1:
+		if q == 0 {
+			return "POP " + d.reg16AF(p)
+		}
+		return [4]string{"RET", "EXX", "JP (" + d.hl() + ")", "LD SP," + d.hl()}[p]
+	case 2:
+		return "JP " + conds(y) + "," + d.addressOperand()
+	case 3:
+		return d.decodeX3Z3(y)
+	case 4:
+		return "CALL " + conds(y) + "," + d.addressOperand()
+	case 5:
+		if q == 0 {
+			return "PUSH " + d.reg16AF(p)
+		}
+		return "CALL " + d.addressOperand()
+	case 6:
+		return aluOps(y) + d.byteOperand()
+	}
+	return "RST " + d.target(uint16(y)*8)
+}
+
+func (d *decoder) decodeX3Z3(y uint8) string {
+	switch y {
+	case 0:
+		return "JP " + d.addressOperand()
+	case 2:
+		return "OUT (" + d.byteOperand() + "),A"
+	case 3:
+		return "IN A,(" + d.byteOperand() + ")"
+	case 4:
+		return "EX (SP)," + d.hl()
+	case 5:
+		return "EX DE,HL"
+	case 6:
+		return "DI"
+	}
+	return "EI"
+}
+
+func (d *decoder) decodeCB() string {
+	op := d.fetch()
+	x, y, z := op>>6, (op>>3)&7, op&7
+	if x == 0 {
+		if y == 6 {
+			d.undocumented()
+		}
+		return rotOps(y) + " " + regs8(z)
+	}
+	return [4]string{"", "BIT ", "RES ", "SET "}[x] + fmt.Sprint(y) + "," + regs8(z)
+}
+
+// decodeIndexedCB handles the DDCB and FDCB opcodes, where the displacement precedes the opcode.
+// Every variant operates on the indexed memory location, the ones with a register operand also
+// copy the result into that register.
+func (d *decoder) decodeIndexedCB() string {
+	d.disp = int8(d.fetch())
+	op := d.fetch()
+	x, y, z := op>>6, (op>>3)&7, op&7
+
+	mem := d.indexedOperand()
+	var text string
+	if x == 0 {
+		text = rotOps(y) + " " + mem
+		if y == 6 {
+			d.undocumented()
+		}
+	} else {
+		text = [4]string{"", "BIT ", "RES ", "SET "}[x] + fmt.Sprint(y) + "," + mem
+	}
+
+	if z != 6 {
+		d.undocumented()
+		if x != 1 {
+			text += "," + regs8(z)
+		}
+	}
+
+	return text
+}
+
+func (d *decoder) decodeED() string {
+	op := d.fetch()
+	x, y, z := op>>6, (op>>3)&7, op&7
+	switch {
+	case x == 1:
+		return d.decodeEDX1(y, z)
+	case x == 2 && z <= 3 && y >= 4:
+		return [4][4]string{
+			{"LDI", "CPI", "INI", "OUTI"},
+			{"LDD", "CPD", "IND", "OUTD"},
+			{"LDIR", "CPIR", "INIR", "OTIR"},
+			{"LDDR", "CPDR", "INDR", "OTDR"},
+		}[y-4][z]
+	}
+	d.undocumented()
+	return "NOP"
+}
+
+//nolint:cyclop,funlen
+func (d *decoder) decodeEDX1(y, z uint8) string {
+	p, q := y>>1, y&1
+	switch z {
+	case 0:
+		if y == 6 {
+			d.undocumented()
+			return "IN F,(C)"
+		}
+		return "IN " + regs8(y) + ",(C)"
+	case 1:
+		if y == 6 {
+			d.undocumented()
+			return "OUT (C),0"
+		}
+		return "OUT (C)," + regs8(y)
+	case 2:
+		return [2]string{"SBC HL,", "ADC HL,"}[q] + regs16(p)
+	case 3:
+		if p == 2 {
+			d.undocumented()
+		}
+		if q == 0 {
+			return "LD (" + d.addressOperand() + ")," + regs16(p)
+		}
+		return "LD " + regs16(p) + ",(" + d.addressOperand() + ")"
+	case 4:
+		if y != 0 {
+			d.undocumented()
+		}
+		return "NEG"
+	case 5:
+		if y > 1 {
+			d.undocumented()
+		}
+		if y == 1 {
+			return "RETI"
+		}
+		return "RETN"
+	case 6:
+		if y != 0 && y != 2 && y != 3 {
+			d.undocumented()
+		}
+		return "IM " + [8]string{"0", "0/1", "1", "2", "0", "0/1", "1", "2"}[y]
+	}
+	if y >= 6 {
+		d.undocumented()
+		return "NOP"
+	}
+	return [6]string{"LD I,A", "LD R,A", "LD A,I", "LD A,R", "RRD", "RLD"}[y]
+}
@@ -0,0 +1,72 @@
+package disasm_test
+
+import (
+	"testing"
+
+	"primgo/primo/disasm"
+)
+
+// memory holds the code to disassemble from the start address, the rest of the memory reads zero.
+type memory struct {
+	start uint16
+	code  []byte
+}
+
+func (m memory) Get(address uint16) uint8 {
+	if offset := int(address - m.start); offset < len(m.code) {
+		return m.code[offset]
+	}
+	return 0
+}
+
+func TestDecode(t *testing.T) {
+	const start = 0x4000
+
+	tests := []struct {
+		code         []byte
+		text         string
+		undocumented bool
+		target       int // -1 when the instruction has no target
+	}{
+		{[]byte{0x00}, "NOP", false, -1},
+		{[]byte{0x3e, 0x12}, "LD A,$12", false, -1},
+		{[]byte{0x21, 0x34, 0x12}, "LD HL,$1234", false, -1},
+		{[]byte{0x3a, 0xa4, 0x40}, "LD A,($40A4)", false, 0x40a4},
+		{[]byte{0xc3, 0x00, 0x80}, "JP $8000", false, 0x8000},
+		{[]byte{0xcd, 0x75, 0x3c}, "CALL $3C75", false, 0x3c75},
+		{[]byte{0x18, 0xfe}, "JR $4000", false, start},
+		{[]byte{0x20, 0x02}, "JR NZ,$4004", false, start + 4},
+		{[]byte{0xff}, "RST $0038", false, 0x0038},
+		{[]byte{0xe9}, "JP (HL)", false, -1},
+		{[]byte{0xd3, 0xfe}, "OUT ($FE),A", false, -1},
+		{[]byte{0xcb, 0x47}, "BIT 0,A", false, -1},
+		{[]byte{0xed, 0xb0}, "LDIR", false, -1},
+		{[]byte{0xed, 0x4b, 0x00, 0x50}, "LD BC,($5000)", false, 0x5000},
+		{[]byte{0xdd, 0x7e, 0x05}, "LD A,(IX+$05)", false, -1},
+		{[]byte{0xfd, 0x36, 0xfe, 0x99}, "LD (IY-$02),$99", false, -1},
+		{[]byte{0xdd, 0xe9}, "JP (IX)", false, -1},
+		{[]byte{0xdd, 0xcb, 0x03, 0xc6}, "SET 0,(IX+$03)", false, -1},
+		{[]byte{0xdd, 0x24}, "INC IXH", true, -1},
+		{[]byte{0xcb, 0x30}, "SLL B", true, -1},
+		{[]byte{0xed, 0x70}, "IN F,(C)", true, -1},
+		{[]byte{0xed, 0x00}, "NOP", true, -1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			inst := disasm.Decode(memory{start: start, code: test.code}, start)
+			if inst.Text != test.text {
+				t.Errorf("Text = %q, want %q", inst.Text, test.text)
+			}
+			if inst.Len() != len(test.code) {
+				t.Errorf("Len() = %d, want %d", inst.Len(), len(test.code))
+			}
+			if inst.Undocumented != test.undocumented {
+				t.Errorf("Undocumented = %v, want %v", inst.Undocumented, test.undocumented)
+			}
+			if inst.HasTarget != (test.target >= 0) || (inst.HasTarget && int(inst.Target) != test.target) {
+				t.Errorf("Target = 0x%04X, %v, want %d", inst.Target, inst.HasTarget, test.target)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package disasm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteListing writes the disassembly of the memory between the start and end addresses, both
+// inclusive. Every line holds the address, the bytes and the text of an instruction, with the
+// symbols in place of the addresses they name, and a label line before every named address.
+func WriteListing(w io.Writer, mem Reader, start, end uint16, symbols Symbols) error {
+	out := bufio.NewWriter(w)
+	for address := int(start); address <= int(end); {
+		inst := Decode(mem, uint16(address))
+		if name, ok := symbols[inst.Address]; ok {
+			fmt.Fprintf(out, "\n%s:\n", name)
+		}
+		fmt.Fprintln(out, FormatLine(inst, symbols))
+		address += inst.Len()
+	}
+
+	if err := out.Flush(); err != nil {
+		return fmt.Errorf("cannot write listing: %w", err)
+	}
+	return nil
+}
+
+// FormatLine formats an instruction as a line of a listing. The address referred to by the
+// instruction is added as a comment if it was replaced by a symbol.
+func FormatLine(inst Instruction, symbols Symbols) string {
+	bytes := make([]string, 0, inst.Len())
+	for _, b := range inst.Bytes {
+		bytes = append(bytes, fmt.Sprintf("%02X", b))
+	}
+
+	var comments []string
+	text := symbols.Annotate(inst)
+	if text != inst.Text {
+		comments = append(comments, fmt.Sprintf("$%04X", inst.Target))
+	}
+	if inst.Undocumented {
+		comments = append(comments, "undocumented")
+	}
+
+	line := fmt.Sprintf("%04X  %-12s %s", inst.Address, strings.Join(bytes, " "), text)
+	if len(comments) > 0 {
+		line = fmt.Sprintf("%-40s ; %s", line, strings.Join(comments, ", "))
+	}
+	return line
+}
@@ -0,0 +1,64 @@
+package disasm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"primgo/primo"
+)
+
+var ErrInvalidSymbols = errors.New("invalid symbols")
+
+// Symbols names addresses in the disassembly.
+type Symbols map[uint16]string
+
+// ROMSymbols returns the labels of the routines and variables the emulator knows in the ROM, like
+// INBYTE or TXTTAB.
+func ROMSymbols(rom *primo.ROM) Symbols {
+	symbols := make(Symbols)
+	for label, address := range rom.Labels() {
+		symbols[address] = strings.ToUpper(string(label))
+	}
+	return symbols
+}
+
+// ParseSymbols reads user symbols from a JSON object of names and addresses, written the same way
+// as the labels in the ROM label override files:
+//
+//	{"main_loop": "0x4300", "score": "0x4A10"}
+func ParseSymbols(data []byte) (Symbols, error) {
+	var names map[string]string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSymbols, err)
+	}
+
+	symbols := make(Symbols, len(names))
+	for name, text := range names {
+		address, err := strconv.ParseUint(text, 0, 16)
+		if err != nil {
+			return nil, fmt.Errorf("%w: address of %s: %w", ErrInvalidSymbols, name, err)
+		}
+		symbols[uint16(address)] = name
+	}
+	return symbols, nil
+}
+
+// Add copies the other symbols into these ones, replacing the names of the same addresses.
+func (s Symbols) Add(other Symbols) {
+	for address, name := range other {
+		s[address] = name
+	}
+}
+
+// Annotate returns the text of the instruction with the address it refers to replaced by its
+// name, if it has one.
+func (s Symbols) Annotate(inst Instruction) string {
+	name, ok := s[inst.Target]
+	if !inst.HasTarget || !ok {
+		return inst.Text
+	}
+	return strings.Replace(inst.Text, fmt.Sprintf("$%04X", inst.Target), name, 1)
+}
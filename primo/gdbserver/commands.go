@@ -0,0 +1,288 @@
+package gdbserver
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/koron-go/z80"
+
+	"primgo/primo/machine"
+)
+
+const (
+	// the signals reported by the stop replies
+	signalInterrupt = 0x02
+	signalTrap      = 0x05
+
+	// the registers in the order of the z80 target of GDB, each of them 16 bits wide
+	registerCount = 13
+	maxPacketSize = 0x1000
+)
+
+// execute handles a command packet, and replies to it unless it resumes the machine, which is
+// replied to when the machine stops.
+func (s *Server) execute(data string) {
+	if data == "" {
+		s.send("")
+		return
+	}
+
+	command, args := data[0], data[1:]
+	switch command {
+	case 'c', 's':
+		s.resume(command, args)
+	case 'D', 'k':
+		s.send("OK")
+		s.disconnect()
+	default:
+		reply, err := s.reply(command, args)
+		if err != nil {
+			reply = "E01"
+		}
+		s.send(reply)
+	}
+}
+
+// reply handles the commands replied to immediately, unsupported commands get an empty reply.
+//
+//nolint:cyclop
+func (s *Server) reply(command byte, args string) (string, error) {
+	switch command {
+	case '?':
+		return s.stopReply(), nil
+	case 'g':
+		return s.readRegisters(), nil
+	case 'G':
+		return "OK", s.writeRegisters(args)
+	case 'p':
+		return s.readRegister(args)
+	case 'P':
+		return "OK", s.writeRegister(args)
+	case 'm':
+		return s.readMemory(args)
+	case 'M':
+		return "OK", s.writeMemory(args)
+	case 'Z', 'z':
+		return "OK", s.changeBreakpoint(command == 'Z', args)
+	case 'H', 'T':
+		return "OK", nil
+	case 'q', 'Q':
+		return s.query(args), nil
+	}
+	return "", nil
+}
+
+// query answers the general queries needed by GDB to start debugging.
+func (s *Server) query(args string) string {
+	switch {
+	case strings.HasPrefix(args, "Supported"):
+		return fmt.Sprintf("PacketSize=%x;QStartNoAckMode+", maxPacketSize)
+	case args == "StartNoAckMode":
+		s.noAck = true
+		return "OK"
+	case args == "Attached":
+		return "1"
+	case args == "C":
+		return "QC1"
+	case args == "fThreadInfo":
+		return "m1"
+	case args == "sThreadInfo":
+		return "l"
+	}
+	return ""
+}
+
+// resume continues or steps the machine, from the address given by the client if there is one.
+func (s *Server) resume(command byte, args string) {
+	if args != "" {
+		address, err := strconv.ParseUint(args, 16, 16)
+		if err != nil {
+			s.send("E01")
+			return
+		}
+		s.machine.CPU().PC = uint16(address)
+	}
+
+	if command == 's' {
+		s.machine.Debugger().StepInto()
+	} else {
+		s.machine.Debugger().Continue()
+	}
+	s.waiting = true
+}
+
+// stopReply tells the client why the machine was stopped, along with the address of the watchpoint
+// that triggered.
+func (s *Server) stopReply() string {
+	stop, _ := s.machine.Debugger().Stopped()
+	switch {
+	case stop.Reason == machine.StopBreak:
+		return fmt.Sprintf("S%02x", signalInterrupt)
+	case stop.Reason == machine.StopWatchpoint && stop.Watchpoint.Type == machine.WatchWrite:
+		return fmt.Sprintf("T%02xwatch:%x;", signalTrap, stop.Watchpoint.Address)
+	case stop.Reason == machine.StopWatchpoint && stop.Watchpoint.Type == machine.WatchRead:
+		return fmt.Sprintf("T%02xrwatch:%x;", signalTrap, stop.Watchpoint.Address)
+	}
+	return fmt.Sprintf("S%02x", signalTrap)
+}
+
+// registers returns pointers to the registers in the order GDB numbers them: AF, BC, DE, HL, SP,
+// PC, IX, IY, the alternate AF, BC, DE and HL, and IR.
+func registers(cpu *z80.CPU) []func() (uint16, func(uint16)) {
+	pair := func(r *z80.Register) func() (uint16, func(uint16)) {
+		return func() (uint16, func(uint16)) { return r.U16(), r.SetU16 }
+	}
+	word := func(w *uint16) func() (uint16, func(uint16)) {
+		return func() (uint16, func(uint16)) { return *w, func(v uint16) { *w = v } }
+	}
+	return []func() (uint16, func(uint16)){
+		pair(&cpu.AF), pair(&cpu.BC), pair(&cpu.DE), pair(&cpu.HL),
+		word(&cpu.SP), word(&cpu.PC), word(&cpu.IX), word(&cpu.IY),
+		pair(&cpu.Alternate.AF), pair(&cpu.Alternate.BC), pair(&cpu.Alternate.DE), pair(&cpu.Alternate.HL),
+		pair(&cpu.IR),
+	}
+}
+
+// readRegisters returns every register in little endian hexadecimal.
+func (s *Server) readRegisters() string {
+	data := make([]byte, 0, registerCount*2)
+	for _, register := range registers(s.machine.CPU()) {
+		value, _ := register()
+		data = binary.LittleEndian.AppendUint16(data, value)
+	}
+	return hex.EncodeToString(data)
+}
+
+func (s *Server) writeRegisters(args string) error {
+	data, err := hex.DecodeString(args)
+	if err != nil || len(data) < registerCount*2 {
+		return fmt.Errorf("%w: register values", ErrInvalidPacket)
+	}
+	for i, register := range registers(s.machine.CPU()) {
+		_, set := register()
+		set(binary.LittleEndian.Uint16(data[i*2:]))
+	}
+	return nil
+}
+
+// register returns the register selected by its number in hexadecimal.
+func (s *Server) register(number string) (func() (uint16, func(uint16)), error) {
+	n, err := strconv.ParseUint(number, 16, 8)
+	if err != nil || n >= registerCount {
+		return nil, fmt.Errorf("%w: register number %q", ErrInvalidPacket, number)
+	}
+	return registers(s.machine.CPU())[n], nil
+}
+
+func (s *Server) readRegister(args string) (string, error) {
+	register, err := s.register(args)
+	if err != nil {
+		return "", err
+	}
+	value, _ := register()
+	return hex.EncodeToString(binary.LittleEndian.AppendUint16(nil, value)), nil
+}
+
+func (s *Server) writeRegister(args string) error {
+	number, value, _ := strings.Cut(args, "=")
+	register, err := s.register(number)
+	if err != nil {
+		return err
+	}
+	data, err := hex.DecodeString(value)
+	if err != nil || len(data) != 2 {
+		return fmt.Errorf("%w: register value %q", ErrInvalidPacket, value)
+	}
+	_, set := register()
+	set(binary.LittleEndian.Uint16(data))
+	return nil
+}
+
+// parseRange parses the address and the length of the memory commands, given as "ADDR,LENGTH".
+func parseRange(args string) (uint16, int, error) {
+	address, length, _ := strings.Cut(args, ",")
+	a, err := strconv.ParseUint(address, 16, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: address %q", ErrInvalidPacket, address)
+	}
+	n, err := strconv.ParseUint(length, 16, 16)
+	if err != nil || n > maxPacketSize/2 {
+		return 0, 0, fmt.Errorf("%w: length %q", ErrInvalidPacket, length)
+	}
+	return uint16(a), int(n), nil
+}
+
+func (s *Server) readMemory(args string) (string, error) {
+	address, length, err := parseRange(args)
+	if err != nil {
+		return "", err
+	}
+	data := make([]byte, length)
+	for i := range data {
+		data[i] = s.machine.Memory().Get(address + uint16(i))
+	}
+	return hex.EncodeToString(data), nil
+}
+
+// writeMemory writes the RAM, the writes to the ROM are ignored just like on the real machine.
+func (s *Server) writeMemory(args string) error {
+	dataRange, values, _ := strings.Cut(args, ":")
+	address, length, err := parseRange(dataRange)
+	if err != nil {
+		return err
+	}
+	data, err := hex.DecodeString(values)
+	if err != nil || len(data) != length {
+		return fmt.Errorf("%w: memory contents", ErrInvalidPacket)
+	}
+	for i, b := range data {
+		s.machine.Memory().Set(address+uint16(i), b)
+	}
+	return nil
+}
+
+// changeBreakpoint inserts or removes a breakpoint, or a watchpoint on every byte of the watched
+// range. The arguments are the type, the address and the kind, which is the length of the range.
+func (s *Server) changeBreakpoint(insert bool, args string) error {
+	fields := strings.Split(args, ",")
+	if len(fields) < 3 {
+		return fmt.Errorf("%w: breakpoint %q", ErrInvalidPacket, args)
+	}
+	address, length, err := parseRange(fields[1] + "," + fields[2])
+	if err != nil {
+		return err
+	}
+
+	d := s.machine.Debugger()
+	if fields[0] == "0" || fields[0] == "1" {
+		if insert {
+			d.AddBreakpoint(address)
+		} else {
+			d.RemoveBreakpoint(address)
+		}
+		return nil
+	}
+
+	types := map[string][]machine.WatchType{
+		"2": {machine.WatchWrite},
+		"3": {machine.WatchRead},
+		"4": {machine.WatchRead, machine.WatchWrite},
+	}[fields[0]]
+	if types == nil {
+		return fmt.Errorf("%w: breakpoint type %q", ErrInvalidPacket, fields[0])
+	}
+	for i := 0; i < max(length, 1); i++ {
+		for _, t := range types {
+			w := machine.Watchpoint{Type: t, Address: address + uint16(i)}
+			if insert {
+				d.AddWatchpoint(w)
+			} else {
+				d.RemoveWatchpoint(w)
+			}
+		}
+	}
+	return nil
+}
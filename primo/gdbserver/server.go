@@ -0,0 +1,209 @@
+// Package gdbserver lets external debuggers control the machine through the GDB remote serial
+// protocol over TCP. GDB and the IDEs built on it can read and write the registers and the memory,
+// set breakpoints and watchpoints, and step the CPU.
+//
+// The connection is served in the background, but the packets are only handled by Update, which
+// has to be called between frames, so the machine is never accessed by two goroutines at once.
+package gdbserver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+
+	"primgo/primo/machine"
+)
+
+var ErrInvalidPacket = errors.New("invalid packet")
+
+// packet is a command received from the client, or the interrupt request sent by pressing Ctrl+C
+// in GDB.
+type packet struct {
+	conn      net.Conn
+	data      string
+	valid     bool
+	interrupt bool
+	closed    bool
+}
+
+type Server struct {
+	machine  *machine.Machine
+	listener net.Listener
+	packets  chan packet
+
+	conn  net.Conn
+	noAck bool
+	// the client resumed the machine, and waits for a stop reply when it stops
+	waiting bool
+}
+
+// Listen starts serving debugger clients on the port of the loopback interface, so the machine can
+// only be debugged from the same computer.
+func Listen(m *machine.Machine, port int) (*Server, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot start GDB server: %w", err)
+	}
+
+	s := &Server{
+		machine:  m,
+		listener: listener,
+		packets:  make(chan packet),
+	}
+	go s.accept()
+	return s, nil
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+func (s *Server) Close() error {
+	return s.listener.Close()
+}
+
+// accept serves the connecting clients, a new client replaces the previous one.
+func (s *Server) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.read(conn)
+	}
+}
+
+// read splits the data received on the connection into packets, and passes them to Update.
+func (s *Server) read(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			s.packets <- packet{conn: conn, closed: true}
+			return
+		}
+
+		switch b {
+		case 0x03:
+			s.packets <- packet{conn: conn, interrupt: true}
+		case '$':
+			data, valid, err := readPacket(r)
+			if err != nil {
+				s.packets <- packet{conn: conn, closed: true}
+				return
+			}
+			s.packets <- packet{conn: conn, data: data, valid: valid}
+		}
+	}
+}
+
+// readPacket reads the data of a packet after its leading $, and checks its checksum.
+func readPacket(r *bufio.Reader) (string, bool, error) {
+	data, err := r.ReadString('#')
+	if err != nil {
+		return "", false, err
+	}
+	data = data[:len(data)-1]
+
+	var checksum [2]byte
+	if _, err = io.ReadFull(r, checksum[:]); err != nil {
+		return "", false, err
+	}
+	sum, err := strconv.ParseUint(string(checksum[:]), 16, 8)
+	return data, err == nil && uint8(sum) == packetChecksum(data), nil
+}
+
+func packetChecksum(data string) uint8 {
+	var sum uint8
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	return sum
+}
+
+// Update handles the packets received since the last call, and sends the stop reply when the
+// machine stops after the client resumed it.
+func (s *Server) Update() {
+	for received := true; received; {
+		select {
+		case p := <-s.packets:
+			s.handle(p)
+		default:
+			received = false
+		}
+	}
+
+	if _, stopped := s.machine.Debugger().Stopped(); s.waiting && stopped {
+		s.waiting = false
+		s.send(s.stopReply())
+	}
+}
+
+func (s *Server) handle(p packet) {
+	switch {
+	case p.conn != s.conn && !p.closed:
+		s.connect(p.conn)
+	case p.conn != s.conn:
+		return
+	}
+
+	switch {
+	case p.closed:
+		s.disconnect()
+	case p.interrupt:
+		s.machine.Debugger().Break()
+	case !p.valid:
+		s.write("-")
+	default:
+		if !s.noAck {
+			s.write("+")
+		}
+		s.execute(p.data)
+	}
+}
+
+// connect replaces the previous client, and stops the machine for the new one like attaching to a
+// process.
+func (s *Server) connect(conn net.Conn) {
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.conn = conn
+	s.noAck = false
+	s.waiting = false
+	if _, stopped := s.machine.Debugger().Stopped(); !stopped {
+		s.machine.Debugger().Break()
+	}
+	log.Printf("GDB client connected from %s\n", conn.RemoteAddr())
+}
+
+// disconnect closes the connection of the client, and resumes the machine.
+func (s *Server) disconnect() {
+	if s.conn == nil {
+		return
+	}
+	s.conn.Close()
+	s.conn = nil
+	s.waiting = false
+	s.machine.Debugger().Continue()
+	log.Println("GDB client disconnected")
+}
+
+// send writes a packet with its checksum to the client.
+func (s *Server) send(data string) {
+	s.write(fmt.Sprintf("$%s#%02x", data, packetChecksum(data)))
+}
+
+func (s *Server) write(data string) {
+	if s.conn == nil {
+		return
+	}
+	if _, err := s.conn.Write([]byte(data)); err != nil {
+		log.Printf("Error writing to the GDB client: %s\n", err.Error())
+	}
+}
@@ -1,16 +1,39 @@
 package primo
 
-import "golang.org/x/exp/slices"
+import (
+	"time"
+
+	"golang.org/x/exp/slices"
+)
 
 const (
 	inVblankBitmask      = 0x20
+	inTapeBitmask        = 0x04
 	inResetBitmask       = 0x02
 	inKeyboardBitmask    = 0x01
+	inJoy1Bitmask        = 0x01
+	inJoy2Bitmask        = 0x04
 	outNMIBitmask        = 0x80
 	outSpeakerBitmask    = 0x10
 	outScreenPageBitmask = 0x08
-	outJoy1Bitmask       = 0x01
-	outJoy2Bitmask       = 0x04
+	outTapeMotorBitmask  = 0x04
+	outJoyClockBitmask   = 0x40
+
+	// the joystick interface starts selecting the switches from the first one again, if there were
+	// no clock pulses for this long
+	joystickResetTime = 500 * time.Microsecond
+)
+
+// Joystick holds the switches of a joystick that are currently closed.
+type Joystick uint8
+
+// The switches of the joysticks in the order they are selected by the clock pulses.
+const (
+	JoystickLeft Joystick = 1 << iota
+	JoystickDown
+	JoystickRight
+	JoystickUp
+	JoystickFire
 )
 
 type IO struct {
@@ -20,7 +43,15 @@ type IO struct {
 	Speaker      bool
 	VBlank       bool
 	Keys         []uint8
+	TypedKeys    []uint8
 	Reset        bool
+	TapeIn       bool
+	TapeMotor    bool
+	Joysticks    [2]Joystick
+
+	joystickClock  bool
+	joystickSelect int
+	joystickIdle   time.Duration
 }
 
 func NewIO() *IO {
@@ -30,6 +61,14 @@ func NewIO() *IO {
 	}
 }
 
+// screenPage returns the screen page currently selected for displaying.
+func (i *IO) screenPage() ScreenPage {
+	if i.PrimaryVideo {
+		return ScreenPagePrimary
+	}
+	return ScreenPageSecondary
+}
+
 func (i *IO) vblankBit() byte {
 	if i.VBlank {
 		return inVblankBitmask
@@ -38,7 +77,7 @@ func (i *IO) vblankBit() byte {
 }
 
 func (i *IO) keyboardBit(address uint8) byte {
-	if slices.Contains(i.Keys, address) {
+	if slices.Contains(i.Keys, address) || slices.Contains(i.TypedKeys, address) {
 		return inKeyboardBitmask
 	}
 	return 0
@@ -51,6 +90,52 @@ func (i *IO) resetBit() byte {
 	return 0
 }
 
+func (i *IO) tapeBit() byte {
+	if i.TapeIn {
+		return inTapeBitmask
+	}
+	return 0
+}
+
+// joystickBits returns the state of the currently selected switch of both joysticks, the inputs are
+// active low.
+func (i *IO) joystickBits() byte {
+	bits := byte(inJoy1Bitmask | inJoy2Bitmask)
+	if i.joystickSelect == 0 {
+		return bits
+	}
+
+	selected := Joystick(1) << (i.joystickSelect - 1)
+	if i.Joysticks[0]&selected != 0 {
+		bits &^= inJoy1Bitmask
+	}
+	if i.Joysticks[1]&selected != 0 {
+		bits &^= inJoy2Bitmask
+	}
+	return bits
+}
+
+// clockJoysticks selects the next switch of the joysticks on every rising edge of the clock.
+func (i *IO) clockJoysticks(clock bool) {
+	if clock && !i.joystickClock {
+		i.joystickSelect++
+		i.joystickIdle = 0
+	}
+	i.joystickClock = clock
+}
+
+// AdvanceJoysticks measures the time passed since the last clock pulse of the joystick interface.
+func (i *IO) AdvanceJoysticks(cycles, clockSpeed int) {
+	if i.joystickSelect == 0 || clockSpeed == 0 {
+		return
+	}
+
+	i.joystickIdle += time.Duration(cycles) * time.Second / time.Duration(clockSpeed)
+	if i.joystickIdle > joystickResetTime {
+		i.joystickSelect = 0
+	}
+}
+
 func (i *IO) In(address uint8) uint8 {
 	// 0x80-0xFF: Unused
 	if address > 0x7f {
@@ -59,11 +144,11 @@ func (i *IO) In(address uint8) uint8 {
 
 	// 0x40-0x7F: IN-2
 	if address > 0x3f {
-		return outJoy1Bitmask | outJoy2Bitmask
+		return i.joystickBits()
 	}
 
 	// 0x00-0x3F: IN-1
-	return i.vblankBit() | i.keyboardBit(address) | i.resetBit()
+	return i.vblankBit() | i.keyboardBit(address) | i.resetBit() | i.tapeBit()
 }
 
 func (i *IO) Out(address, b uint8) {
@@ -81,6 +166,8 @@ func (i *IO) Out(address, b uint8) {
 	i.NMIEnabled = b&outNMIBitmask != 0
 	i.Speaker = b&outSpeakerBitmask != 0
 	i.PrimaryVideo = b&outScreenPageBitmask != 0
+	i.TapeMotor = b&outTapeMotorBitmask == 0 // the motor relay is active low
+	i.clockJoysticks(b&outJoyClockBitmask != 0)
 }
 
 func (i *IO) CheckNMI() bool {
@@ -0,0 +1,57 @@
+package primo
+
+const (
+	// the ROM only registers a key after reading it the same way for a number of times, the "C"
+	// version being the slowest
+	keyHoldFrames = 10
+	// the key has to be released long enough to register the next press of the same key
+	keyReleaseFrames = 4
+)
+
+// KeyQueue types a series of keystrokes on the keyboard, holding every one of them long enough for
+// the ROM to register it. A keystroke is the keyboard addresses of the keys pressed together, like
+// Shift and a letter.
+type KeyQueue struct {
+	strokes [][]uint8
+	frame   int
+}
+
+func NewKeyQueue() *KeyQueue {
+	return &KeyQueue{}
+}
+
+// Type adds the keystrokes to the end of the queue.
+func (k *KeyQueue) Type(strokes ...[]uint8) {
+	k.strokes = append(k.strokes, strokes...)
+}
+
+// Clear drops every keystroke not typed yet.
+func (k *KeyQueue) Clear() {
+	k.strokes = nil
+	k.frame = 0
+}
+
+func (k *KeyQueue) Empty() bool {
+	return len(k.strokes) == 0
+}
+
+// Advance moves to the next frame, and to the next keystroke after the current one was released.
+func (k *KeyQueue) Advance() {
+	if len(k.strokes) == 0 {
+		return
+	}
+
+	k.frame++
+	if k.frame >= keyHoldFrames+keyReleaseFrames {
+		k.strokes = k.strokes[1:]
+		k.frame = 0
+	}
+}
+
+// Keys returns the keyboard addresses of the keys currently held down by the queue.
+func (k *KeyQueue) Keys() []uint8 {
+	if len(k.strokes) == 0 || k.frame >= keyHoldFrames {
+		return nil
+	}
+	return k.strokes[0]
+}
@@ -0,0 +1,68 @@
+package primo
+
+// The keyboard addresses of the keys, named after the labels of the Hungarian keyboard. The "B"
+// version of the ROM reads í, ő and ű from addresses that have no keys on the other versions.
+const (
+	KeyY            = 0x00
+	KeyUp           = 0x01
+	KeyS            = 0x02
+	KeyShift        = 0x03
+	KeyE            = 0x04
+	KeyUpper        = 0x05
+	KeyW            = 0x06
+	KeyCTR          = 0x07
+	KeyD            = 0x08
+	Key3            = 0x09
+	KeyX            = 0x0a
+	Key2            = 0x0b
+	KeyQ            = 0x0c
+	Key1            = 0x0d
+	KeyA            = 0x0e
+	KeyDown         = 0x0f
+	KeyC            = 0x10
+	KeyIAcute       = 0x11
+	KeyF            = 0x12
+	KeyODoubleAcute = 0x13
+	KeyR            = 0x14
+	KeyUDoubleAcute = 0x15
+	KeyT            = 0x16
+	Key7            = 0x17
+	KeyH            = 0x18
+	KeySpace        = 0x19
+	KeyB            = 0x1a
+	Key6            = 0x1b
+	KeyG            = 0x1c
+	Key5            = 0x1d
+	KeyV            = 0x1e
+	Key4            = 0x1f
+	KeyN            = 0x20
+	Key8            = 0x21
+	KeyZ            = 0x22
+	KeyPlus         = 0x23
+	KeyU            = 0x24
+	Key0            = 0x25
+	KeyJ            = 0x26
+	KeyGreater      = 0x27
+	KeyL            = 0x28
+	KeyMinus        = 0x29
+	KeyK            = 0x2a
+	KeyPeriod       = 0x2b
+	KeyM            = 0x2c
+	Key9            = 0x2d
+	KeyI            = 0x2e
+	KeyComma        = 0x2f
+	KeyUUmlaut      = 0x30
+	KeyAsterisk     = 0x31
+	KeyP            = 0x32
+	KeyUAcute       = 0x33
+	KeyO            = 0x34
+	KeyCLS          = 0x35
+	KeyReturn       = 0x37
+	KeyLeft         = 0x39
+	KeyEAcute       = 0x3a
+	KeyOAcute       = 0x3b
+	KeyAAcute       = 0x3c
+	KeyRight        = 0x3d
+	KeyOUmlaut      = 0x3e
+	KeyBRK          = 0x3f
+)
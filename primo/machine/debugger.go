@@ -0,0 +1,384 @@
+package machine
+
+import (
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/slices"
+
+	"primgo/primo"
+	"primgo/primo/disasm"
+)
+
+// WatchType is the kind of access a watchpoint stops the machine on.
+type WatchType uint8
+
+const (
+	WatchRead WatchType = iota + 1
+	WatchWrite
+	WatchIn
+	WatchOut
+)
+
+func (w WatchType) String() string {
+	return map[WatchType]string{
+		WatchRead:  "read",
+		WatchWrite: "write",
+		WatchIn:    "in",
+		WatchOut:   "out",
+	}[w]
+}
+
+// Watchpoint stops the machine after the CPU accesses the memory address, or the IO port given in
+// the low byte of the address.
+type Watchpoint struct {
+	Type    WatchType
+	Address uint16
+}
+
+type StopReason uint8
+
+const (
+	StopBreak StopReason = iota + 1
+	StopBreakpoint
+	StopWatchpoint
+	StopStep
+)
+
+// Stop tells why the debugger stopped the machine.
+type Stop struct {
+	Reason StopReason
+	// PC is the address of the next instruction to execute.
+	PC uint16
+	// the watchpoint that triggered, and the value read or written by the instruction before PC
+	Watchpoint Watchpoint
+	Value      uint8
+}
+
+type stepMode uint8
+
+const (
+	stepNone stepMode = iota
+	stepInto
+	stepOver
+	stepOut
+	stepTo
+)
+
+// Debugger stops the machine at breakpoints and watchpoints, and executes it instruction by
+// instruction. While the machine is stopped the Run methods of the machine return without
+// executing anything, until the debugger resumes it.
+type Debugger struct {
+	machine     *Machine
+	breakpoints map[uint16]bool
+	watchpoints map[Watchpoint]bool
+	stopped     bool
+	stop        Stop
+	hit         *Stop
+
+	mode stepMode
+	// address stepping over or running to stops at, and the stack pointer when the step started
+	target    uint16
+	sp        uint16
+	callLike  bool
+	returning bool
+	// the instruction at PC is executed even if there is a breakpoint at it, right after resuming
+	resumed bool
+	// stepping over skips the NMI handler when it's entered, instead of stopping in it
+	wasInNMI   bool
+	skippedNMI bool
+	// the bytes of the instruction being executed, as fetching them doesn't trigger read watchpoints
+	fetchStart  uint16
+	fetchLength int
+}
+
+func newDebugger(m *Machine) *Debugger {
+	return &Debugger{
+		machine:     m,
+		breakpoints: make(map[uint16]bool),
+		watchpoints: make(map[Watchpoint]bool),
+	}
+}
+
+func (m *Machine) Debugger() *Debugger {
+	return m.debugger
+}
+
+func (d *Debugger) AddBreakpoint(address uint16) {
+	d.breakpoints[address] = true
+}
+
+func (d *Debugger) RemoveBreakpoint(address uint16) {
+	delete(d.breakpoints, address)
+}
+
+// Breakpoints returns the addresses of the breakpoints in ascending order.
+func (d *Debugger) Breakpoints() []uint16 {
+	addresses := make([]uint16, 0, len(d.breakpoints))
+	for address := range d.breakpoints {
+		addresses = append(addresses, address)
+	}
+	slices.Sort(addresses)
+	return addresses
+}
+
+func (d *Debugger) HasBreakpoint(address uint16) bool {
+	return d.breakpoints[address]
+}
+
+func (d *Debugger) AddWatchpoint(w Watchpoint) {
+	d.watchpoints[d.normalize(w)] = true
+}
+
+func (d *Debugger) RemoveWatchpoint(w Watchpoint) {
+	delete(d.watchpoints, d.normalize(w))
+}
+
+// Watchpoints returns the watchpoints ordered by their type and address.
+func (d *Debugger) Watchpoints() []Watchpoint {
+	watchpoints := make([]Watchpoint, 0, len(d.watchpoints))
+	for w := range d.watchpoints {
+		watchpoints = append(watchpoints, w)
+	}
+	sort.Slice(watchpoints, func(i, j int) bool {
+		if watchpoints[i].Type != watchpoints[j].Type {
+			return watchpoints[i].Type < watchpoints[j].Type
+		}
+		return watchpoints[i].Address < watchpoints[j].Address
+	})
+	return watchpoints
+}
+
+// normalize drops the high byte of the port addresses, only the low one selects the port.
+func (d *Debugger) normalize(w Watchpoint) Watchpoint {
+	if w.Type == WatchIn || w.Type == WatchOut {
+		w.Address &= 0xFF
+	}
+	return w
+}
+
+// Stopped returns why the machine was stopped, if it's stopped.
+func (d *Debugger) Stopped() (Stop, bool) {
+	return d.stop, d.stopped
+}
+
+// Break stops the machine before the next instruction.
+func (d *Debugger) Break() {
+	d.stopAt(StopBreak)
+}
+
+// Continue resumes the machine until the next breakpoint or watchpoint.
+func (d *Debugger) Continue() {
+	d.resume(stepNone)
+}
+
+// StepInto executes a single instruction, or enters the NMI handler if the interrupt is due.
+func (d *Debugger) StepInto() {
+	d.resume(stepInto)
+}
+
+// StepOver executes a single instruction like StepInto, but runs subroutine calls, restarts and
+// repeated block instructions until they return, and skips the NMI handler.
+func (d *Debugger) StepOver() {
+	d.resume(stepOver)
+	inst := disasm.Decode(d.machine.memory, d.machine.cpu.PC)
+	d.target = inst.Address + uint16(inst.Len())
+	d.callLike = callLike(inst.Text)
+}
+
+// StepOut runs until the current subroutine returns to its caller.
+func (d *Debugger) StepOut() {
+	d.resume(stepOut)
+}
+
+// RunTo runs until the instruction at the address is reached, or something else stops the
+// machine before that.
+func (d *Debugger) RunTo(address uint16) {
+	d.resume(stepTo)
+	d.target = address
+}
+
+func (d *Debugger) resume(mode stepMode) {
+	d.stopped = false
+	d.hit = nil
+	d.mode = mode
+	d.sp = d.machine.cpu.SP
+	d.resumed = true
+	d.skippedNMI = false
+}
+
+func (d *Debugger) stopAt(reason StopReason) {
+	d.stopped = true
+	d.stop = Stop{Reason: reason, PC: d.machine.cpu.PC}
+	d.mode = stepNone
+}
+
+// callLike reports whether the instruction returns to the next one after running some other code,
+// which stepping over doesn't stop in.
+func callLike(text string) bool {
+	mnemonic, _, _ := strings.Cut(text, " ")
+	return slices.Contains([]string{
+		"CALL", "RST", "LDIR", "LDDR", "CPIR", "CPDR", "INIR", "INDR", "OTIR", "OTDR",
+	}, mnemonic)
+}
+
+// beforeStep checks the breakpoints before the next instruction, and returns whether the
+// instruction can be executed.
+func (d *Debugger) beforeStep() bool {
+	if d.stopped {
+		return false
+	}
+	// only the first instruction after resuming skips its breakpoint, even if there were no
+	// breakpoints to check then
+	resumed := d.resumed
+	d.resumed = false
+	if len(d.breakpoints) == 0 && d.mode == stepNone {
+		return true
+	}
+
+	cpu := d.machine.cpu
+	if reason, ok := d.breakAt(cpu.PC); ok && !resumed {
+		if reason == StopBreakpoint {
+			d.machine.tracer.breakpointHit()
+		}
+		d.stopAt(reason)
+		return false
+	}
+
+	d.wasInNMI = cpu.InNMI
+	if d.mode == stepOut {
+		d.returning = strings.HasPrefix(disasm.Decode(d.machine.memory, cpu.PC).Text, "RET")
+	}
+	return true
+}
+
+// markFetches notes the bytes the CPU fetches in the next step when there are read watchpoints, so
+// only the data reads made by the instruction trigger them. It's called right before the step, after
+// the ROM patches moved PC. Entering the NMI handler only fetches the opcode at PC, which is
+// discarded.
+func (d *Debugger) markFetches() {
+	d.fetchLength = 0
+	for w := range d.watchpoints {
+		if w.Type == WatchRead {
+			d.fetchStart = d.machine.cpu.PC
+			d.fetchLength = 1
+			if !d.machine.nmiAccepted() {
+				d.fetchLength = disasm.Decode(d.machine.memory, d.fetchStart).Len()
+			}
+			return
+		}
+	}
+}
+
+// breakAt returns why the machine has to stop before the instruction at the address, if it has to.
+func (d *Debugger) breakAt(address uint16) (StopReason, bool) {
+	switch {
+	case d.mode == stepTo && address == d.target:
+		return StopStep, true
+	case d.breakpoints[address]:
+		return StopBreakpoint, true
+	}
+	return 0, false
+}
+
+// afterStep stops the machine if a watchpoint was triggered by the last instruction, or the step
+// being executed has finished.
+func (d *Debugger) afterStep() {
+	if d.hit != nil {
+		d.stopped = true
+		d.stop = *d.hit
+		d.stop.PC = d.machine.cpu.PC
+		d.hit = nil
+		d.mode = stepNone
+		return
+	}
+
+	cpu := d.machine.cpu
+	switch d.mode {
+	case stepInto:
+		d.stopAt(StopStep)
+	case stepOver:
+		if d.inSkippedNMI() {
+			return
+		}
+		if !d.callLike || (cpu.PC == d.target && cpu.SP >= d.sp) {
+			d.stopAt(StopStep)
+		}
+	case stepOut:
+		if d.returning && cpu.SP > d.sp {
+			d.stopAt(StopStep)
+		}
+	}
+}
+
+// inSkippedNMI reports whether the last instruction was executed by an NMI handler entered while
+// stepping over, including the return from it.
+func (d *Debugger) inSkippedNMI() bool {
+	cpu := d.machine.cpu
+	if cpu.InNMI && !d.wasInNMI {
+		d.skippedNMI = true
+	}
+	if !d.skippedNMI {
+		return false
+	}
+	d.skippedNMI = cpu.InNMI
+	return true
+}
+
+// access triggers the watchpoint of a memory or IO access made by the CPU, the machine is stopped
+// after the instruction making it.
+func (d *Debugger) access(t WatchType, address uint16, value uint8) {
+	if len(d.watchpoints) == 0 || d.hit != nil {
+		return
+	}
+	if t == WatchRead && int(address-d.fetchStart) < d.fetchLength {
+		return
+	}
+
+	w := d.normalize(Watchpoint{Type: t, Address: address})
+	if d.watchpoints[w] {
+		d.hit = &Stop{Reason: StopWatchpoint, Watchpoint: w, Value: value}
+	}
+}
+
+// cpuMemory is the memory as seen by the CPU, reporting the accesses to the debugger and the tracer.
+// The accesses include fetching the instructions too, which the debugger tells apart from the data
+// reads.
+type cpuMemory struct {
+	*primo.Memory
+	debugger *Debugger
+	tracer   *Tracer
+	writes   *writeHistory
+}
+
+func (c cpuMemory) Get(address uint16) uint8 {
+	b := c.Memory.Get(address)
+	c.debugger.access(WatchRead, address, b)
+	return b
+}
+
+func (c cpuMemory) Set(address uint16, b uint8) {
+	c.Memory.Set(address, b)
+	c.debugger.access(WatchWrite, address, b)
+	c.tracer.access(WatchWrite, address, b)
+	c.writes.write(address)
+}
+
+// cpuIO is the IO ports as seen by the CPU, reporting the accesses to the debugger and the tracer.
+type cpuIO struct {
+	*primo.IO
+	debugger *Debugger
+	tracer   *Tracer
+}
+
+func (c cpuIO) In(address uint8) uint8 {
+	b := c.IO.In(address)
+	c.debugger.access(WatchIn, uint16(address), b)
+	return b
+}
+
+func (c cpuIO) Out(address, b uint8) {
+	c.IO.Out(address, b)
+	c.debugger.access(WatchOut, uint16(address), b)
+	c.tracer.access(WatchOut, uint16(address), b)
+}
@@ -0,0 +1,31 @@
+package machine_test
+
+import (
+	"testing"
+
+	"primgo/primo"
+	"primgo/primo/machine"
+)
+
+func TestDebuggerStopsAtBreakpointAddedAfterResuming(t *testing.T) {
+	m := machine.New(primo.BuiltInROM(primo.ROMTypeA), primo.RAMSize48K)
+	for frame := 0; frame < 100; frame++ {
+		m.RunFrame()
+	}
+
+	d := m.Debugger()
+	d.Break()
+	d.Continue()
+	m.RunFrame()
+
+	// the breakpoint is on the next instruction, so nothing is executed before stopping
+	pc := m.CPU().PC
+	d.AddBreakpoint(pc)
+	if cycles := m.RunFrame(); cycles != 0 {
+		t.Errorf("RunFrame() = %d, want 0", cycles)
+	}
+	stop, stopped := d.Stopped()
+	if !stopped || stop.Reason != machine.StopBreakpoint || stop.PC != pc {
+		t.Errorf("Stopped() = %+v, %v, want a breakpoint at 0x%04X", stop, stopped, pc)
+	}
+}
@@ -0,0 +1,488 @@
+// Package machine emulates a whole PRIMO computer without any user interface, so it can be driven
+// by the desktop frontend, tests and tools alike.
+package machine
+
+import (
+	"fmt"
+	"image"
+	"time"
+
+	"github.com/koron-go/z80"
+
+	"primgo/primo"
+)
+
+const (
+	FrameRate = 50
+
+	// loading is considered finished after the tape wasn't read for this many frames
+	tapeIdleFrames = FrameRate / 2
+	// the ROM is ready for typing this many frames after initializing the RAM
+	keyboardReadyFrames = FrameRate / 2
+)
+
+// ClockSpeed is the frequency of the CPU in Hz.
+type ClockSpeed int
+
+// The CPU frequencies the frontends offer, the normal one is the original.
+const (
+	ClockSpeedNormal   ClockSpeed = 2500000
+	ClockSpeedSpectrum ClockSpeed = 3500000
+	ClockSpeedTurbo    ClockSpeed = 3750000
+	DefaultClockSpeed             = ClockSpeedNormal
+)
+
+func (c ClockSpeed) Validate() bool {
+	return map[ClockSpeed]bool{
+		ClockSpeedNormal:   true,
+		ClockSpeedSpectrum: true,
+		ClockSpeedTurbo:    true,
+	}[c]
+}
+
+// Machine is a PRIMO with its CPU, memory, IO ports and a tape player attached to it. Time only
+// passes while one of the Run methods is executing.
+type Machine struct {
+	// ClockSpeed is the CPU frequency in Hz, the length of a frame depends on it.
+	ClockSpeed ClockSpeed
+	// SampleRate is the number of audio samples collected per second of emulated time. Collecting
+	// audio is disabled when it's 0.
+	SampleRate int
+	// FastTape makes the ROM read the tape contents directly instead of following the signal.
+	FastTape bool
+
+	memory   *primo.Memory
+	io       *primo.IO
+	cpu      *z80.CPU
+	tape     *primo.TapePlayer
+	recorder *primo.TapeRecorder
+	signal   *primo.TapeSignal
+	video    *primo.Video
+	speaker  *primo.Speaker
+	keyQueue *primo.KeyQueue
+
+	recording *movieRecording
+	player    *moviePlayer
+	debugger  *Debugger
+	tracer    *Tracer
+	profiler  *Profiler
+	writes    *writeHistory
+
+	// the inputs set from the outside, they only reach the IO ports at the start of the next frame,
+	// so a movie can replay them at the same moment
+	keys      []uint8
+	joysticks [2]primo.Joystick
+	reset     bool
+
+	ramInitialized bool
+	pendingPRI     *primo.PRIFile
+	frameCycle     int
+	tapeActive     bool
+	tapeIdle       int
+	initFrames     int
+}
+
+func New(rom *primo.ROM, ramSize primo.RAMSize) *Machine {
+	m := &Machine{
+		ClockSpeed: DefaultClockSpeed,
+		FastTape:   true,
+		tape:       primo.NewTapePlayer(),
+		recorder:   primo.NewTapeRecorder(),
+		signal:     primo.NewTapeSignal(),
+		video:      primo.NewVideo(),
+		speaker:    primo.NewSpeaker(),
+		keyQueue:   primo.NewKeyQueue(),
+	}
+	m.debugger = newDebugger(m)
+	m.tracer = newTracer(m)
+	m.profiler = newProfiler(m)
+	m.writes = newWriteHistory()
+	m.ChangeROM(rom, ramSize)
+	return m
+}
+
+// ChangeROM replaces the ROM and the installed RAM, which also results in a hard reset.
+func (m *Machine) ChangeROM(rom *primo.ROM, ramSize primo.RAMSize) {
+	m.stateReplaced()
+	m.memory = primo.NewMemory(rom, ramSize)
+	m.hardReset()
+}
+
+// HardReset clears the whole state of the machine just like turning it off and on again. The
+// tape stays in the player, but it's rewound.
+func (m *Machine) HardReset() {
+	m.inputEvent(primo.MovieEvent{Type: primo.MovieEventHardReset})
+}
+
+func (m *Machine) hardReset() {
+	m.io = primo.NewIO()
+	m.buildCPU()
+	m.ramInitialized = false
+	m.initFrames = 0
+	m.tapeIdle = tapeIdleFrames
+	m.keyQueue.Clear()
+	m.tape.Reset()
+	m.signal.Reset()
+}
+
+// buildCPU creates a new CPU for the memory and the IO ports, which reports their accesses to the
+// debugger and the tracer, and the writes to the write history.
+func (m *Machine) buildCPU() {
+	m.cpu = z80.Build(
+		z80.WithMemory(cpuMemory{Memory: m.memory, debugger: m.debugger, tracer: m.tracer, writes: m.writes}),
+		z80.WithIO(cpuIO{IO: m.io, debugger: m.debugger, tracer: m.tracer}),
+		z80.WithNMI(m.io),
+	)
+}
+
+func (m *Machine) ROMType() primo.ROMType {
+	return m.memory.ROMType
+}
+
+func (m *Machine) RAMSize() primo.RAMSize {
+	return m.memory.RAMSize
+}
+
+func (m *Machine) Memory() *primo.Memory {
+	return m.memory
+}
+
+func (m *Machine) CPU() *z80.CPU {
+	return m.cpu
+}
+
+// SetKeys sets the keyboard addresses of the keys currently held down, from the start of the next
+// frame.
+func (m *Machine) SetKeys(keys []uint8) {
+	m.keys = keys
+}
+
+// TypeKeys queues keystrokes to be typed one after the other, each one being the keyboard addresses
+// of the keys pressed together.
+func (m *Machine) TypeKeys(strokes [][]uint8) {
+	m.keyQueue.Type(strokes...)
+}
+
+// Typing reports whether there are queued keystrokes not typed yet.
+func (m *Machine) Typing() bool {
+	return !m.keyQueue.Empty()
+}
+
+// SetJoysticks sets the switches of the two joysticks currently closed, from the start of the next
+// frame.
+func (m *Machine) SetJoysticks(joysticks [2]primo.Joystick) {
+	m.joysticks = joysticks
+}
+
+// SetResetButton presses or releases the reset button, which does a soft reset, from the start of
+// the next frame.
+func (m *Machine) SetResetButton(pressed bool) {
+	m.reset = pressed
+}
+
+// ChangeTape inserts a PTP file into the tape player.
+func (m *Machine) ChangeTape(data []byte) {
+	m.inputEvent(primo.MovieEvent{Type: primo.MovieEventTape, Tape: data})
+}
+
+// Tape returns the PTP file in the tape player, or nil if the tape is a recording of the signal.
+func (m *Machine) Tape() []byte {
+	return m.tape.Tape()
+}
+
+// ChangeTapeSignal inserts a tape recording, which can only be loaded by following the signal.
+func (m *Machine) ChangeTapeSignal(pulses []time.Duration) {
+	m.inputEvent(primo.MovieEvent{Type: primo.MovieEventTape, Pulses: pulses})
+}
+
+// RecordedTape returns everything saved by the machine since the last ClearRecordedTape call in the
+// PTP format, or nil if nothing was saved.
+func (m *Machine) RecordedTape() []byte {
+	if m.recorder.Empty() {
+		return nil
+	}
+	return m.recorder.PTP()
+}
+
+func (m *Machine) ClearRecordedTape() {
+	m.recorder.Reset()
+}
+
+// LoadPRI writes a PRI file into the memory, as soon as the ROM has initialized the RAM.
+func (m *Machine) LoadPRI(pri *primo.PRIFile) {
+	m.inputEvent(primo.MovieEvent{Type: primo.MovieEventPRI, PRI: pri.Data()})
+}
+
+// Snapshot captures the whole state of the machine.
+func (m *Machine) Snapshot() *primo.Snapshot {
+	s := primo.TakeSnapshot(m.cpu, m.memory, m.io, m.tape, m.signal, m.recorder, m.keyQueue, m.ramInitialized)
+	s.FrameCycle = m.frameCycle
+	s.InitFrames = m.initFrames
+	s.TapeActive = m.tapeActive
+	s.TapeIdle = m.tapeIdle
+	if m.pendingPRI != nil {
+		s.PendingPRI = m.pendingPRI.Data()
+	}
+	return s
+}
+
+// LoadSnapshot replaces the whole machine with the one stored in the snapshot, including the tape.
+// The snapshot has to be taken with the current ROM or one of the built-in ones.
+func (m *Machine) LoadSnapshot(snapshot *primo.Snapshot) error {
+	m.stateReplaced()
+	return m.restoreSnapshot(snapshot)
+}
+
+func (m *Machine) restoreSnapshot(snapshot *primo.Snapshot) error {
+	rom := m.memory.ROM()
+	if !snapshot.MatchesROM(rom) {
+		rom = primo.BuiltInROM(snapshot.ROMType)
+	}
+	if !snapshot.MatchesROM(rom) {
+		return fmt.Errorf("%w: saved with a different ROM image", primo.ErrInvalidSnapshot)
+	}
+
+	mem := primo.NewMemory(rom, snapshot.RAMSize)
+	err := snapshot.Restore(mem, m.tape, m.signal, m.recorder, m.keyQueue)
+	if err != nil {
+		return fmt.Errorf("cannot restore memory: %w", err)
+	}
+	var pendingPRI *primo.PRIFile
+	if snapshot.PendingPRI != nil {
+		pendingPRI, err = primo.ParsePRI(snapshot.PendingPRI)
+		if err != nil {
+			return fmt.Errorf("cannot restore the PRI file waiting to be loaded: %w", err)
+		}
+	}
+
+	io := snapshot.IO
+	m.memory = mem
+	m.io = &io
+	m.buildCPU()
+	m.cpu.States = snapshot.CPU
+	m.cpu.LastOpCycles = snapshot.LastOpCycles
+	m.ramInitialized = snapshot.RAMInitialized
+	m.frameCycle = snapshot.FrameCycle
+	m.initFrames = snapshot.InitFrames
+	m.tapeActive = snapshot.TapeActive
+	m.tapeIdle = snapshot.TapeIdle
+	m.pendingPRI = pendingPRI
+	m.video.Restart()
+	return nil
+}
+
+func (m *Machine) cyclesPerFrame() int {
+	return int(m.ClockSpeed) / FrameRate
+}
+
+// RunCycles executes instructions until at least the given number of CPU cycles pass, or the
+// debugger stops the machine, and returns the number of cycles actually executed.
+func (m *Machine) RunCycles(n int) int {
+	executed := 0
+	for executed < n && m.debuggedStep() {
+		executed += m.cpu.LastOpCycles
+	}
+	return executed
+}
+
+// RunFrame executes instructions until the end of the current frame, or until the debugger stops
+// the machine, and returns the number of CPU cycles executed.
+func (m *Machine) RunFrame() int {
+	return m.RunCycles(m.cyclesPerFrame() - m.frameCycle)
+}
+
+// RunFrameUntil executes instructions until the end of the current frame, or until the condition
+// holds after an instruction. It returns the number of CPU cycles executed, and whether it stopped
+// because of the condition. It also stops when the debugger stops the machine.
+func (m *Machine) RunFrameUntil(condition func() bool) (int, bool) {
+	executed := 0
+	for m.debuggedStep() {
+		executed += m.cpu.LastOpCycles
+		if condition() {
+			return executed, true
+		}
+		if m.frameCycle == 0 {
+			break
+		}
+	}
+	return executed, false
+}
+
+// beamLine returns the scanline the display is currently drawing.
+func (m *Machine) beamLine() int {
+	return primo.BeamLine(m.frameCycle, m.cyclesPerFrame())
+}
+
+// startFrame starts the periodic NMI, which drives the keyboard handling and the clock of the ROM,
+// and applies the inputs of the frame.
+func (m *Machine) startFrame() {
+	m.playMovieEvents()
+	if m.ramInitialized {
+		m.io.NMINext = true
+	}
+
+	m.io.Keys = m.keys
+	m.io.Joysticks = m.joysticks
+	m.io.Reset = m.reset
+	m.loadPendingPRI()
+	m.typeQueuedKeys()
+	m.playMovieInputs()
+	m.recordMovieInputs()
+}
+
+// typeQueuedKeys presses the keys of the queued keystrokes, once the ROM is ready to read them
+// after booting.
+func (m *Machine) typeQueuedKeys() {
+	if m.ramInitialized && m.initFrames < keyboardReadyFrames {
+		m.initFrames++
+	}
+	if m.initFrames < keyboardReadyFrames {
+		return
+	}
+
+	m.io.TypedKeys = m.keyQueue.Keys()
+	m.keyQueue.Advance()
+}
+
+// debuggedStep executes a single instruction unless the debugger stops the machine before it, and
+// returns whether it was executed.
+func (m *Machine) debuggedStep() bool {
+	if !m.debugger.beforeStep() {
+		return false
+	}
+	m.step()
+	m.debugger.afterStep()
+	return true
+}
+
+// step executes a single instruction, along with everything that has to happen around it.
+func (m *Machine) step() {
+	if m.frameCycle == 0 {
+		m.startFrame()
+	}
+
+	// the frame starts with the vertical blanking, the screen is fetched line by line after it
+	line := m.beamLine()
+	m.io.VBlank = primo.InVBlank(line)
+	m.video.Update(m.memory, m.io, line)
+
+	// INIT subroutine is called
+	if m.atROMLabel(primo.ROMLabelINIT, 0) {
+		m.ramInitialized = true
+	}
+
+	if m.FastTape && m.canPatchPTPLoad() {
+		m.patchPTPLoad()
+	} else {
+		m.updateTapeSignal()
+	}
+	m.io.AdvanceJoysticks(m.cpu.LastOpCycles, int(m.ClockSpeed))
+	m.patchPTPSave()
+	m.patchStuckNMIHandler()
+	m.patchStuckNMIFlag()
+	m.sampleAudio()
+
+	m.debugger.markFetches()
+	m.tracer.beforeInstruction()
+	m.profiler.beforeInstruction()
+	m.cpu.Step()
+	m.tracer.afterInstruction()
+	m.profiler.afterInstruction()
+
+	m.frameCycle += m.cpu.LastOpCycles
+	if m.frameCycle >= m.cyclesPerFrame() {
+		m.frameCycle = 0
+		m.video.EndFrame(m.memory, m.io)
+		m.endTapeActivityFrame()
+		m.endMovieFrame()
+		m.writes.endFrame()
+	}
+}
+
+// nmiAccepted reports whether the CPU accepts the NMI in the next step, instead of executing the
+// instruction at PC.
+func (m *Machine) nmiAccepted() bool {
+	return !m.cpu.InNMI && m.io.NMIEnabled && m.io.NMINext
+}
+
+// endTapeActivityFrame counts the frames since the tape was last read.
+func (m *Machine) endTapeActivityFrame() {
+	if m.tapeActive {
+		m.tapeIdle = 0
+	} else {
+		m.tapeIdle = min(m.tapeIdle+1, tapeIdleFrames)
+	}
+	m.tapeActive = false
+}
+
+// TapeLoading reports whether a program is being loaded from the tape, either by the patched ROM
+// routines reading the PTP file, or by the tape signal playing with the motor running.
+func (m *Machine) TapeLoading() bool {
+	return m.tapeIdle < tapeIdleFrames
+}
+
+// TapePosition tells how far the tape has been read.
+type TapePosition struct {
+	// offset of the next byte of the PTP file read by fast loading, and the length of the file,
+	// which is zero for WAV recordings
+	Byte   int
+	Length int
+	// time played from the tape signal by real signal loading, and the length of the signal
+	Played   time.Duration
+	Duration time.Duration
+}
+
+func (m *Machine) TapePosition() TapePosition {
+	var pos TapePosition
+	pos.Byte, pos.Length = m.tape.Position()
+	pos.Played, pos.Duration = m.signal.Position()
+	return pos
+}
+
+// loadPendingPRI writes the last opened PRI file into the memory and jumps to its autostart
+// address. Loading is delayed until the ROM has initialized the RAM, otherwise the program would
+// just be wiped.
+func (m *Machine) loadPendingPRI() {
+	if m.pendingPRI == nil || !m.ramInitialized {
+		return
+	}
+
+	m.pendingPRI.Load(m.memory)
+	if address, ok := m.pendingPRI.Autostart(); ok {
+		m.cpu.InNMI = false // we might be jumping out of the NMI handler
+		m.cpu.PC = address
+	}
+	m.pendingPRI = nil
+}
+
+// updateTapeSignal moves the tape forward while the tape recorder's motor is running, and feeds
+// its signal to the cassette input, for loading without patching the ROM.
+func (m *Machine) updateTapeSignal() {
+	if m.io.TapeMotor {
+		m.tapeActive = m.tapeActive || m.signal.Playing()
+		m.signal.Advance(m.cpu.LastOpCycles, int(m.ClockSpeed))
+	}
+	m.io.TapeIn = m.signal.Level()
+}
+
+// sampleAudio passes the time of the last instruction to the speaker, and the level it has left
+// the speaker output at.
+func (m *Machine) sampleAudio() {
+	if m.SampleRate == 0 {
+		return
+	}
+
+	m.speaker.Advance(m.cpu.LastOpCycles, int(m.ClockSpeed), m.SampleRate)
+	m.speaker.Set(m.io.Speaker)
+}
+
+// AudioSamples returns the 16bit PCM samples of the speaker rendered since the last call.
+func (m *Machine) AudioSamples() []int16 {
+	return m.speaker.Samples()
+}
+
+// Screen returns the last frame displayed by the machine. The image is reused, so it's only valid
+// until the next frame is finished.
+func (m *Machine) Screen() *image.RGBA {
+	return m.video.Screen()
+}
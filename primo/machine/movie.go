@@ -0,0 +1,251 @@
+package machine
+
+import (
+	"fmt"
+
+	"golang.org/x/exp/slices"
+
+	"primgo/primo"
+)
+
+// MoviePlayback tells how the playback of a movie went so far.
+type MoviePlayback struct {
+	Playing bool
+	Frame   int
+	Frames  int
+	// number of frames ending in a different state than the recording, and the first one of them,
+	// which is -1 if the playback hasn't diverged
+	Divergences     int
+	FirstDivergence int
+}
+
+type moviePlayer struct {
+	movie    *primo.Movie
+	event    int
+	progress MoviePlayback
+}
+
+// movieRecording is the movie being recorded, it stops taking new frames when the ROM is changed
+// or a snapshot is loaded, as those can't be replayed.
+type movieRecording struct {
+	movie   *primo.Movie
+	stopped bool
+	// the inputs the current frame started with, the frame is added to the movie when it ends
+	frame primo.MovieFrame
+}
+
+// RecordMovie starts recording the inputs of the machine frame by frame, either after a power-on
+// with the current ROM and tape, or from the current state.
+func (m *Machine) RecordMovie(fromPowerOn bool) {
+	movie := &primo.Movie{
+		ROMType:        m.memory.ROMType,
+		ROMFingerprint: m.memory.ROM().Fingerprint,
+		RAMSize:        m.memory.RAMSize,
+	}
+
+	m.player = nil
+	if fromPowerOn {
+		tape := primo.MovieEvent{Type: primo.MovieEventTape, Tape: m.tape.Tape()}
+		if tape.Tape == nil {
+			tape.Pulses = m.signal.Pulses()
+		}
+		m.powerOn(m.memory.ROM(), m.memory.RAMSize)
+		m.applyMovieEvent(tape)
+		movie.Events = append(movie.Events, tape)
+	} else {
+		// the machine is restored from the snapshot too, so the recording and the playback both
+		// start from exactly the same state
+		movie.Snapshot = m.Snapshot()
+		_ = m.restoreSnapshot(movie.Snapshot)
+	}
+	m.recording = &movieRecording{movie: movie}
+	m.recordMovieInputs()
+}
+
+// StopMovieRecording finishes the movie being recorded and returns it, or nil if no movie was being
+// recorded.
+func (m *Machine) StopMovieRecording() *primo.Movie {
+	if m.recording == nil {
+		return nil
+	}
+	movie := m.recording.movie
+	m.recording = nil
+	return movie
+}
+
+// PlayMovie restores the state the movie was started from, and replays its inputs instead of the
+// ones set on the machine until the movie ends. The movie has to be recorded with the current ROM
+// or one of the built-in ones.
+func (m *Machine) PlayMovie(movie *primo.Movie) error {
+	rom := m.memory.ROM()
+	if !movie.MatchesROM(rom) {
+		rom = primo.BuiltInROM(movie.ROMType)
+	}
+	if !movie.MatchesROM(rom) {
+		return fmt.Errorf("%w: recorded with a different ROM image", primo.ErrInvalidMovie)
+	}
+
+	if movie.Snapshot != nil {
+		if err := m.restoreSnapshot(movie.Snapshot); err != nil {
+			return fmt.Errorf("cannot restore starting state: %w", err)
+		}
+	} else {
+		m.powerOn(rom, movie.RAMSize)
+	}
+
+	m.recording = nil
+	m.player = &moviePlayer{
+		movie: movie,
+		progress: MoviePlayback{
+			Playing:         len(movie.Frames) > 0,
+			Frames:          len(movie.Frames),
+			FirstDivergence: -1,
+		},
+	}
+	return nil
+}
+
+// MoviePlayback returns the progress of the last movie played.
+func (m *Machine) MoviePlayback() MoviePlayback {
+	if m.player == nil {
+		return MoviePlayback{FirstDivergence: -1}
+	}
+	return m.player.progress
+}
+
+// MovieRecording reports whether a movie is being recorded.
+func (m *Machine) MovieRecording() bool {
+	return m.recording != nil
+}
+
+// powerOn replaces the memory and resets the machine at the start of a frame, like turning it off
+// and on again.
+func (m *Machine) powerOn(rom *primo.ROM, ramSize primo.RAMSize) {
+	m.memory = primo.NewMemory(rom, ramSize)
+	m.hardReset()
+	m.frameCycle = 0
+	m.pendingPRI = nil
+	m.video.Restart()
+}
+
+// inputEvent applies something done to the machine from the outside. It's recorded into the movie
+// being recorded, and it ends the playback of a movie, as the machine doesn't follow it anymore.
+func (m *Machine) inputEvent(event primo.MovieEvent) {
+	m.player.stop()
+	if m.recording != nil && !m.recording.stopped {
+		event.Frame = len(m.recording.movie.Frames)
+		m.recording.movie.Events = append(m.recording.movie.Events, event)
+	}
+	m.applyMovieEvent(event)
+}
+
+// stateReplaced ends both the recording and the playback of a movie, when the ROM is changed or a
+// snapshot is loaded.
+func (m *Machine) stateReplaced() {
+	m.player.stop()
+	if m.recording != nil {
+		m.recording.stopped = true
+	}
+}
+
+func (m *Machine) applyMovieEvent(event primo.MovieEvent) {
+	switch event.Type {
+	case primo.MovieEventTape:
+		pulses := event.Pulses
+		if pulses == nil {
+			pulses = primo.RenderPTP(event.Tape)
+		}
+		m.tape.ChangeTape(event.Tape)
+		m.signal.ChangePulses(pulses)
+	case primo.MovieEventPRI:
+		if pri, err := primo.ParsePRI(event.PRI); err == nil {
+			m.pendingPRI = pri
+		}
+	case primo.MovieEventHardReset:
+		m.hardReset()
+	}
+}
+
+// playMovieEvents applies the events of the movie being played that happened before the current
+// frame.
+func (m *Machine) playMovieEvents() {
+	p := m.player
+	if p == nil || !p.progress.Playing {
+		return
+	}
+
+	for ; p.event < len(p.movie.Events) && p.movie.Events[p.event].Frame <= p.progress.Frame; p.event++ {
+		m.applyMovieEvent(p.movie.Events[p.event])
+	}
+}
+
+// playMovieInputs replaces the inputs of the machine with the ones recorded for the current frame.
+func (m *Machine) playMovieInputs() {
+	p := m.player
+	if p == nil || !p.progress.Playing {
+		return
+	}
+
+	frame := p.movie.Frames[p.progress.Frame]
+	m.io.Keys = frame.Keys
+	m.io.TypedKeys = nil
+	m.io.Joysticks = frame.Joysticks
+	m.io.Reset = frame.Reset
+	m.ClockSpeed = ClockSpeed(frame.ClockSpeed)
+	m.FastTape = frame.FastTape
+}
+
+// recordMovieInputs remembers the inputs of the machine for the frame being recorded. It's called
+// when a frame starts, so the inputs changing during the frame only affect the next one, both when
+// recording and when playing the movie.
+func (m *Machine) recordMovieInputs() {
+	if m.recording == nil || m.recording.stopped {
+		return
+	}
+
+	keys := slices.Clone(m.io.Keys)
+	for _, key := range m.io.TypedKeys {
+		if !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	m.recording.frame = primo.MovieFrame{
+		Keys:       keys,
+		Joysticks:  m.io.Joysticks,
+		Reset:      m.io.Reset,
+		ClockSpeed: int(m.ClockSpeed),
+		FastTape:   m.FastTape,
+	}
+}
+
+// endMovieFrame records the frame just finished along with the state it left the machine in, or
+// compares the state with the recorded one when playing a movie.
+func (m *Machine) endMovieFrame() {
+	if r := m.recording; r != nil && !r.stopped {
+		frame := r.frame
+		frame.Hash = primo.StateHash(m.cpu.States, m.memory)
+		r.movie.Frames = append(r.movie.Frames, frame)
+	}
+
+	if p := m.player; p != nil && p.progress.Playing {
+		p.compareFrame(primo.StateHash(m.cpu.States, m.memory))
+	}
+}
+
+func (p *moviePlayer) compareFrame(hash uint32) {
+	if hash != p.movie.Frames[p.progress.Frame].Hash {
+		if p.progress.Divergences == 0 {
+			p.progress.FirstDivergence = p.progress.Frame
+		}
+		p.progress.Divergences++
+	}
+
+	p.progress.Frame++
+	p.progress.Playing = p.progress.Frame < len(p.movie.Frames)
+}
+
+func (p *moviePlayer) stop() {
+	if p != nil {
+		p.progress.Playing = false
+	}
+}
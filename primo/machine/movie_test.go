@@ -0,0 +1,42 @@
+package machine_test
+
+import (
+	"testing"
+
+	"primgo/primo"
+	"primgo/primo/machine"
+)
+
+func TestMovieReplaysKeysChangedDuringFrame(t *testing.T) {
+	const frames = 200
+	halfFrame := int(machine.DefaultClockSpeed) / machine.FrameRate / 2
+
+	m := machine.New(primo.BuiltInROM(primo.ROMTypeA), primo.RAMSize48K)
+	m.RecordMovie(true)
+	for frame := 0; frame < frames; frame++ {
+		m.RunCycles(halfFrame)
+		// type a few letters once the ROM has booted, pressing and releasing the keys mid-frame
+		switch {
+		case frame >= 100 && frame%20 == 0:
+			m.SetKeys([]uint8{primo.KeyA + uint8(frame%3)})
+		case frame >= 100 && frame%20 == 10:
+			m.SetKeys(nil)
+		}
+		m.RunFrame()
+	}
+
+	movie := m.StopMovieRecording()
+	if len(movie.Frames) != frames {
+		t.Fatalf("recorded %d frames, want %d", len(movie.Frames), frames)
+	}
+	if err := m.PlayMovie(movie); err != nil {
+		t.Fatalf("PlayMovie() error = %v", err)
+	}
+	for m.MoviePlayback().Playing {
+		m.RunFrame()
+	}
+	if playback := m.MoviePlayback(); playback.Divergences != 0 {
+		t.Errorf("playback diverged in %d frames, first in frame %d", playback.Divergences,
+			playback.FirstDivergence)
+	}
+}
@@ -0,0 +1,99 @@
+package machine
+
+import (
+	"primgo/primo"
+)
+
+// patchPTPLoad applies runtime ROM patches to load data from a PTP file instead of the tape
+// recorder IO ports.
+func (m *Machine) patchPTPLoad() {
+	// skip sync reading in RDSYN subroutine
+	if m.atROMLabel(primo.ROMLabelRDSYN, 0) {
+		m.tapeActive = true
+		m.cpu.PC += 8
+	}
+
+	// overwrite INBYTE subroutine
+	if m.atROMLabel(primo.ROMLabelINBYTE, 0) {
+		m.tapeActive = true
+		nextByte := m.tape.NextByte()        // read next byte from PTP
+		m.cpu.DE.Hi = nextByte + m.cpu.DE.Hi // store checksum in D register
+		m.cpu.AF.Hi = nextByte               // store byte in A register
+		m.cpu.PC += 13                       // jump to RET in original subroutine
+	}
+
+	// skip cassette handling in RDHEAD subroutine
+	if m.atROMLabel(primo.ROMLabelRDHEAD, 9) {
+		m.cpu.PC += 110
+	}
+}
+
+// canPatchPTPLoad reports whether every routine patched for loading PTP files was found in the ROM,
+// otherwise the tape has to be loaded by following the signal.
+func (m *Machine) canPatchPTPLoad() bool {
+	for _, label := range []primo.ROMLabel{primo.ROMLabelRDSYN, primo.ROMLabelINBYTE, primo.ROMLabelRDHEAD} {
+		if _, ok := m.memory.LookupROMLabel(label); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// patchPTPSave applies runtime ROM patches to record the data written by the ROM into a PTP file
+// instead of the tape recorder IO ports.
+func (m *Machine) patchPTPSave() {
+	// skip motor start delay and leader writing in WRHEAD subroutine
+	if m.atROMLabel(primo.ROMLabelWRHEAD, 3) {
+		m.recorder.StartFile()
+		m.cpu.PC += 27
+	}
+
+	// overwrite WRSYN subroutine, every block starts with a sync sequence
+	if m.atROMLabel(primo.ROMLabelWRSYN, 0) {
+		m.recorder.StartBlock()
+		m.returnFromSubroutine()
+	}
+
+	// overwrite OUTBYTE subroutine
+	if m.atROMLabel(primo.ROMLabelOUTBYTE, 0) {
+		m.recorder.RecordByte(m.cpu.AF.Hi) // the byte to write is in the A register
+		m.returnFromSubroutine()
+	}
+}
+
+// atROMLabel reports whether the next instruction is at the given offset from a label. Labels not
+// found in the ROM are never reached.
+func (m *Machine) atROMLabel(label primo.ROMLabel, offset uint16) bool {
+	address, ok := m.memory.LookupROMLabel(label)
+	return ok && m.cpu.PC == address+offset
+}
+
+// returnFromSubroutine does the same as executing a RET instruction.
+func (m *Machine) returnFromSubroutine() {
+	m.cpu.PC = uint16(m.memory.Get(m.cpu.SP)) | uint16(m.memory.Get(m.cpu.SP+1))<<8
+	m.cpu.SP += 2
+}
+
+// patchStuckNMIHandler works around the issue of getting the execution stuck in the NMI handlers
+// after a hard reset in the "C" version of the ROM.
+func (m *Machine) patchStuckNMIHandler() {
+	if m.memory.ROMType != primo.ROMTypeC {
+		return
+	}
+
+	if m.atROMLabel(primo.ROMLabelNMIStuck, 0) {
+		m.cpu.PC++ // skip a jump that gets us stuck
+	}
+}
+
+// patchStuckNMIFlag works around the issue of getting the CPU's InNMI flag stuck after a soft reset
+// is executed in the "A" and "B" versions of the ROM.
+func (m *Machine) patchStuckNMIFlag() {
+	if m.memory.ROMType != primo.ROMTypeA && m.memory.ROMType != primo.ROMTypeB {
+		return
+	}
+
+	if m.atROMLabel(primo.ROMLabelRESET, 0) {
+		m.cpu.InNMI = false // we have to manually reset the CPU's NMI state
+	}
+}
@@ -0,0 +1,148 @@
+package machine
+
+import (
+	"primgo/primo/profile"
+)
+
+const (
+	// the calls nested deeper than this are added to the caller's cost, so programs never returning
+	// from their calls can't use up the memory
+	maxProfileDepth = 1024
+	// accepting the NMI pushes PC and jumps to the handler, the CPU doesn't update LastOpCycles for
+	// it, so it would hold the cycles of the instruction before
+	nmiAcceptCycles = 11
+)
+
+// profileFrame is a call being executed.
+type profileFrame struct {
+	call profile.Call
+	// the stack pointer pointing to the return address, and the cycles executed before the call
+	sp     uint16
+	cycles uint64
+}
+
+// Profiler adds up the cycles executed by each instruction, and by each call until it returns. The
+// calls are followed by the CALL, RST and RET instructions and the NMI, so code manipulating the
+// return addresses on the stack is attributed to the function that called it.
+type Profiler struct {
+	machine *Machine
+	profile *profile.Profile
+	stack   []profileFrame
+
+	// the instruction being executed
+	pc     uint16
+	sp     uint16
+	opcode [2]uint8
+	nmi    bool
+}
+
+func newProfiler(m *Machine) *Profiler {
+	return &Profiler{machine: m}
+}
+
+func (m *Machine) Profiler() *Profiler {
+	return m.profiler
+}
+
+// Start starts collecting a new profile.
+func (p *Profiler) Start() {
+	p.profile = profile.New()
+	p.stack = p.stack[:0]
+}
+
+// Stop stops collecting the profile, and returns it. The calls which haven't returned yet are
+// added with the cycles executed so far.
+func (p *Profiler) Stop() *profile.Profile {
+	collected := p.profile
+	if collected == nil {
+		return nil
+	}
+
+	for len(p.stack) > 0 {
+		p.popFrame()
+	}
+	p.profile = nil
+	return collected
+}
+
+// Running reports whether a profile is being collected.
+func (p *Profiler) Running() bool {
+	return p.profile != nil
+}
+
+// function returns the function being executed.
+func (p *Profiler) function() uint16 {
+	if len(p.stack) == 0 {
+		return 0
+	}
+	return p.stack[len(p.stack)-1].call.Callee
+}
+
+func (p *Profiler) pushFrame(callee uint16) {
+	if len(p.stack) == maxProfileDepth {
+		return
+	}
+	p.stack = append(p.stack, profileFrame{
+		call:   profile.Call{Caller: profile.Location{Function: p.function(), Address: p.pc}, Callee: callee},
+		sp:     p.machine.cpu.SP,
+		cycles: p.profile.Cycles,
+	})
+}
+
+func (p *Profiler) popFrame() {
+	frame := p.stack[len(p.stack)-1]
+	p.stack = p.stack[:len(p.stack)-1]
+	p.profile.AddCall(frame.call, p.profile.Cycles-frame.cycles)
+}
+
+// beforeInstruction remembers the instruction about to be executed, or whether the NMI is accepted
+// instead.
+func (p *Profiler) beforeInstruction() {
+	if p.profile == nil {
+		return
+	}
+
+	cpu := p.machine.cpu
+	p.pc = cpu.PC
+	p.sp = cpu.SP
+	p.opcode = [2]uint8{p.machine.memory.Get(cpu.PC), p.machine.memory.Get(cpu.PC + 1)}
+	p.nmi = p.machine.nmiAccepted()
+}
+
+// afterInstruction adds the cycles of the executed instruction, and follows the calls and returns.
+func (p *Profiler) afterInstruction() {
+	if p.profile == nil {
+		return
+	}
+
+	cpu := p.machine.cpu
+	location := profile.Location{Function: p.function(), Address: p.pc}
+	switch {
+	case p.nmi:
+		p.profile.AddCycles(location, nmiAcceptCycles)
+		p.pushFrame(profile.NMIAddress)
+	case isCall(p.opcode) && cpu.SP == p.sp-2:
+		p.profile.AddInstruction(location, cpu.LastOpCycles)
+		p.pushFrame(cpu.PC)
+	default:
+		p.profile.AddInstruction(location, cpu.LastOpCycles)
+		if isReturn(p.opcode) && cpu.SP > p.sp {
+			// everything called with the stack pointer below the returned one has returned too
+			for len(p.stack) > 0 && p.stack[len(p.stack)-1].sp < cpu.SP {
+				p.popFrame()
+			}
+		}
+	}
+}
+
+// isCall reports whether the instruction is a CALL or a RST, whether conditional or not.
+func isCall(opcode [2]uint8) bool {
+	op := opcode[0]
+	return op == 0xCD || op&0xC7 == 0xC4 || op&0xC7 == 0xC7
+}
+
+// isReturn reports whether the instruction is a RET, whether conditional or not, a RETI or a RETN.
+func isReturn(opcode [2]uint8) bool {
+	op := opcode[0]
+	return op == 0xC9 || op&0xC7 == 0xC0 || (op == 0xED && opcode[1]&0xC7 == 0x45)
+}
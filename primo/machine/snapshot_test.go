@@ -0,0 +1,36 @@
+package machine_test
+
+import (
+	"bytes"
+	"testing"
+
+	"primgo/primo"
+	"primgo/primo/machine"
+)
+
+func TestSnapshotKeepsPendingPRI(t *testing.T) {
+	// a machine code block writing 0x42 to 0xC000, loaded once the ROM has initialized the RAM
+	pri, err := primo.ParsePRI([]byte{0xd9, 0x00, 0xc0, 0x01, 0x00, 0x42, 0xc9})
+	if err != nil {
+		t.Fatalf("ParsePRI() error = %v", err)
+	}
+	m := machine.New(primo.BuiltInROM(primo.ROMTypeA), primo.RAMSize48K)
+	m.LoadPRI(pri)
+	m.RunFrame()
+	snapshot := m.Snapshot()
+
+	restored := machine.New(primo.BuiltInROM(primo.ROMTypeA), primo.RAMSize48K)
+	if err := restored.LoadSnapshot(snapshot); err != nil {
+		t.Fatalf("LoadSnapshot() error = %v", err)
+	}
+	if !bytes.Equal(restored.Snapshot().Encode(), snapshot.Encode()) {
+		t.Errorf("the restored machine differs from the saved one")
+	}
+
+	for frame := 0; frame < 100; frame++ {
+		restored.RunFrame()
+	}
+	if b := restored.Memory().Get(0xc000); b != 0x42 {
+		t.Errorf("Get(0xC000) = 0x%02X, want 0x42", b)
+	}
+}
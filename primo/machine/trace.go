@@ -0,0 +1,205 @@
+package machine
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"primgo/primo/disasm"
+)
+
+const (
+	// the RAM starts right after the 16K ROM
+	ramStart = 0x4000
+	// the width of the instruction column, so the registers are aligned on every line
+	traceTextWidth = 20
+)
+
+var ErrInvalidTraceRange = errors.New("invalid trace range")
+
+// TraceRange selects the instructions to trace by their address, both ends are included.
+type TraceRange struct {
+	First uint16
+	Last  uint16
+}
+
+// ParseTraceRange reads a range of addresses given as "FIRST-LAST", or "rom" or "ram" for the
+// instructions in the ROM or in the RAM. The addresses are decimal, or hexadecimal with a 0x prefix.
+func ParseTraceRange(text string) (TraceRange, error) {
+	switch strings.ToLower(text) {
+	case "rom":
+		return TraceRange{First: 0, Last: ramStart - 1}, nil
+	case "ram":
+		return TraceRange{First: ramStart, Last: 0xFFFF}, nil
+	}
+
+	firstText, lastText, ok := strings.Cut(text, "-")
+	if !ok {
+		return TraceRange{}, fmt.Errorf("%w: %q", ErrInvalidTraceRange, text)
+	}
+	first, err := strconv.ParseUint(firstText, 0, 16)
+	if err != nil {
+		return TraceRange{}, fmt.Errorf("%w: %q", ErrInvalidTraceRange, text)
+	}
+	last, err := strconv.ParseUint(lastText, 0, 16)
+	if err != nil || last < first {
+		return TraceRange{}, fmt.Errorf("%w: %q", ErrInvalidTraceRange, text)
+	}
+	return TraceRange{First: uint16(first), Last: uint16(last)}, nil
+}
+
+func (r TraceRange) contains(address uint16) bool {
+	return address >= r.First && address <= r.Last
+}
+
+// TraceOptions select the instructions to trace, and the triggers starting and stopping the trace.
+type TraceOptions struct {
+	// Range limits the trace to the instructions in the range, every instruction is traced if it's
+	// nil.
+	Range *TraceRange
+	// Paused makes the trace wait for Toggle before writing anything.
+	Paused bool
+	// StartAt and StopAt start and stop tracing when the instruction at the address is reached.
+	// When StartAt is given, tracing waits for it.
+	StartAt *uint16
+	StopAt  *uint16
+	// Breakpoints makes the breakpoints the debugger stops at start and stop tracing alternately,
+	// tracing waits for the first one.
+	Breakpoints bool
+}
+
+// Tracer writes a line for every instruction executed by the CPU, with the cycles executed since
+// the trace was started, the address and the disassembly of the instruction, the registers before
+// executing it, and the memory writes and the IO port outputs made by it. The columns have fixed
+// widths and nothing depends on the host, so traces of different runs can be compared with diff.
+type Tracer struct {
+	machine *Machine
+	options TraceOptions
+	w       *bufio.Writer
+	err     error
+	active  bool
+	cycles  uint64
+
+	// the line of the instruction being executed, if it's traced
+	traced bool
+	line   []byte
+}
+
+func newTracer(m *Machine) *Tracer {
+	return &Tracer{machine: m}
+}
+
+func (m *Machine) Tracer() *Tracer {
+	return m.tracer
+}
+
+// Start streams the trace to w until Stop is called, replacing the trace written before.
+func (t *Tracer) Start(w io.Writer, options TraceOptions) {
+	t.w = bufio.NewWriter(w)
+	t.options = options
+	t.err = nil
+	t.cycles = 0
+	t.active = !options.Paused && options.StartAt == nil && !options.Breakpoints
+}
+
+// Stop flushes the trace, and returns the first error writing it.
+func (t *Tracer) Stop() error {
+	if t.w == nil {
+		return nil
+	}
+
+	if t.err == nil {
+		t.err = t.w.Flush()
+	}
+	t.w = nil
+	t.active = false
+	if t.err != nil {
+		return fmt.Errorf("cannot write trace: %w", t.err)
+	}
+	return nil
+}
+
+// Started reports whether a trace is being written, even if it's waiting for a trigger.
+func (t *Tracer) Started() bool {
+	return t.w != nil
+}
+
+// Active reports whether the instructions are being traced.
+func (t *Tracer) Active() bool {
+	return t.active
+}
+
+// Toggle stops tracing the instructions until it's called again, or resumes tracing them.
+func (t *Tracer) Toggle() {
+	t.active = t.w != nil && !t.active
+}
+
+// breakpointHit starts or stops tracing when the debugger stops at a breakpoint.
+func (t *Tracer) breakpointHit() {
+	if t.options.Breakpoints {
+		t.Toggle()
+	}
+}
+
+// beforeInstruction starts the line of the next instruction, or the NMI if it's accepted instead.
+func (t *Tracer) beforeInstruction() {
+	if t.w == nil {
+		return
+	}
+
+	cpu := t.machine.cpu
+	if t.options.StartAt != nil && cpu.PC == *t.options.StartAt {
+		t.active = true
+	}
+	if t.options.StopAt != nil && cpu.PC == *t.options.StopAt {
+		t.active = false
+	}
+
+	t.traced = t.active && (t.options.Range == nil || t.options.Range.contains(cpu.PC))
+	if !t.traced {
+		return
+	}
+
+	text := disasm.Decode(t.machine.memory, cpu.PC).Text
+	if t.machine.nmiAccepted() {
+		text = "NMI"
+	}
+	t.line = fmt.Appendf(t.line[:0], "%010d %04X  %-*s AF=%04X BC=%04X DE=%04X HL=%04X IX=%04X IY=%04X SP=%04X",
+		t.cycles, cpu.PC, traceTextWidth, text,
+		cpu.AF.U16(), cpu.BC.U16(), cpu.DE.U16(), cpu.HL.U16(), cpu.IX, cpu.IY, cpu.SP)
+}
+
+// access adds a memory write or an IO port output to the line of the instruction making it.
+func (t *Tracer) access(wt WatchType, address uint16, value uint8) {
+	if !t.traced {
+		return
+	}
+
+	switch wt {
+	case WatchWrite:
+		t.line = fmt.Appendf(t.line, " [%04X]=%02X", address, value)
+	case WatchOut:
+		t.line = fmt.Appendf(t.line, " OUT(%02X)=%02X", address&0xFF, value)
+	}
+}
+
+// afterInstruction writes the line of the executed instruction.
+func (t *Tracer) afterInstruction() {
+	if t.w == nil {
+		return
+	}
+
+	t.cycles += uint64(t.machine.cpu.LastOpCycles)
+	if !t.traced {
+		return
+	}
+	t.traced = false
+
+	t.line = append(t.line, '\n')
+	if _, err := t.w.Write(t.line); err != nil && t.err == nil {
+		t.err = err
+	}
+}
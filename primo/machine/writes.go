@@ -0,0 +1,30 @@
+package machine
+
+// writeHistory remembers the frame each address was last written by the CPU in. The frames are
+// counted from 1, so 0 means the address wasn't written yet.
+type writeHistory struct {
+	frame  uint32
+	frames [0x10000]uint32
+}
+
+func newWriteHistory() *writeHistory {
+	return &writeHistory{frame: 1}
+}
+
+func (w *writeHistory) write(address uint16) {
+	w.frames[address] = w.frame
+}
+
+func (w *writeHistory) endFrame() {
+	w.frame++
+}
+
+// FramesSinceWrite returns the number of frames finished since the CPU last wrote the address, 0
+// for the current frame, or false if it wasn't written since the machine was created.
+func (m *Machine) FramesSinceWrite(address uint16) (int, bool) {
+	frame := m.writes.frames[address]
+	if frame == 0 {
+		return 0, false
+	}
+	return int(m.writes.frame - frame), true
+}
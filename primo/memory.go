@@ -1,10 +1,10 @@
 package primo
 
 import (
+	"fmt"
 	"image"
 	"image/color"
-
-	"primgo/primo/roms"
+	"strings"
 )
 
 type ROMType string
@@ -23,6 +23,30 @@ func (r ROMType) Validate() bool {
 	}[r]
 }
 
+// RAMSize is the amount of RAM installed in kilobytes. The RAM always starts right after the 16K
+// ROM, and the screen pages are placed at its top.
+type RAMSize int
+
+const (
+	RAMSize16K RAMSize = 16
+	RAMSize32K RAMSize = 32
+	RAMSize48K RAMSize = 48
+)
+
+func (r RAMSize) Validate() bool {
+	return map[RAMSize]bool{
+		RAMSize16K: true,
+		RAMSize32K: true,
+		RAMSize48K: true,
+	}[r]
+}
+
+// ModelName returns the name the machine was sold under, which includes the size of the ROM too,
+// like A64 for the "A" version with 48K RAM.
+func ModelName(romType ROMType, ramSize RAMSize) string {
+	return fmt.Sprintf("%s%d", strings.ToUpper(string(romType)), romSize+int(ramSize))
+}
+
 type ROMLabel string
 
 const (
@@ -33,6 +57,18 @@ const (
 	ROMLabelINIT     ROMLabel = "init"
 	ROMLabelRESET    ROMLabel = "reset"
 	ROMLabelNMIStuck ROMLabel = "nmi_stuck"
+	ROMLabelOUTBYTE  ROMLabel = "outbyte"
+	ROMLabelWRHEAD   ROMLabel = "wrhead"
+	ROMLabelWRSYN    ROMLabel = "wrsyn"
+	ROMLabelTXTTAB   ROMLabel = "txttab"
+	ROMLabelVARTAB   ROMLabel = "vartab"
+)
+
+const (
+	// romSize is the size of the ROM in kilobytes
+	romSize = 16
+	// unpopulatedData is read from addresses without any RAM or ROM behind them
+	unpopulatedData = 0xFF
 )
 
 type ScreenPage string
@@ -42,22 +78,10 @@ const (
 	ScreenPageSecondary ScreenPage = "secondary"
 )
 
-func (s ScreenPage) StartAddress() uint16 {
-	switch s {
-	case ScreenPagePrimary:
-		return 0xE000
-	case ScreenPageSecondary:
-		return 0xC000
-	}
-	return 0
-}
-
-func (s ScreenPage) EndAddress() uint16 {
-	switch s {
-	case ScreenPagePrimary:
-		return 0xFFFF
-	case ScreenPageSecondary:
-		return 0xDFFF
+// endOffset returns the distance of the last byte of the screen page from the top of the RAM.
+func (s ScreenPage) endOffset() uint16 {
+	if s == ScreenPageSecondary {
+		return 0x2000
 	}
 	return 0
 }
@@ -83,57 +107,109 @@ func (c coloringMode) size() image.Point {
 }
 
 type Memory struct {
-	ROMType      ROMType
-	data         [0x10000]byte
-	protected    uint16
-	romLabelAdrs map[ROMLabel]map[ROMType]uint16
+	ROMType   ROMType
+	RAMSize   RAMSize
+	rom       *ROM
+	data      [0x10000]byte
+	protected uint16
+	ramEnd    int
 }
 
-func NewMemory(romType ROMType) *Memory {
-	var romData []byte
-	switch romType {
-	case ROMTypeA:
-		romData = roms.A64
-	case ROMTypeB:
-		romData = roms.B64
-	case ROMTypeC:
-		romData = roms.C64
-	}
-
+func NewMemory(rom *ROM, ramSize RAMSize) *Memory {
 	mem := &Memory{
-		ROMType:   romType,
-		protected: uint16(len(romData)),
-		romLabelAdrs: map[ROMLabel]map[ROMType]uint16{
-			ROMLabelINBYTE:   {ROMTypeA: 0x3CAB, ROMTypeB: 0x3CAB, ROMTypeC: 0x0DCC},
-			ROMLabelRDHEAD:   {ROMTypeA: 0x3B36, ROMTypeB: 0x3B36, ROMTypeC: 0x0C58},
-			ROMLabelRDSYN:    {ROMTypeA: 0x3C75, ROMTypeB: 0x3C75, ROMTypeC: 0x0D96},
-			ROMLabelGOMBM:    {ROMTypeA: 0x3921, ROMTypeB: 0x3921},
-			ROMLabelINIT:     {ROMTypeA: 0x3178, ROMTypeB: 0x3178, ROMTypeC: 0x00C9},
-			ROMLabelRESET:    {ROMTypeA: 0x316A, ROMTypeB: 0x316A},
-			ROMLabelNMIStuck: {ROMTypeC: 0x3e7f},
-		},
+		ROMType:   rom.Type,
+		RAMSize:   ramSize,
+		rom:       rom,
+		protected: uint16(len(rom.data)),
+		ramEnd:    (romSize + int(ramSize)) * 1024,
 	}
-	copy(mem.data[:], romData)
+	copy(mem.data[:], rom.data)
 
 	// patch GOMBM subroutine to reduce the num of repeated reads needed to register a keypress
-	if romType != ROMTypeC {
-		mem.data[mem.ROMLabelAddress(ROMLabelGOMBM)+3] = 48
+	if address, ok := mem.LookupROMLabel(ROMLabelGOMBM); ok {
+		mem.data[address+3] = 48
 	}
 
+	mem.patchRAMTop()
+
 	return mem
 }
 
+// patchRAMTop adjusts the ROM for the installed RAM. The images are dumped from machines with 48K
+// RAM, while the ROMs of the smaller models only differ in the high bytes of the addresses
+// pointing to the top of the RAM, where the screen pages are placed. Other images are only
+// patched if they still have the original values at these addresses, otherwise they are expected
+// to be made for the selected RAM size.
+func (m *Memory) patchRAMTop() {
+	addresses := map[ROMType][]uint16{
+		ROMTypeA: {0x0014, 0x3124, 0x3131, 0x314B, 0x3198, 0x31F5},
+		ROMTypeB: {0x0014, 0x3124, 0x3131, 0x314B, 0x3198, 0x31F5},
+		ROMTypeC: {
+			0x000C, 0x00A9, 0x00DE, 0x00FD, 0x0579, 0x05AB, 0x06F0, 0x07AC,
+			0x0880, 0x0883, 0x088F, 0x0892, 0x08BB, 0x08BE, 0x08D2, 0x08D5,
+		},
+	}[m.ROMType]
+	if !m.rom.sameLayout(BuiltInROM(m.ROMType), addresses) {
+		return
+	}
+
+	missing := uint8((RAMSize48K - m.RAMSize) * 1024 >> 8)
+	for _, address := range addresses {
+		m.data[address] -= missing
+	}
+}
+
+// ROM returns the ROM image the memory was created with, without any patches applied.
+func (m *Memory) ROM() *ROM {
+	return m.rom
+}
+
 func (m *Memory) Get(address uint16) uint8 {
+	if int(address) >= m.ramEnd {
+		return unpopulatedData
+	}
 	return m.data[address]
 }
 
 func (m *Memory) Set(address uint16, b uint8) {
-	if address < m.protected {
+	if address < m.protected || int(address) >= m.ramEnd {
 		return
 	}
 	m.data[address] = b
 }
 
+// InROM reports whether the address is in the ROM, where the writes are ignored.
+func (m *Memory) InROM(address uint16) bool {
+	return address < m.protected
+}
+
+// Populated reports whether there's RAM or ROM at the address, the other addresses always read
+// 0xFF.
+func (m *Memory) Populated(address uint16) bool {
+	return int(address) < m.ramEnd
+}
+
+// ScreenEndAddress returns the address of the last byte of the screen page, the pages are placed
+// at the top of the RAM.
+func (m *Memory) ScreenEndAddress(screenPage ScreenPage) uint16 {
+	return uint16(m.ramEnd-1) - screenPage.endOffset()
+}
+
+// ScreenStartAddress returns the address of the first byte of the 8K screen page, which also
+// contains the color information in the "C" version.
+func (m *Memory) ScreenStartAddress(screenPage ScreenPage) uint16 {
+	return m.ScreenEndAddress(screenPage) - 0x1FFF
+}
+
+func (m *Memory) getWord(address uint16) uint16 {
+	return uint16(m.Get(address)) | uint16(m.Get(address+1))<<8
+}
+
+func (m *Memory) setWord(address, w uint16) {
+	m.Set(address, byte(w))
+	m.Set(address+1, byte(w>>8))
+}
+
 // decodeRGB will convert from the 1 byte Primo RGB information to 4 byte RGBA.
 func decodeRGB(v uint8) color.RGBA {
 	const redBitmask = 0xe0
@@ -149,7 +225,7 @@ func decodeRGB(v uint8) color.RGBA {
 }
 
 func (m *Memory) coloringMode(screenPage ScreenPage) coloringMode {
-	return coloringMode(m.Get(screenPage.StartAddress()))
+	return coloringMode(m.Get(m.ScreenStartAddress(screenPage)))
 }
 
 func (m *Memory) activePalette(screenPage ScreenPage) uint16 {
@@ -157,7 +233,7 @@ func (m *Memory) activePalette(screenPage ScreenPage) uint16 {
 	const palette2Bitmask = 0x02
 	const palette3Bitmask = 0x04
 
-	paletteIndex := m.Get(screenPage.StartAddress() + 1)
+	paletteIndex := m.Get(m.ScreenStartAddress(screenPage) + 1)
 	if paletteIndex&palette1Bitmask != 0 {
 		return 1
 	}
@@ -195,7 +271,7 @@ func (m *Memory) monochromeColors(on bool) color.RGBA {
 
 func (m *Memory) pixelColorIndex(screenPage ScreenPage, row, col int) uint16 {
 	chunkSize := m.coloringMode(screenPage).size()
-	start := screenPage.StartAddress()
+	start := m.ScreenStartAddress(screenPage)
 	chunkRow := row / chunkSize.Y
 	chunkCol := col / chunkSize.X
 	useUpper4bits := chunkCol%2 == 0
@@ -226,7 +302,7 @@ func (m *Memory) pixelColor(screenPage ScreenPage, row, col int, on bool) color.
 	}
 
 	colorIndex := m.pixelColorIndex(screenPage, row, col)
-	colorAddr := screenPage.StartAddress() + m.activePalette(screenPage)*32 + colorIndex
+	colorAddr := m.ScreenStartAddress(screenPage) + m.activePalette(screenPage)*32 + colorIndex
 
 	// lower 16 bytes are the background colors, the upper 16 bytes are the foreground colors
 	if on {
@@ -240,16 +316,26 @@ func (m *Memory) GetRGBAScreenData(screenPage ScreenPage) []byte {
 	screenSize := m.ScreenResolution(screenPage)
 	pixels := make([]byte, (screenSize.X*screenSize.Y)*4)
 
-	end := int(screenPage.EndAddress())
+	for row := 0; row < screenSize.Y; row++ {
+		m.RenderScreenLine(screenPage, screenSize, row, pixels[row*screenSize.X*4:(row+1)*screenSize.X*4])
+	}
+
+	return pixels
+}
+
+// RenderScreenLine converts a single row of a screen with the given size into RGBA pixels, using
+// the current contents of the memory.
+func (m *Memory) RenderScreenLine(screenPage ScreenPage, screenSize image.Point, row int, pixels []byte) {
+	bytesPerRow := screenSize.X / 8
+	start := int(m.ScreenEndAddress(screenPage)) - bytesPerRow*screenSize.Y + 1 + row*bytesPerRow
+
 	px := 0
-	for addr := end - screenSize.X*screenSize.Y/8 + 1; addr <= end; addr++ {
+	for addr := start; addr < start+bytesPerRow; addr++ {
 		b := m.Get(uint16(addr))
 
 		// each byte contains data for 8 pixels
 		for n := 7; n >= 0; n-- {
-			row := px / screenSize.X
-			col := px - row*screenSize.X
-			pxColor := m.pixelColor(screenPage, row, col, (b>>n)&1 == 1)
+			pxColor := m.pixelColor(screenPage, row, px, (b>>n)&1 == 1)
 
 			pixels[4*px] = pxColor.R
 			pixels[4*px+1] = pxColor.G
@@ -259,10 +345,14 @@ func (m *Memory) GetRGBAScreenData(screenPage ScreenPage) []byte {
 			px++
 		}
 	}
-
-	return pixels
 }
 
 func (m *Memory) ROMLabelAddress(label ROMLabel) uint16 {
-	return m.romLabelAdrs[label][m.ROMType]
+	return m.rom.labels[label]
+}
+
+// LookupROMLabel returns the address of the label, or false if the ROM doesn't have it.
+func (m *Memory) LookupROMLabel(label ROMLabel) (uint16, bool) {
+	address, ok := m.rom.labels[label]
+	return address, ok
 }
@@ -0,0 +1,163 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+
+	"primgo/primo/disasm"
+)
+
+func (mon *Monitor) breakCommand(args []string) (string, error) {
+	address, err := mon.parseAddressArg(args)
+	if err != nil {
+		return "", err
+	}
+	mon.machine.Debugger().AddBreakpoint(address)
+	return "Breakpoint set at " + mon.formatAddress(address), nil
+}
+
+func (mon *Monitor) deleteCommand(args []string) (string, error) {
+	address, err := mon.parseAddressArg(args)
+	if err != nil {
+		return "", err
+	}
+	mon.machine.Debugger().RemoveBreakpoint(address)
+	return "Breakpoint deleted at " + mon.formatAddress(address), nil
+}
+
+func (mon *Monitor) watchCommand(args []string) (string, error) {
+	w, err := mon.parseWatchpoint(args)
+	if err != nil {
+		return "", err
+	}
+	mon.machine.Debugger().AddWatchpoint(w)
+	return "Watchpoint set on " + formatWatchpoint(w), nil
+}
+
+func (mon *Monitor) unwatchCommand(args []string) (string, error) {
+	w, err := mon.parseWatchpoint(args)
+	if err != nil {
+		return "", err
+	}
+	mon.machine.Debugger().RemoveWatchpoint(w)
+	return "Watchpoint deleted on " + formatWatchpoint(w), nil
+}
+
+func (mon *Monitor) infoCommand([]string) (string, error) {
+	d := mon.machine.Debugger()
+	var lines []string
+	for _, address := range d.Breakpoints() {
+		lines = append(lines, "Breakpoint at "+mon.formatAddress(address))
+	}
+	for _, w := range d.Watchpoints() {
+		lines = append(lines, "Watchpoint on "+formatWatchpoint(w))
+	}
+	if len(lines) == 0 {
+		return "No breakpoints or watchpoints", nil
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (mon *Monitor) continueCommand([]string) (string, error) {
+	mon.machine.Debugger().Continue()
+	return "", nil
+}
+
+func (mon *Monitor) pauseCommand([]string) (string, error) {
+	mon.machine.Debugger().Break()
+	return mon.Status(), nil
+}
+
+func (mon *Monitor) stepCommand([]string) (string, error) {
+	mon.machine.Debugger().StepInto()
+	return "", nil
+}
+
+func (mon *Monitor) nextCommand([]string) (string, error) {
+	mon.machine.Debugger().StepOver()
+	return "", nil
+}
+
+func (mon *Monitor) finishCommand([]string) (string, error) {
+	mon.machine.Debugger().StepOut()
+	return "", nil
+}
+
+func (mon *Monitor) untilCommand(args []string) (string, error) {
+	address, err := mon.parseAddressArg(args)
+	if err != nil {
+		return "", err
+	}
+	mon.machine.Debugger().RunTo(address)
+	return "", nil
+}
+
+func (mon *Monitor) regsCommand([]string) (string, error) {
+	return strings.Join(mon.Registers(), "\n"), nil
+}
+
+func (mon *Monitor) listCommand(args []string) (string, error) {
+	address := mon.machine.CPU().PC
+	if len(args) > 0 {
+		var err error
+		if address, err = mon.parseAddress(args[0]); err != nil {
+			return "", err
+		}
+	}
+	count, err := parseCount(args, 1, defaultListLength)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	symbols := mon.symbols()
+	for i := 0; i < count; i++ {
+		inst := disasm.Decode(mon.machine.Memory(), address)
+		if name, ok := symbols[address]; ok {
+			fmt.Fprintf(&sb, "%s:\n", name)
+		}
+		fmt.Fprintln(&sb, disasm.FormatLine(inst, symbols))
+		address += uint16(inst.Len())
+	}
+	return strings.TrimSuffix(sb.String(), "\n"), nil
+}
+
+func (mon *Monitor) memCommand(args []string) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("%w: expected an address", ErrInvalidCommand)
+	}
+	address, err := mon.parseAddress(args[0])
+	if err != nil {
+		return "", err
+	}
+	count, err := parseCount(args, 1, defaultDumpLength)
+	if err != nil {
+		return "", err
+	}
+
+	var lines []string
+	mem := mon.machine.Memory()
+	for start := 0; start < count; start += dumpLineLength {
+		line := fmt.Sprintf("%04X ", address)
+		for i := start; i < min(start+dumpLineLength, count); i++ {
+			line += fmt.Sprintf(" %02X", mem.Get(address))
+			address++
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (mon *Monitor) helpCommand([]string) (string, error) {
+	var lines []string
+	for _, c := range commands() {
+		usage := strings.Join(c.names, ", ")
+		if c.args != "" {
+			usage += " " + c.args
+		}
+		lines = append(lines, fmt.Sprintf("%-36s %s", usage, c.help))
+	}
+	lines = append(lines, "Addresses are hexadecimal, the names of the ROM routines, like INBYTE, or screen1 and screen2.",
+		"An empty line repeats the last command.")
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,224 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// the writes are highlighted for this many frames
+	recentWriteFrames = 50
+	// the number of matches listed by the find command
+	maxFindMatches = 16
+)
+
+var ErrNotFound = errors.New("not found")
+
+// MemoryByte is a byte shown by the memory viewer.
+type MemoryByte struct {
+	Value uint8
+	// ROM is set for the bytes of the ROM, and Unpopulated for the addresses without RAM or ROM.
+	ROM         bool
+	Unpopulated bool
+	// Heat is 1 for the bytes written by the CPU in the current frame, fading to 0 as the write
+	// gets older.
+	Heat float64
+	// Label is the name of the ROM routine starting at the byte.
+	Label string
+}
+
+// MemoryLine is a line of the memory viewer.
+type MemoryLine struct {
+	Address uint16
+	Bytes   [dumpLineLength]MemoryByte
+}
+
+// MemoryView returns the given number of lines of the memory from the address, wrapping around at
+// the end of the address space.
+func (mon *Monitor) MemoryView(address uint16, lines int) []MemoryLine {
+	mem := mon.machine.Memory()
+	symbols := mon.symbols()
+
+	view := make([]MemoryLine, lines)
+	for i := range view {
+		line := &view[i]
+		line.Address = address
+		for j := range line.Bytes {
+			line.Bytes[j] = MemoryByte{
+				Value:       mem.Get(address),
+				ROM:         mem.InROM(address),
+				Unpopulated: !mem.Populated(address),
+				Heat:        mon.writeHeat(address),
+			}
+			if mem.InROM(address) {
+				line.Bytes[j].Label = symbols[address]
+			}
+			address++
+		}
+	}
+	return view
+}
+
+func (mon *Monitor) writeHeat(address uint16) float64 {
+	frames, ok := mon.machine.FramesSinceWrite(address)
+	if !ok || frames >= recentWriteFrames {
+		return 0
+	}
+	return 1 - float64(frames)/recentWriteFrames
+}
+
+// Locate returns the address given in any form accepted by the commands.
+func (mon *Monitor) Locate(text string) (uint16, error) {
+	return mon.parseAddress(strings.TrimSpace(text))
+}
+
+// Find returns the address of the first match of the pattern from the given address, wrapping
+// around at the end of the address space. The pattern is a list of hexadecimal bytes, or a text in
+// quotes.
+func (mon *Monitor) Find(pattern string, from uint16) (uint16, error) {
+	bytes, err := parsePattern(pattern)
+	if err != nil {
+		return 0, err
+	}
+	address, ok := mon.find(bytes, from, 0x10000)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrNotFound, strings.TrimSpace(pattern))
+	}
+	return address, nil
+}
+
+// find returns the first match of the bytes in the given number of addresses from the address.
+func (mon *Monitor) find(bytes []uint8, from uint16, count int) (uint16, bool) {
+	mem := mon.machine.Memory()
+	for i := 0; i < count; i++ {
+		address := from + uint16(i)
+		matched := true
+		for j, b := range bytes {
+			if mem.Get(address+uint16(j)) != b {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return address, true
+		}
+	}
+	return 0, false
+}
+
+// parsePattern reads the bytes given as a list of hexadecimal numbers, or as a text in quotes.
+func parsePattern(text string) ([]uint8, error) {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, `"`) {
+		quoted := strings.TrimSuffix(strings.TrimPrefix(text, `"`), `"`)
+		if quoted == "" {
+			return nil, fmt.Errorf("%w: empty text", ErrInvalidCommand)
+		}
+		return []uint8(quoted), nil
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%w: expected the bytes", ErrInvalidCommand)
+	}
+	bytes := make([]uint8, 0, len(fields))
+	for _, field := range fields {
+		b, err := strconv.ParseUint(strings.TrimPrefix(field, "$"), 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid byte %q", ErrInvalidCommand, field)
+		}
+		bytes = append(bytes, uint8(b))
+	}
+	return bytes, nil
+}
+
+// checkWritable fails if any address of the range is outside of the RAM. The RAM is contiguous, so
+// only the ends of the range have to be checked.
+func (mon *Monitor) checkWritable(first, last uint16) error {
+	mem := mon.machine.Memory()
+	for _, address := range []uint16{first, last} {
+		if mem.InROM(address) || !mem.Populated(address) {
+			return fmt.Errorf("%w: $%04X is not in the RAM", ErrInvalidCommand, address)
+		}
+	}
+	return nil
+}
+
+func (mon *Monitor) pokeCommand(args []string) (string, error) {
+	if len(args) < 2 {
+		return "", fmt.Errorf("%w: expected the address and the bytes", ErrInvalidCommand)
+	}
+	address, err := mon.parseAddress(args[0])
+	if err != nil {
+		return "", err
+	}
+	bytes, err := parsePattern(strings.Join(args[1:], " "))
+	if err != nil {
+		return "", err
+	}
+	if int(address)+len(bytes) > 0x10000 {
+		return "", fmt.Errorf("%w: the bytes don't fit below $FFFF", ErrInvalidCommand)
+	}
+	if err := mon.checkWritable(address, address+uint16(len(bytes)-1)); err != nil {
+		return "", err
+	}
+
+	for i, b := range bytes {
+		mon.machine.Memory().Set(address+uint16(i), b)
+	}
+	return "", nil
+}
+
+func (mon *Monitor) fillCommand(args []string) (string, error) {
+	if len(args) != 3 {
+		return "", fmt.Errorf("%w: expected the first and the last address, and the byte", ErrInvalidCommand)
+	}
+	first, err := mon.parseAddress(args[0])
+	if err != nil {
+		return "", err
+	}
+	last, err := mon.parseAddress(args[1])
+	if err != nil {
+		return "", err
+	}
+	if last < first {
+		return "", fmt.Errorf("%w: the last address is below the first", ErrInvalidCommand)
+	}
+	b, err := parsePattern(args[2])
+	if err != nil || len(b) != 1 {
+		return "", fmt.Errorf("%w: invalid byte %q", ErrInvalidCommand, args[2])
+	}
+	if err := mon.checkWritable(first, last); err != nil {
+		return "", err
+	}
+
+	for address := int(first); address <= int(last); address++ {
+		mon.machine.Memory().Set(uint16(address), b[0])
+	}
+	return "", nil
+}
+
+// findCommand lists the addresses the bytes are found at, up to a limit.
+func (mon *Monitor) findCommand(args []string) (string, error) {
+	bytes, err := parsePattern(strings.Join(args, " "))
+	if err != nil {
+		return "", err
+	}
+
+	var lines []string
+	next := 0
+	for next < 0x10000 && len(lines) < maxFindMatches {
+		address, ok := mon.find(bytes, uint16(next), 0x10000-next)
+		if !ok {
+			break
+		}
+		lines = append(lines, "Found at "+mon.formatAddress(address))
+		next = int(address) + 1
+	}
+	if len(lines) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, strings.Join(args, " "))
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,189 @@
+// Package monitor interprets debugger commands typed by the user, like setting breakpoints and
+// stepping, and describes the state of the stopped machine. It's shared by the terminal console and
+// the debugger panel of the desktop version.
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"primgo/primo"
+	"primgo/primo/disasm"
+	"primgo/primo/machine"
+)
+
+const (
+	defaultListLength = 16
+	defaultDumpLength = 64
+	dumpLineLength    = 16
+)
+
+var ErrInvalidCommand = errors.New("invalid command")
+
+type Monitor struct {
+	machine *machine.Machine
+	// the last command, which is repeated by an empty line
+	last string
+}
+
+func New(m *machine.Machine) *Monitor {
+	return &Monitor{machine: m}
+}
+
+// command is a debugger command, with its arguments and description shown by the help command.
+type command struct {
+	names []string
+	args  string
+	help  string
+	run   func(mon *Monitor, args []string) (string, error)
+}
+
+func commands() []command {
+	return []command{
+		{[]string{"break", "b"}, "ADDR", "set a breakpoint", (*Monitor).breakCommand},
+		{[]string{"delete", "d"}, "ADDR", "delete a breakpoint", (*Monitor).deleteCommand},
+		{[]string{"watch", "w"}, "read|write|in|out ADDR", "set a watchpoint", (*Monitor).watchCommand},
+		{[]string{"unwatch", "uw"}, "read|write|in|out ADDR", "delete a watchpoint", (*Monitor).unwatchCommand},
+		{[]string{"info", "i"}, "", "list the breakpoints and watchpoints", (*Monitor).infoCommand},
+		{[]string{"continue", "c"}, "", "resume running", (*Monitor).continueCommand},
+		{[]string{"pause", "p"}, "", "stop the machine", (*Monitor).pauseCommand},
+		{[]string{"step", "s"}, "", "step into the next instruction", (*Monitor).stepCommand},
+		{[]string{"next", "n"}, "", "step over the next instruction", (*Monitor).nextCommand},
+		{[]string{"finish", "f"}, "", "step out of the current subroutine", (*Monitor).finishCommand},
+		{[]string{"until", "u"}, "ADDR", "run to the address", (*Monitor).untilCommand},
+		{[]string{"regs", "r"}, "", "show the registers", (*Monitor).regsCommand},
+		{[]string{"list", "l"}, "[ADDR] [N]", "disassemble N instructions from PC or ADDR", (*Monitor).listCommand},
+		{[]string{"mem", "m"}, "ADDR [N]", "dump N bytes of memory", (*Monitor).memCommand},
+		{[]string{"poke"}, "ADDR BYTES|\"TEXT\"", "write bytes to the memory", (*Monitor).pokeCommand},
+		{[]string{"fill"}, "FIRST LAST BYTE", "fill a range of the memory", (*Monitor).fillCommand},
+		{[]string{"find"}, "BYTES|\"TEXT\"", "find bytes in the memory", (*Monitor).findCommand},
+		{[]string{"help", "h"}, "", "show this help", (*Monitor).helpCommand},
+	}
+}
+
+// Execute runs a command line, and returns its output. An empty line repeats the last command, so
+// stepping can be continued by pressing Return.
+func (mon *Monitor) Execute(line string) (string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		line = mon.last
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	mon.last = line
+
+	name := strings.ToLower(fields[0])
+	for _, c := range commands() {
+		for _, n := range c.names {
+			if n == name {
+				return c.run(mon, fields[1:])
+			}
+		}
+	}
+	return "", fmt.Errorf("%w: unknown command %q, type help for the list of commands", ErrInvalidCommand, fields[0])
+}
+
+func (mon *Monitor) symbols() disasm.Symbols {
+	return disasm.ROMSymbols(mon.machine.Memory().ROM())
+}
+
+// parseAddress reads an address given in hexadecimal, with or without a $ or 0x prefix, by the
+// name of a ROM label, or as screen1 and screen2 for the start of the screen pages.
+func (mon *Monitor) parseAddress(text string) (uint16, error) {
+	switch strings.ToLower(text) {
+	case "screen1":
+		return mon.machine.Memory().ScreenStartAddress(primo.ScreenPagePrimary), nil
+	case "screen2":
+		return mon.machine.Memory().ScreenStartAddress(primo.ScreenPageSecondary), nil
+	}
+	for address, name := range mon.symbols() {
+		if strings.EqualFold(name, text) {
+			return address, nil
+		}
+	}
+
+	digits := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(text), "$"), "0x")
+	address, err := strconv.ParseUint(digits, 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid address %q", ErrInvalidCommand, text)
+	}
+	return uint16(address), nil
+}
+
+// parseAddressArg parses the only argument of the commands expecting an address.
+func (mon *Monitor) parseAddressArg(args []string) (uint16, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("%w: expected an address", ErrInvalidCommand)
+	}
+	return mon.parseAddress(args[0])
+}
+
+func (mon *Monitor) parseWatchpoint(args []string) (machine.Watchpoint, error) {
+	if len(args) != 2 {
+		return machine.Watchpoint{}, fmt.Errorf("%w: expected the type and the address", ErrInvalidCommand)
+	}
+
+	var w machine.Watchpoint
+	for _, t := range []machine.WatchType{machine.WatchRead, machine.WatchWrite, machine.WatchIn, machine.WatchOut} {
+		if strings.EqualFold(t.String(), args[0]) {
+			w.Type = t
+		}
+	}
+	if w.Type == 0 {
+		return w, fmt.Errorf("%w: unknown watchpoint type %q", ErrInvalidCommand, args[0])
+	}
+
+	var err error
+	w.Address, err = mon.parseAddress(args[1])
+	return w, err
+}
+
+// parseCount reads the optional number of items to show.
+func parseCount(args []string, index, defaultCount int) (int, error) {
+	if len(args) <= index {
+		return defaultCount, nil
+	}
+	count, err := strconv.Atoi(args[index])
+	if err != nil || count <= 0 {
+		return 0, fmt.Errorf("%w: invalid count %q", ErrInvalidCommand, args[index])
+	}
+	return count, nil
+}
+
+// formatAddress shows the address along with its name if it has one.
+func (mon *Monitor) formatAddress(address uint16) string {
+	if name, ok := mon.symbols()[address]; ok {
+		return fmt.Sprintf("$%04X (%s)", address, name)
+	}
+	return fmt.Sprintf("$%04X", address)
+}
+
+func formatWatchpoint(w machine.Watchpoint) string {
+	if w.Type == machine.WatchIn || w.Type == machine.WatchOut {
+		return fmt.Sprintf("%s port $%02X", w.Type, w.Address)
+	}
+	return fmt.Sprintf("%s $%04X", w.Type, w.Address)
+}
+
+// Status describes whether the machine is running, or why it was stopped.
+func (mon *Monitor) Status() string {
+	stop, stopped := mon.machine.Debugger().Stopped()
+	if !stopped {
+		return "Running"
+	}
+
+	at := mon.formatAddress(stop.PC)
+	switch stop.Reason {
+	case machine.StopBreakpoint:
+		return "Breakpoint at " + at
+	case machine.StopWatchpoint:
+		return fmt.Sprintf("Watchpoint %s = $%02X, stopped at %s", formatWatchpoint(stop.Watchpoint), stop.Value, at)
+	case machine.StopStep:
+		return "Stepped to " + at
+	}
+	return "Stopped at " + at
+}
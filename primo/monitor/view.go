@@ -0,0 +1,86 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+
+	"primgo/primo/disasm"
+)
+
+// CodeLine is an instruction in the disassembly shown by the debugger panel.
+type CodeLine struct {
+	Address    uint16
+	Label      string
+	Text       string
+	Current    bool
+	Breakpoint bool
+}
+
+// View is everything the debugger panel shows about the machine.
+type View struct {
+	Status    string
+	Registers []string
+	Code      []CodeLine
+}
+
+// View describes the state of the machine, with the given number of instructions disassembled
+// from PC.
+func (mon *Monitor) View(codeLines int) View {
+	view := View{
+		Status:    mon.Status(),
+		Registers: mon.Registers(),
+		Code:      make([]CodeLine, 0, codeLines),
+	}
+
+	symbols := mon.symbols()
+	address := mon.machine.CPU().PC
+	for i := 0; i < codeLines; i++ {
+		inst := disasm.Decode(mon.machine.Memory(), address)
+		view.Code = append(view.Code, CodeLine{
+			Address:    address,
+			Label:      symbols[address],
+			Text:       fmt.Sprintf("%04X  %s", address, symbols.Annotate(inst)),
+			Current:    i == 0,
+			Breakpoint: mon.machine.Debugger().HasBreakpoint(address),
+		})
+		address += uint16(inst.Len())
+	}
+	return view
+}
+
+// Registers shows the CPU registers and flags, a line for every pair of them.
+func (mon *Monitor) Registers() []string {
+	cpu := mon.machine.CPU()
+	alt := cpu.Alternate
+	return []string{
+		fmt.Sprintf("AF %04X   AF' %04X", cpu.AF.U16(), alt.AF.U16()),
+		fmt.Sprintf("BC %04X   BC' %04X", cpu.BC.U16(), alt.BC.U16()),
+		fmt.Sprintf("DE %04X   DE' %04X", cpu.DE.U16(), alt.DE.U16()),
+		fmt.Sprintf("HL %04X   HL' %04X", cpu.HL.U16(), alt.HL.U16()),
+		fmt.Sprintf("IX %04X   IY  %04X", cpu.IX, cpu.IY),
+		fmt.Sprintf("SP %04X   PC  %04X", cpu.SP, cpu.PC),
+		fmt.Sprintf("I  %02X     R   %02X     IM %d", cpu.IR.Hi, cpu.IR.Lo, cpu.IM),
+		fmt.Sprintf("IFF %d%d   NMI %d   HALT %d   F %s",
+			bit(cpu.IFF1), bit(cpu.IFF2), bit(cpu.InNMI), bit(cpu.HALT), flags(cpu.AF.Lo)),
+	}
+}
+
+// flags shows the letters of the flags set, and dots for the ones reset.
+func flags(f uint8) string {
+	var sb strings.Builder
+	for i, letter := range "SZ5H3PNC" {
+		if f&(0x80>>i) != 0 {
+			sb.WriteRune(letter)
+		} else {
+			sb.WriteRune('.')
+		}
+	}
+	return sb.String()
+}
+
+func bit(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
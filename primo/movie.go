@@ -0,0 +1,218 @@
+package primo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"time"
+
+	"github.com/koron-go/z80"
+)
+
+const (
+	movieMagic   = "PRIMGOMV"
+	movieVersion = 1
+
+	movieFlagReset    = 0x01
+	movieFlagFastTape = 0x02
+)
+
+var ErrInvalidMovie = errors.New("invalid movie")
+
+// MovieFrame holds the inputs of the machine during a frame, and the hash of the state it was left
+// in at the end of the frame.
+type MovieFrame struct {
+	Keys       []uint8
+	Joysticks  [2]Joystick
+	Reset      bool
+	ClockSpeed int
+	FastTape   bool
+	Hash       uint32
+}
+
+type MovieEventType uint8
+
+const (
+	MovieEventTape MovieEventType = iota + 1
+	MovieEventPRI
+	MovieEventHardReset
+)
+
+// MovieEvent is something done to the machine before the given frame started, like inserting a
+// tape. A tape event holds either a PTP file, or the pulses of a tape recording.
+type MovieEvent struct {
+	Frame  int
+	Type   MovieEventType
+	Tape   []byte
+	Pulses []time.Duration
+	PRI    []byte
+}
+
+// Movie is a recording of every input of the machine frame by frame, starting either from power-on
+// or from a snapshot, so the same run can be reproduced exactly.
+type Movie struct {
+	ROMType        ROMType
+	ROMFingerprint string
+	RAMSize        RAMSize
+	// Snapshot is the state the movie starts from, or nil if it starts from power-on.
+	Snapshot *Snapshot
+	Frames   []MovieFrame
+	Events   []MovieEvent
+}
+
+// MatchesROM reports whether the movie was recorded with the given ROM.
+func (m *Movie) MatchesROM(rom *ROM) bool {
+	return rom.Fingerprint == m.ROMFingerprint
+}
+
+// StateHash returns a checksum of the CPU registers and the RAM, for checking whether a replay
+// still follows the recorded run.
+func StateHash(states z80.States, mem *Memory) uint32 {
+	data := []byte{
+		states.AF.Hi, states.AF.Lo, states.BC.Hi, states.BC.Lo,
+		states.DE.Hi, states.DE.Lo, states.HL.Hi, states.HL.Lo,
+		states.Alternate.AF.Hi, states.Alternate.AF.Lo, states.Alternate.BC.Hi, states.Alternate.BC.Lo,
+		states.Alternate.DE.Hi, states.Alternate.DE.Lo, states.Alternate.HL.Hi, states.Alternate.HL.Lo,
+		states.IR.Hi, byte(states.IM),
+	}
+	for _, w := range []uint16{states.IX, states.IY, states.SP, states.PC} {
+		data = binary.LittleEndian.AppendUint16(data, w)
+	}
+	for _, f := range []bool{states.IFF1, states.IFF2, states.HALT, states.InNMI} {
+		data = appendBool(data, f)
+	}
+
+	hash := crc32.ChecksumIEEE(data)
+	return crc32.Update(hash, crc32.IEEETable, mem.data[mem.protected:])
+}
+
+// Encode serializes the movie in the same way as the snapshots, starting with a magic string and
+// a version number, and ending with a CRC32 checksum. The starting snapshot is embedded in its own
+// encoding.
+func (m *Movie) Encode() []byte {
+	data := []byte(movieMagic)
+	data = binary.LittleEndian.AppendUint16(data, movieVersion)
+
+	data = append(data, byte(len(m.ROMType)))
+	data = append(data, m.ROMType...)
+	data = append(data, byte(m.RAMSize))
+	data = append(data, byte(len(m.ROMFingerprint)))
+	data = append(data, m.ROMFingerprint...)
+
+	var snapshot []byte
+	if m.Snapshot != nil {
+		snapshot = m.Snapshot.Encode()
+	}
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(snapshot)))
+	data = append(data, snapshot...)
+
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(m.Frames)))
+	for _, f := range m.Frames {
+		data = f.append(data)
+	}
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(m.Events)))
+	for _, e := range m.Events {
+		data = e.append(data)
+	}
+
+	return binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+}
+
+func (f *MovieFrame) append(data []byte) []byte {
+	var flags byte
+	if f.Reset {
+		flags |= movieFlagReset
+	}
+	if f.FastTape {
+		flags |= movieFlagFastTape
+	}
+
+	data = append(data, byte(len(f.Keys)))
+	data = append(data, f.Keys...)
+	data = append(data, byte(f.Joysticks[0]), byte(f.Joysticks[1]), flags)
+	data = binary.LittleEndian.AppendUint32(data, uint32(f.ClockSpeed))
+	return binary.LittleEndian.AppendUint32(data, f.Hash)
+}
+
+func (e *MovieEvent) append(data []byte) []byte {
+	data = binary.LittleEndian.AppendUint32(data, uint32(e.Frame))
+	data = append(data, byte(e.Type))
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(e.Tape)))
+	data = append(data, e.Tape...)
+	data = appendPulses(data, e.Pulses)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(e.PRI)))
+	return append(data, e.PRI...)
+}
+
+// DecodeMovie parses a movie created by Encode.
+func DecodeMovie(data []byte) (*Movie, error) {
+	if len(data) < len(movieMagic)+6 || string(data[:len(movieMagic)]) != movieMagic {
+		return nil, fmt.Errorf("%w: missing header", ErrInvalidMovie)
+	}
+
+	payload, checksum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidMovie)
+	}
+
+	r := &snapshotReader{data: payload, pos: len(movieMagic)}
+	if version := r.readUint16(); version != movieVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidMovie, version)
+	}
+
+	m := &Movie{}
+	snapshot := m.read(r)
+	if r.err != nil || r.pos != len(payload) {
+		return nil, fmt.Errorf("%w: unexpected size", ErrInvalidMovie)
+	}
+	if !m.ROMType.Validate() || !m.RAMSize.Validate() {
+		return nil, fmt.Errorf("%w: invalid machine model", ErrInvalidMovie)
+	}
+
+	if len(snapshot) > 0 {
+		var err error
+		if m.Snapshot, err = DecodeSnapshot(snapshot); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidMovie, err)
+		}
+	}
+	return m, nil
+}
+
+// read decodes the fields in the same order as Encode appends them, and returns the encoded
+// starting snapshot.
+func (m *Movie) read(r *snapshotReader) []byte {
+	m.ROMType = ROMType(r.readBytes(int(r.readUint8())))
+	m.RAMSize = RAMSize(r.readUint8())
+	m.ROMFingerprint = string(r.readBytes(int(r.readUint8())))
+	snapshot := r.readBytes(int(r.readUint32()))
+
+	frames := int(r.readUint32())
+	for i := 0; i < frames && r.err == nil; i++ {
+		m.Frames = append(m.Frames, readMovieFrame(r))
+	}
+	events := int(r.readUint32())
+	for i := 0; i < events && r.err == nil; i++ {
+		m.Events = append(m.Events, readMovieEvent(r))
+	}
+	return snapshot
+}
+
+func readMovieFrame(r *snapshotReader) MovieFrame {
+	f := MovieFrame{Keys: r.readBytes(int(r.readUint8()))}
+	f.Joysticks = [2]Joystick{Joystick(r.readUint8()), Joystick(r.readUint8())}
+	flags := r.readUint8()
+	f.Reset = flags&movieFlagReset != 0
+	f.FastTape = flags&movieFlagFastTape != 0
+	f.ClockSpeed = int(r.readUint32())
+	f.Hash = r.readUint32()
+	return f
+}
+
+func readMovieEvent(r *snapshotReader) MovieEvent {
+	e := MovieEvent{Frame: int(r.readUint32()), Type: MovieEventType(r.readUint8())}
+	e.Tape = r.readBytes(int(r.readUint32()))
+	e.Pulses = r.readPulses()
+	e.PRI = r.readBytes(int(r.readUint32()))
+	return e
+}
@@ -0,0 +1,73 @@
+package primo
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMovieRoundTrip(t *testing.T) {
+	frames := []MovieFrame{
+		{Keys: []uint8{1, 2}, ClockSpeed: 2500000, Hash: 0x12345678},
+		{Joysticks: [2]Joystick{3, 4}, Reset: true, FastTape: true, ClockSpeed: 3500000, Hash: 0x9abcdef0},
+	}
+	events := []MovieEvent{
+		{Frame: 10, Type: MovieEventTape, Tape: []byte{0x55, 0x03, 0x00}},
+		{Frame: 20, Type: MovieEventTape, Pulses: []time.Duration{6 * time.Second, bitOneMark, time.Hour}},
+		{Frame: 30, Type: MovieEventPRI, PRI: []byte{priEndBlock}},
+		{Frame: 40, Type: MovieEventHardReset},
+	}
+
+	tests := []struct {
+		name     string
+		snapshot *Snapshot
+	}{
+		{"from power-on", nil},
+		{"from a snapshot", testSnapshot(nil)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := &Movie{
+				ROMType:        ROMTypeB,
+				ROMFingerprint: "fingerprint",
+				RAMSize:        RAMSize32K,
+				Snapshot:       test.snapshot,
+				Frames:         frames,
+				Events:         events,
+			}
+			decoded, err := DecodeMovie(m.Encode())
+			if err != nil {
+				t.Fatalf("DecodeMovie() error = %v", err)
+			}
+			if !reflect.DeepEqual(decoded, m) {
+				t.Errorf("DecodeMovie() = %+v, want %+v", decoded, m)
+			}
+		})
+	}
+}
+
+func TestDecodeMovieInvalid(t *testing.T) {
+	data := (&Movie{ROMType: ROMTypeA, RAMSize: RAMSize48K}).Encode()
+	corrupt := append([]byte(nil), data...)
+	corrupt[len(movieMagic)+2] ^= 0xff
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"save state", testSnapshot(nil).Encode()},
+		{"checksum mismatch", corrupt},
+		{"truncated", data[:len(data)-1]},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := DecodeMovie(test.data); !errors.Is(err, ErrInvalidMovie) {
+				t.Errorf("DecodeMovie() error = %v, want %v", err, ErrInvalidMovie)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package primo
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	priBASICBlock       = 0xd1
+	priScreenBlock      = 0xd5
+	priMachineCodeBlock = 0xd9
+	priAutostartBlock   = 0xc3
+	priEndBlock         = 0xc9
+
+	screenDataSize = 0x1800
+)
+
+var ErrInvalidPRI = errors.New("invalid PRI file")
+
+type priBlock struct {
+	blockType byte
+	address   uint16
+	data      []byte
+}
+
+// PRIFile is a parsed PRI memory image. Every block of the file starts with a block type byte
+// followed by a little endian address and, for data blocks, a little endian length and the data
+// itself. BASIC blocks are addressed relative to the start of the BASIC program, screen blocks
+// relative to the start of the display data, and machine code blocks absolutely.
+type PRIFile struct {
+	data         []byte
+	blocks       []priBlock
+	autostart    uint16
+	hasAutostart bool
+}
+
+func readWord(data []byte, pos int) (uint16, error) {
+	if pos+2 > len(data) {
+		return 0, fmt.Errorf("%w: unexpected end of file at %d", ErrInvalidPRI, pos)
+	}
+	return uint16(data[pos]) | uint16(data[pos+1])<<8, nil
+}
+
+func (p *PRIFile) parseDataBlock(data []byte, pos int) (int, error) {
+	address, err := readWord(data, pos+1)
+	if err != nil {
+		return 0, err
+	}
+	length, err := readWord(data, pos+3)
+	if err != nil {
+		return 0, err
+	}
+
+	start := pos + 5
+	if start+int(length) > len(data) {
+		return 0, fmt.Errorf("%w: block at %d is truncated", ErrInvalidPRI, pos)
+	}
+
+	p.blocks = append(p.blocks, priBlock{
+		blockType: data[pos],
+		address:   address,
+		data:      data[start : start+int(length)],
+	})
+
+	return start + int(length), nil
+}
+
+func ParsePRI(data []byte) (*PRIFile, error) {
+	pri := &PRIFile{data: data}
+
+	for pos := 0; pos < len(data); {
+		switch data[pos] {
+		case priBASICBlock, priScreenBlock, priMachineCodeBlock:
+			next, err := pri.parseDataBlock(data, pos)
+			if err != nil {
+				return nil, err
+			}
+			pos = next
+		case priAutostartBlock:
+			address, err := readWord(data, pos+1)
+			if err != nil {
+				return nil, err
+			}
+			pri.autostart = address
+			pri.hasAutostart = true
+			pos += 3
+		case priEndBlock:
+			return pri, nil
+		default:
+			return nil, fmt.Errorf("%w: unknown block type 0x%02x at %d", ErrInvalidPRI, data[pos], pos)
+		}
+	}
+
+	// some files omit the closing block, which is fine as long as every block was complete
+	return pri, nil
+}
+
+// Data returns the contents of the file the PRI image was parsed from.
+func (p *PRIFile) Data() []byte {
+	return p.data
+}
+
+// Autostart returns the address the loaded program should be started from, if the file has one.
+func (p *PRIFile) Autostart() (uint16, bool) {
+	return p.autostart, p.hasAutostart
+}
+
+// Load writes the contents of the PRI file into memory, and updates the BASIC program pointers if
+// the file contained a BASIC program.
+func (p *PRIFile) Load(mem *Memory) {
+	basicStart := mem.getWord(mem.ROMLabelAddress(ROMLabelTXTTAB))
+	screenStart := mem.ScreenEndAddress(ScreenPagePrimary) - screenDataSize + 1
+	hasBASIC := false
+
+	for _, block := range p.blocks {
+		address := block.address
+		switch block.blockType {
+		case priBASICBlock:
+			address += basicStart
+			hasBASIC = true
+		case priScreenBlock:
+			address += screenStart
+		}
+
+		for i, b := range block.data {
+			mem.Set(address+uint16(i), b)
+		}
+	}
+
+	if hasBASIC {
+		relinkBASIC(mem)
+	}
+}
+
+// relinkBASIC rebuilds the line chain of the BASIC program in memory and moves the variable,
+// array and free memory pointers right after the end of the program, the same way the ROM does
+// after loading a program from tape.
+func relinkBASIC(mem *Memory) {
+	line := mem.getWord(mem.ROMLabelAddress(ROMLabelTXTTAB))
+
+	// a line starts with a pointer to the next line and the line number, and ends with a zero
+	// byte, while the program ends with a zero next line pointer
+	for line != 0 && mem.getWord(line) != 0 {
+		next := line + 4
+		for next != 0 && mem.Get(next) != 0 {
+			next++
+		}
+		if next == 0 {
+			// ran off the end of memory, the program is corrupt
+			return
+		}
+		mem.setWord(line, next+1)
+		line = next + 1
+	}
+
+	vartab := mem.ROMLabelAddress(ROMLabelVARTAB)
+	mem.setWord(vartab, line+2)   // simple variables
+	mem.setWord(vartab+2, line+2) // arrays
+	mem.setWord(vartab+4, line+2) // free memory
+}
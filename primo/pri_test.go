@@ -0,0 +1,106 @@
+package primo_test
+
+import (
+	"errors"
+	"testing"
+
+	"primgo/primo"
+)
+
+func TestParsePRI(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          []byte
+		wantAutostart uint16
+		wantHas       bool
+	}{
+		{"empty", nil, 0, false},
+		{"end block", []byte{0xc9}, 0, false},
+		{"data block", []byte{0xd9, 0x00, 0x50, 0x02, 0x00, 0x12, 0x34, 0xc9}, 0, false},
+		{"autostart", []byte{0xd9, 0x00, 0x50, 0x01, 0x00, 0x12, 0xc3, 0x00, 0x50, 0xc9}, 0x5000, true},
+		{"missing end block", []byte{0xd1, 0x00, 0x00, 0x01, 0x00, 0x00}, 0, false},
+		{"data after end block", []byte{0xc9, 0xff}, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pri, err := primo.ParsePRI(test.data)
+			if err != nil {
+				t.Fatalf("ParsePRI() error = %v", err)
+			}
+			if address, ok := pri.Autostart(); address != test.wantAutostart || ok != test.wantHas {
+				t.Errorf("Autostart() = 0x%04X, %v, want 0x%04X, %v", address, ok, test.wantAutostart, test.wantHas)
+			}
+		})
+	}
+}
+
+func TestParsePRIInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"unknown block", []byte{0x00}},
+		{"truncated header", []byte{0xd9, 0x00, 0x50, 0x02}},
+		{"truncated data", []byte{0xd9, 0x00, 0x50, 0x02, 0x00, 0x12}},
+		{"truncated autostart", []byte{0xc3, 0x00}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := primo.ParsePRI(test.data); !errors.Is(err, primo.ErrInvalidPRI) {
+				t.Errorf("ParsePRI() error = %v, want %v", err, primo.ErrInvalidPRI)
+			}
+		})
+	}
+}
+
+func TestPRILoad(t *testing.T) {
+	const basicStart = 0x43ea
+
+	mem := primo.NewMemory(primo.BuiltInROM(primo.ROMTypeA), primo.RAMSize48K)
+	txttab := mem.ROMLabelAddress(primo.ROMLabelTXTTAB)
+	mem.Set(txttab, basicStart&0xff)
+	mem.Set(txttab+1, basicStart>>8)
+
+	pri, err := primo.ParsePRI([]byte{
+		// machine code at an absolute address
+		0xd9, 0x00, 0x80, 0x02, 0x00, 0xaa, 0xbb,
+		// the first byte of the screen
+		0xd5, 0x00, 0x00, 0x01, 0x00, 0xcc,
+		// 10 PRINT, with a wrong pointer to the next line
+		0xd1, 0x00, 0x00, 0x08, 0x00, 0xff, 0xff, 0x0a, 0x00, 0x99, 0x00, 0x00, 0x00,
+		0xc9,
+	})
+	if err != nil {
+		t.Fatalf("ParsePRI() error = %v", err)
+	}
+	pri.Load(mem)
+
+	screenStart := mem.ScreenEndAddress(primo.ScreenPagePrimary) - 0x1800 + 1
+	vartab := mem.ROMLabelAddress(primo.ROMLabelVARTAB)
+	tests := []struct {
+		name    string
+		address uint16
+		want    uint8
+	}{
+		{"machine code", 0x8000, 0xaa},
+		{"machine code end", 0x8001, 0xbb},
+		{"screen", screenStart, 0xcc},
+		{"next line low", basicStart, 0xf0},
+		{"next line high", basicStart + 1, 0x43},
+		{"line number", basicStart + 2, 0x0a},
+		{"variables low", vartab, 0xf2},
+		{"variables high", vartab + 1, 0x43},
+		{"arrays low", vartab + 2, 0xf2},
+		{"free memory low", vartab + 4, 0xf2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := mem.Get(test.address); got != test.want {
+				t.Errorf("Get(0x%04X) = 0x%02X, want 0x%02X", test.address, got, test.want)
+			}
+		})
+	}
+}
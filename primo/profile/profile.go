@@ -0,0 +1,69 @@
+// Package profile holds where the CPU spent its cycles, collected instruction by instruction while
+// a program runs, and writes it as a flat table of hotspots, as totals per ROM routine, or in the
+// callgrind format read by KCachegrind and other profile viewers.
+package profile
+
+// NMIAddress is the address of the NMI handler, which is named NMI unless it has a symbol.
+const NMIAddress = 0x0066
+
+// Location is an instruction executed by a function, the function being identified by the address
+// it was called at. The code running outside of any call belongs to the function at 0x0000, where
+// the machine starts.
+type Location struct {
+	Function uint16
+	Address  uint16
+}
+
+// Call is a call made from the instruction of the caller to the function of the callee. The NMI is
+// recorded as a call of the handler at 0x0066 from the interrupted instruction.
+type Call struct {
+	Caller Location
+	Callee uint16
+}
+
+// Cost is the number of cycles spent, and the number of times it was spent. The cycles of a call
+// include everything executed until it returned.
+type Cost struct {
+	Cycles uint64
+	Count  uint64
+}
+
+type Profile struct {
+	// Cycles is the number of cycles executed while profiling.
+	Cycles       uint64
+	Instructions map[Location]Cost
+	Calls        map[Call]Cost
+}
+
+func New() *Profile {
+	return &Profile{
+		Instructions: make(map[Location]Cost),
+		Calls:        make(map[Call]Cost),
+	}
+}
+
+// AddInstruction adds an execution of the instruction at the location.
+func (p *Profile) AddInstruction(location Location, cycles int) {
+	c := p.Instructions[location]
+	c.Cycles += uint64(cycles)
+	c.Count++
+	p.Instructions[location] = c
+	p.Cycles += uint64(cycles)
+}
+
+// AddCycles adds cycles spent at the location without executing the instruction there, like
+// accepting an interrupt.
+func (p *Profile) AddCycles(location Location, cycles int) {
+	c := p.Instructions[location]
+	c.Cycles += uint64(cycles)
+	p.Instructions[location] = c
+	p.Cycles += uint64(cycles)
+}
+
+// AddCall adds a call which took the given number of cycles until it returned.
+func (p *Profile) AddCall(call Call, cycles uint64) {
+	c := p.Calls[call]
+	c.Cycles += cycles
+	c.Count++
+	p.Calls[call] = c
+}
@@ -0,0 +1,239 @@
+package profile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"golang.org/x/exp/constraints"
+	"golang.org/x/exp/slices"
+
+	"primgo/primo/disasm"
+)
+
+const (
+	// romEnd is the first address after the ROM, the labels below it are the routines of the ROM.
+	romEnd = 0x4000
+	// the number of instructions listed by the report
+	reportHotspots = 40
+)
+
+// hotspot is the cost of an instruction, with the function spending the most cycles on it.
+type hotspot struct {
+	address  uint16
+	cost     Cost
+	function uint16
+	cycles   uint64
+}
+
+// functionName names the function by its symbol, or by its address if it has none.
+func functionName(symbols disasm.Symbols, address uint16) string {
+	if name, ok := symbols[address]; ok {
+		return name
+	}
+	if address == NMIAddress {
+		return "NMI"
+	}
+	return fmt.Sprintf("$%04X", address)
+}
+
+func (p *Profile) percent(cycles uint64) float64 {
+	if p.Cycles == 0 {
+		return 0
+	}
+	return float64(cycles) * 100 / float64(p.Cycles)
+}
+
+// WriteReport writes the hotspots and the totals of the ROM routines as plain text, to be read by
+// humans.
+func (p *Profile) WriteReport(w io.Writer, mem disasm.Reader, symbols disasm.Symbols) error {
+	if _, err := fmt.Fprintf(w, "Cycles executed: %d\n\nHotspots:\n", p.Cycles); err != nil {
+		return fmt.Errorf("cannot write profile: %w", err)
+	}
+	if err := p.WriteHotspots(w, mem, symbols, reportHotspots); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprint(w, "\nROM routines:\n"); err != nil {
+		return fmt.Errorf("cannot write profile: %w", err)
+	}
+	return p.WriteRoutineTotals(w, symbols)
+}
+
+// WriteHotspots writes a table of the instructions taking the most cycles, at most count of them,
+// with the number of times they were executed, the function executing them, and their disassembly
+// from the memory. An instruction executed by several functions is shown with the one spending the
+// most cycles on it.
+func (p *Profile) WriteHotspots(w io.Writer, mem disasm.Reader, symbols disasm.Symbols, count int) error {
+	hotspots := make(map[uint16]*hotspot)
+	for location, cost := range p.Instructions {
+		h := hotspots[location.Address]
+		if h == nil {
+			h = &hotspot{address: location.Address}
+			hotspots[location.Address] = h
+		}
+		h.cost.Cycles += cost.Cycles
+		h.cost.Count += cost.Count
+		if cost.Cycles > h.cycles {
+			h.function = location.Function
+			h.cycles = cost.Cycles
+		}
+	}
+
+	sorted := make([]*hotspot, 0, len(hotspots))
+	for _, h := range hotspots {
+		sorted = append(sorted, h)
+	}
+	slices.SortFunc(sorted, func(a, b *hotspot) int {
+		if c := compare(b.cost.Cycles, a.cost.Cycles); c != 0 {
+			return c
+		}
+		return compare(a.address, b.address)
+	})
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "%-7s %12s %8s %10s  %-20s %s\n",
+		"ADDRESS", "CYCLES", "PERCENT", "EXECUTED", "FUNCTION", "INSTRUCTION")
+	for _, h := range sorted[:min(count, len(sorted))] {
+		fmt.Fprintf(out, "%04X    %12d %7.2f%% %10d  %-20s %s\n", h.address, h.cost.Cycles, p.percent(h.cost.Cycles),
+			h.cost.Count, functionName(symbols, h.function), disasm.Decode(mem, h.address).Text)
+	}
+	return flush(out)
+}
+
+// routineTotal is the cost of a ROM routine.
+type routineTotal struct {
+	address   uint16
+	self      uint64
+	calls     uint64
+	inclusive uint64
+}
+
+// WriteRoutineTotals writes a table of the cycles spent in the ROM routines named by the symbols,
+// which are the functions called at the labels of the ROM. The self cycles are the ones executed by
+// the routine itself, while the inclusive cycles include the routines it called too.
+func (p *Profile) WriteRoutineTotals(w io.Writer, symbols disasm.Symbols) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "%-20s %-7s %10s %12s %8s %12s %8s\n",
+		"ROUTINE", "ADDRESS", "CALLS", "SELF", "PERCENT", "INCLUSIVE", "PERCENT")
+	for _, t := range p.routineTotals(symbols) {
+		fmt.Fprintf(out, "%-20s %04X    %10d %12d %7.2f%% %12d %7.2f%%\n", symbols[t.address], t.address,
+			t.calls, t.self, p.percent(t.self), t.inclusive, p.percent(t.inclusive))
+	}
+	return flush(out)
+}
+
+// routineTotals returns the cost of the ROM routines executed, the most expensive first.
+func (p *Profile) routineTotals(symbols disasm.Symbols) []*routineTotal {
+	totals := make(map[uint16]*routineTotal)
+	total := func(address uint16) *routineTotal {
+		if totals[address] == nil {
+			totals[address] = &routineTotal{address: address}
+		}
+		return totals[address]
+	}
+	routine := func(address uint16) bool {
+		_, ok := symbols[address]
+		return ok && address < romEnd
+	}
+
+	for location, cost := range p.Instructions {
+		if routine(location.Function) {
+			total(location.Function).self += cost.Cycles
+		}
+	}
+	for call, cost := range p.Calls {
+		if routine(call.Callee) {
+			t := total(call.Callee)
+			t.calls += cost.Count
+			t.inclusive += cost.Cycles
+		}
+	}
+
+	sorted := make([]*routineTotal, 0, len(totals))
+	for _, t := range totals {
+		sorted = append(sorted, t)
+	}
+	slices.SortFunc(sorted, func(a, b *routineTotal) int {
+		if c := compare(b.self, a.self); c != 0 {
+			return c
+		}
+		if c := compare(b.inclusive, a.inclusive); c != 0 {
+			return c
+		}
+		return compare(a.address, b.address)
+	})
+	return sorted
+}
+
+// WriteCallgrind writes the profile in the callgrind format, with the instruction addresses as
+// positions and the cycles as the only event. The functions are named by the symbols.
+func (p *Profile) WriteCallgrind(w io.Writer, symbols disasm.Symbols) error {
+	instructions := make(map[uint16][]Location)
+	for location := range p.Instructions {
+		instructions[location.Function] = append(instructions[location.Function], location)
+	}
+	calls := make(map[uint16][]Call)
+	for call := range p.Calls {
+		calls[call.Caller.Function] = append(calls[call.Caller.Function], call)
+		if _, ok := instructions[call.Callee]; !ok {
+			instructions[call.Callee] = nil
+		}
+	}
+
+	functions := make([]uint16, 0, len(instructions))
+	for function := range instructions {
+		functions = append(functions, function)
+	}
+	slices.Sort(functions)
+
+	out := bufio.NewWriter(w)
+	fmt.Fprint(out, "# callgrind format\nversion: 1\ncreator: primgo\npositions: instr\nevents: Cycles\n")
+	fmt.Fprintf(out, "summary: %d\n", p.Cycles)
+	for _, function := range functions {
+		fmt.Fprintf(out, "\nfn=%s\n", functionName(symbols, function))
+		p.writeCallgrindFunction(out, instructions[function], calls[function], symbols)
+	}
+	return flush(out)
+}
+
+// writeCallgrindFunction writes the cost of the instructions of a function, and of the calls it
+// made.
+func (p *Profile) writeCallgrindFunction(out io.Writer, locations []Location, calls []Call, symbols disasm.Symbols) {
+	slices.SortFunc(locations, func(a, b Location) int {
+		return compare(a.Address, b.Address)
+	})
+	for _, location := range locations {
+		fmt.Fprintf(out, "0x%04X %d\n", location.Address, p.Instructions[location].Cycles)
+	}
+
+	slices.SortFunc(calls, func(a, b Call) int {
+		if c := compare(a.Caller.Address, b.Caller.Address); c != 0 {
+			return c
+		}
+		return compare(a.Callee, b.Callee)
+	})
+	for _, call := range calls {
+		cost := p.Calls[call]
+		fmt.Fprintf(out, "cfn=%s\ncalls=%d 0x%04X\n0x%04X %d\n",
+			functionName(symbols, call.Callee), cost.Count, call.Callee, call.Caller.Address, cost.Cycles)
+	}
+}
+
+func flush(out *bufio.Writer) error {
+	if err := out.Flush(); err != nil {
+		return fmt.Errorf("cannot write profile: %w", err)
+	}
+	return nil
+}
+
+// compare returns the order of two values as needed by slices.SortFunc.
+func compare[T constraints.Ordered](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,86 @@
+package primo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	tapeNameBlock  = 0x83
+	tapeBASICBlock = 0xf1
+	// the length of a data block is stored in a byte, where 0 stands for 256
+	tapeDataBlockHeaderSize = 5
+)
+
+var ErrInvalidPTP = errors.New("invalid PTP file")
+
+// TapeFile is a file of a PTP tape, with the BASIC program it contains, if there's one.
+type TapeFile struct {
+	Name  string
+	BASIC []byte
+}
+
+// ParsePTP reads the files of a PTP tape. Every block of a file starts with its type and its
+// number. Name blocks continue with the length of the name and the name itself, while data blocks
+// continue with a little endian address and the length of the data. BASIC data blocks are
+// addressed relative to the start of the BASIC program, like in PRI files.
+func ParsePTP(ptp []byte) ([]TapeFile, error) {
+	var files []TapeFile
+	for pos := 0; pos < len(ptp); {
+		switch ptp[pos] {
+		case ptpHeader:
+			files = append(files, TapeFile{})
+			pos += 3
+		case dataBlockHeader, closingBlockHeader:
+			if len(files) == 0 || pos+3 > len(ptp) {
+				return nil, fmt.Errorf("%w: unexpected block at %d", ErrInvalidPTP, pos)
+			}
+			size := int(ptp[pos+1]) | int(ptp[pos+2])<<8
+			end := pos + 3 + size
+			if end > len(ptp) {
+				return nil, fmt.Errorf("%w: block at %d is truncated", ErrInvalidPTP, pos)
+			}
+			if err := files[len(files)-1].addBlock(ptp[pos+3:end], pos); err != nil {
+				return nil, err
+			}
+			pos = end
+		default:
+			return nil, fmt.Errorf("%w: unknown block header 0x%02x at %d", ErrInvalidPTP, ptp[pos], pos)
+		}
+	}
+	return files, nil
+}
+
+// addBlock adds the contents of a name or a BASIC data block found at the position of the tape to
+// the file, the other blocks are skipped.
+func (f *TapeFile) addBlock(block []byte, pos int) error {
+	if len(block) == 0 {
+		return fmt.Errorf("%w: empty block at %d", ErrInvalidPTP, pos)
+	}
+
+	switch block[0] {
+	case tapeNameBlock:
+		if len(block) < 3 || len(block) < 3+int(block[2]) {
+			return fmt.Errorf("%w: name block at %d is truncated", ErrInvalidPTP, pos)
+		}
+		f.Name = strings.TrimRight(DecodeText(block[3:3+int(block[2])]), " ")
+	case tapeBASICBlock:
+		if len(block) < tapeDataBlockHeaderSize {
+			return fmt.Errorf("%w: data block at %d is truncated", ErrInvalidPTP, pos)
+		}
+		address := int(block[2]) | int(block[3])<<8
+		length := int(block[4])
+		if length == 0 {
+			length = 256
+		}
+		if len(block) < tapeDataBlockHeaderSize+length {
+			return fmt.Errorf("%w: data block at %d is truncated", ErrInvalidPTP, pos)
+		}
+		if end := address + length; end > len(f.BASIC) {
+			f.BASIC = append(f.BASIC, make([]byte, end-len(f.BASIC))...)
+		}
+		copy(f.BASIC[address:], block[tapeDataBlockHeaderSize:tapeDataBlockHeaderSize+length])
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package primo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"primgo/primo/roms"
+)
+
+var (
+	ErrUnknownROM       = errors.New("unknown ROM image")
+	ErrInvalidROMLabels = errors.New("invalid ROM labels")
+)
+
+// ROM is a 16K ROM image along with the addresses of the routines the emulator has to patch. The
+// type decides how the rest of the machine behaves, like the colors of the screen.
+type ROM struct {
+	Type        ROMType
+	Fingerprint string
+	data        []byte
+	labels      map[ROMLabel]uint16
+}
+
+// BuiltInROM returns one of the ROM images shipped with the emulator.
+func BuiltInROM(romType ROMType) *ROM {
+	var data []byte
+	switch romType {
+	case ROMTypeA:
+		data = roms.A64
+	case ROMTypeB:
+		data = roms.B64
+	case ROMTypeC:
+		data = roms.C64
+	}
+
+	labels := map[ROMLabel]uint16{
+		ROMLabelTXTTAB: 0x40A4,
+		ROMLabelVARTAB: 0x40F9,
+	}
+	for label, addresses := range builtInLabels() {
+		if address, ok := addresses[romType]; ok {
+			labels[label] = address
+		}
+	}
+
+	return &ROM{
+		Type:        romType,
+		Fingerprint: romFingerprint(data),
+		data:        data,
+		labels:      labels,
+	}
+}
+
+func builtInLabels() map[ROMLabel]map[ROMType]uint16 {
+	return map[ROMLabel]map[ROMType]uint16{
+		ROMLabelINBYTE:   {ROMTypeA: 0x3CAB, ROMTypeB: 0x3CAB, ROMTypeC: 0x0DCC},
+		ROMLabelRDHEAD:   {ROMTypeA: 0x3B36, ROMTypeB: 0x3B36, ROMTypeC: 0x0C58},
+		ROMLabelRDSYN:    {ROMTypeA: 0x3C75, ROMTypeB: 0x3C75, ROMTypeC: 0x0D96},
+		ROMLabelGOMBM:    {ROMTypeA: 0x3921, ROMTypeB: 0x3921},
+		ROMLabelINIT:     {ROMTypeA: 0x3178, ROMTypeB: 0x3178, ROMTypeC: 0x00C9},
+		ROMLabelRESET:    {ROMTypeA: 0x316A, ROMTypeB: 0x316A},
+		ROMLabelNMIStuck: {ROMTypeC: 0x3e7f},
+		ROMLabelOUTBYTE:  {ROMTypeA: 0x3AF4, ROMTypeB: 0x3AF4, ROMTypeC: 0x0C1E},
+		ROMLabelWRHEAD:   {ROMTypeA: 0x3A81, ROMTypeB: 0x3A81, ROMTypeC: 0x0BAD},
+		ROMLabelWRSYN:    {ROMTypeA: 0x3ADD, ROMTypeB: 0x3ADD, ROMTypeC: 0x0C07},
+	}
+}
+
+func romFingerprint(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// NewROM identifies a ROM image. The built-in images are recognized by their fingerprint, for
+// other images the patched routines are searched for by their code, so modified or translated
+// versions of the original ROMs can be used too. Routines that are not found can be given in a
+// label override file.
+func NewROM(data []byte) (*ROM, error) {
+	if len(data) != romSize*1024 {
+		return nil, fmt.Errorf("%w: size is %d bytes instead of %d", ErrUnknownROM, len(data), romSize*1024)
+	}
+
+	fingerprint := romFingerprint(data)
+	for _, romType := range []ROMType{ROMTypeA, ROMTypeB, ROMTypeC} {
+		if rom := BuiltInROM(romType); rom.Fingerprint == fingerprint {
+			return rom, nil
+		}
+	}
+
+	rom := &ROM{
+		Fingerprint: fingerprint,
+		data:        append([]byte(nil), data...),
+		labels: map[ROMLabel]uint16{
+			ROMLabelTXTTAB: 0x40A4,
+			ROMLabelVARTAB: 0x40F9,
+		},
+	}
+	for _, p := range romPatterns() {
+		if address, ok := p.find(data); ok {
+			rom.labels[p.label] = address
+		}
+	}
+
+	rom.Type = rom.detectType()
+	return rom, nil
+}
+
+// detectType finds out which version the image is based on. Only the color version has the NMI
+// handler that gets stuck, the monochrome ones are told apart by comparing them to the originals.
+func (r *ROM) detectType() ROMType {
+	if _, ok := r.labels[ROMLabelNMIStuck]; ok {
+		return ROMTypeC
+	}
+	if r.similarity(BuiltInROM(ROMTypeB)) > r.similarity(BuiltInROM(ROMTypeA)) {
+		return ROMTypeB
+	}
+	return ROMTypeA
+}
+
+// Validate checks whether the emulator can run the ROM. Without knowing where the INIT routine is,
+// the periodic NMI handling the keyboard can't be started.
+func (r *ROM) Validate() error {
+	if _, ok := r.labels[ROMLabelINIT]; !ok {
+		return fmt.Errorf("%w: INIT routine not found, its address can be set in %s", ErrUnknownROM,
+			r.LabelsFileName())
+	}
+	return nil
+}
+
+// romLabelsFile is the format of the label override files. Addresses are strings, so they can be
+// written in hexadecimal like "0x3CAB".
+type romLabelsFile struct {
+	ROMType ROMType             `json:"rom_type"`
+	Labels  map[ROMLabel]string `json:"labels"`
+}
+
+// OverrideLabels replaces the type and the label addresses of the ROM with the ones in a JSON file,
+// for images where they can't be found automatically. Anything missing from the file is kept.
+func (r *ROM) OverrideLabels(data []byte) error {
+	var file romLabelsFile
+	err := json.Unmarshal(data, &file)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidROMLabels, err)
+	}
+
+	if file.ROMType != "" && !file.ROMType.Validate() {
+		return fmt.Errorf("%w: unknown ROM type %q", ErrInvalidROMLabels, file.ROMType)
+	}
+
+	labels := make(map[ROMLabel]uint16, len(r.labels))
+	for label, address := range r.labels {
+		labels[label] = address
+	}
+	for label, text := range file.Labels {
+		address, parseErr := strconv.ParseUint(text, 0, 16)
+		if parseErr != nil {
+			return fmt.Errorf("%w: address of %s: %w", ErrInvalidROMLabels, label, parseErr)
+		}
+		labels[label] = uint16(address)
+	}
+
+	if file.ROMType != "" {
+		r.Type = file.ROMType
+	}
+	r.labels = labels
+	return nil
+}
+
+// Labels returns the addresses of every label known in the ROM.
+func (r *ROM) Labels() map[ROMLabel]uint16 {
+	labels := make(map[ROMLabel]uint16, len(r.labels))
+	for label, address := range r.labels {
+		labels[label] = address
+	}
+	return labels
+}
+
+// LabelsFileName returns the name of the label override file belonging to the ROM.
+func (r *ROM) LabelsFileName() string {
+	return fmt.Sprintf("rom_%s.json", r.Fingerprint[:16])
+}
+
+// wildcardByte matches any byte in a pattern
+const wildcardByte = -1
+
+// romPattern is a piece of code to search for in unknown ROM images, with the address of the label
+// at offset bytes from its start. Bytes that can differ between versions, like absolute addresses,
+// are written as "??".
+type romPattern struct {
+	label   ROMLabel
+	code    string
+	offset  uint16
+	pattern []int
+}
+
+func romPatterns() []romPattern {
+	patterns := []romPattern{
+		{label: ROMLabelINBYTE, code: "C5 06 08 CD ?? ?? 10 FB 47 82 57 78 C1 C9"},
+		{label: ROMLabelRDHEAD, code: "3E 06 CD ?? ?? CD ?? ?? E5 AF 32 5D 40 11 ?? ??"},
+		{label: ROMLabelRDSYN, code: "AF CD ?? ?? FE D3 20 F9 CD ?? ?? FE D3 28 F9 C9"},
+		{label: ROMLabelGOMBM, code: "16 7F 06 ?? 3A 46 40 3D 20 FD ED 78 E6 01"},
+		{label: ROMLabelINIT, code: "ED 56 F3 21 ?? ?? 11 00 40 01 3C 00 ED B0 AF 06 44"},
+		{label: ROMLabelINIT, code: "AF 11 42 40 06 20 12 13 10 FC DD 21 42 40 3A 3B 40 D3 00"},
+		{label: ROMLabelRESET, code: "2A 1F 40 E5 CD ?? ?? E1 22 1F 40 C3 1E 40"},
+		{label: ROMLabelNMIStuck, code: "DB 00 E6 02 C8 18 ?? DB 40 E6 10", offset: 4},
+		{label: ROMLabelOUTBYTE, code: "C5 0E 08 07 F5 06 2E 38 02 06 8A"},
+		{label: ROMLabelWRHEAD, code: "CD ?? ?? 06 05 C5 01 00 00 0B 78 B1 20 FB C1 10 F4 01 00 02 3E AA"},
+		{label: ROMLabelWRSYN, code: "06 60 3E FF CD ?? ?? 10 FB 3E D3 06 03 CD ?? ?? 10 FB C9"},
+	}
+
+	for i := range patterns {
+		for _, b := range strings.Fields(patterns[i].code) {
+			value := wildcardByte
+			if parsed, err := strconv.ParseUint(b, 16, 8); err == nil {
+				value = int(parsed)
+			}
+			patterns[i].pattern = append(patterns[i].pattern, value)
+		}
+	}
+	return patterns
+}
+
+// find returns the address of the label if the pattern occurs exactly once in the image.
+func (p romPattern) find(data []byte) (uint16, bool) {
+	found := -1
+	for start := 0; start+len(p.pattern) <= len(data); start++ {
+		if !p.matches(data[start : start+len(p.pattern)]) {
+			continue
+		}
+		if found != -1 {
+			return 0, false
+		}
+		found = start
+	}
+
+	if found == -1 {
+		return 0, false
+	}
+	return uint16(found) + p.offset, true
+}
+
+func (p romPattern) matches(data []byte) bool {
+	for i, b := range p.pattern {
+		if b != wildcardByte && byte(b) != data[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// similarity returns the number of bytes that are the same in both images.
+func (r *ROM) similarity(other *ROM) int {
+	same := 0
+	for i := range r.data {
+		if r.data[i] == other.data[i] {
+			same++
+		}
+	}
+	return same
+}
+
+// sameLayout reports whether the image has the same bytes at the given addresses as the other one,
+// which is a sign that it's a modified version of it with the code left in place.
+func (r *ROM) sameLayout(other *ROM, addresses []uint16) bool {
+	for _, address := range addresses {
+		if int(address) >= len(r.data) || r.data[address] != other.data[address] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,382 @@
+package primo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"time"
+
+	"github.com/koron-go/z80"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	snapshotMagic   = "PRIMGOSS"
+	snapshotVersion = 1
+)
+
+var ErrInvalidSnapshot = errors.New("invalid save state")
+
+// Snapshot holds the whole state of the emulated machine at a given moment. The ROM itself is not
+// stored, only its type and fingerprint, as it can not be changed by the machine anyway.
+type Snapshot struct {
+	ROMType        ROMType
+	ROMFingerprint string
+	RAMSize        RAMSize
+	CPU            z80.States
+	LastOpCycles   int // not updated when an interrupt is accepted, so it affects the timing
+	IO             IO
+	RAMInitialized bool
+	FrameCycle     int  // the number of CPU cycles executed in the current frame
+	InitFrames     int  // the number of frames since the RAM was initialized, until typing can start
+	TapeActive     bool // whether the tape was read in the current frame
+	TapeIdle       int  // the number of frames since the tape was last read, until loading is over
+	// PendingPRI is the PRI file waiting for the ROM to initialize the RAM before it's loaded, or nil
+	PendingPRI []byte
+
+	ram           []byte
+	tape          []byte
+	tapeBytePos   int
+	tapeBlockSize uint16
+	// the pulses of the signal are only stored for tape recordings, as the signal of a PTP file is
+	// rendered from it again
+	signal   TapeSignal
+	keyQueue KeyQueue
+	// the files saved on the tape recorder, with their blocks
+	recorded [][][]byte
+}
+
+func TakeSnapshot(
+	cpu *z80.CPU, mem *Memory, io *IO, tape *TapePlayer, signal *TapeSignal, recorder *TapeRecorder,
+	keyQueue *KeyQueue, ramInitialized bool,
+) *Snapshot {
+	s := &Snapshot{
+		ROMType:        mem.ROMType,
+		ROMFingerprint: mem.rom.Fingerprint,
+		RAMSize:        mem.RAMSize,
+		CPU:            cpu.States,
+		LastOpCycles:   cpu.LastOpCycles,
+		IO:             *io,
+		RAMInitialized: ramInitialized,
+		ram:            append([]byte(nil), mem.data[mem.protected:]...),
+		tape:           tape.tape,
+		tapeBytePos:    tape.bytePos,
+		tapeBlockSize:  tape.blockSize,
+		signal:         *signal,
+		keyQueue:       KeyQueue{strokes: slices.Clone(keyQueue.strokes), frame: keyQueue.frame},
+		recorded:       cloneRecorded(recorder.files),
+	}
+	s.IO.Keys = slices.Clone(io.Keys)
+	s.IO.TypedKeys = slices.Clone(io.TypedKeys)
+	if tape.tape != nil {
+		s.signal.pulses = nil
+	}
+	return s
+}
+
+// MatchesROM reports whether the snapshot was taken with the given ROM.
+func (s *Snapshot) MatchesROM(rom *ROM) bool {
+	return rom.Fingerprint == s.ROMFingerprint
+}
+
+// Restore writes the RAM contents into a freshly created memory of the snapshot's ROM type and RAM
+// size, winds the tape and its signal to the saved position, and restores the files saved on the
+// tape recorder and the keystrokes not typed yet.
+func (s *Snapshot) Restore(
+	mem *Memory, tape *TapePlayer, signal *TapeSignal, recorder *TapeRecorder, keyQueue *KeyQueue,
+) error {
+	if mem.ROMType != s.ROMType || mem.RAMSize != s.RAMSize || len(s.ram) != len(mem.data)-int(mem.protected) {
+		return fmt.Errorf("%w: RAM does not match the machine model", ErrInvalidSnapshot)
+	}
+	pulses := s.signal.pulses
+	if s.tape != nil {
+		pulses = RenderPTP(s.tape)
+	}
+	if s.signal.pos > len(pulses) {
+		return fmt.Errorf("%w: tape signal position out of range", ErrInvalidSnapshot)
+	}
+
+	copy(mem.data[mem.protected:], s.ram)
+	tape.tape = s.tape
+	tape.bytePos = s.tapeBytePos
+	tape.blockSize = s.tapeBlockSize
+	*signal = s.signal
+	signal.pulses = pulses
+	recorder.files = cloneRecorded(s.recorded)
+	keyQueue.strokes = slices.Clone(s.keyQueue.strokes)
+	keyQueue.frame = s.keyQueue.frame
+	return nil
+}
+
+// cloneRecorded copies the files of a tape recorder, so the snapshot doesn't change when more
+// bytes are recorded.
+func cloneRecorded(files [][][]byte) [][][]byte {
+	var cloned [][][]byte
+	for _, blocks := range files {
+		file := [][]byte{}
+		for _, block := range blocks {
+			file = append(file, slices.Clone(block))
+		}
+		cloned = append(cloned, file)
+	}
+	return cloned
+}
+
+// byteFields, wordFields and boolFields list the parts of the state with the same size, so the
+// encoding and the decoding can walk through them in the same order.
+func (s *Snapshot) byteFields() []*uint8 {
+	c := &s.CPU
+	return []*uint8{
+		&c.AF.Hi, &c.AF.Lo, &c.BC.Hi, &c.BC.Lo, &c.DE.Hi, &c.DE.Lo, &c.HL.Hi, &c.HL.Lo,
+		&c.Alternate.AF.Hi, &c.Alternate.AF.Lo, &c.Alternate.BC.Hi, &c.Alternate.BC.Lo,
+		&c.Alternate.DE.Hi, &c.Alternate.DE.Lo, &c.Alternate.HL.Hi, &c.Alternate.HL.Lo,
+		&c.IR.Hi, &c.IR.Lo,
+	}
+}
+
+func (s *Snapshot) wordFields() []*uint16 {
+	return []*uint16{&s.CPU.IX, &s.CPU.IY, &s.CPU.SP, &s.CPU.PC, &s.tapeBlockSize}
+}
+
+func (s *Snapshot) boolFields() []*bool {
+	return []*bool{
+		&s.CPU.IFF1, &s.CPU.IFF2, &s.CPU.HALT, &s.CPU.InNMI,
+		&s.IO.NMIEnabled, &s.IO.NMINext, &s.IO.PrimaryVideo, &s.IO.Speaker, &s.IO.VBlank,
+		&s.IO.Reset, &s.IO.TapeIn, &s.IO.TapeMotor, &s.IO.joystickClock,
+		&s.RAMInitialized, &s.signal.level, &s.TapeActive,
+	}
+}
+
+// Encode serializes the snapshot into a binary format starting with a magic string and a version
+// number, and ending with a CRC32 checksum of everything before it. Numbers are little-endian.
+func (s *Snapshot) Encode() []byte {
+	data := []byte(snapshotMagic)
+	data = binary.LittleEndian.AppendUint16(data, snapshotVersion)
+
+	data = append(data, byte(len(s.ROMType)))
+	data = append(data, s.ROMType...)
+	for _, r := range s.byteFields() {
+		data = append(data, *r)
+	}
+	for _, r := range s.wordFields() {
+		data = binary.LittleEndian.AppendUint16(data, *r)
+	}
+	for _, f := range s.boolFields() {
+		data = appendBool(data, *f)
+	}
+	data = append(data, byte(s.CPU.IM))
+	data = append(data, byte(s.LastOpCycles))
+	data = append(data, byte(len(s.IO.Keys)))
+	data = append(data, s.IO.Keys...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(s.ram)))
+	data = append(data, s.ram...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(s.tape)))
+	data = append(data, s.tape...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(s.tapeBytePos))
+	data = binary.LittleEndian.AppendUint32(data, uint32(s.FrameCycle))
+	data = append(data, byte(s.IO.Joysticks[0]), byte(s.IO.Joysticks[1]), byte(s.IO.joystickSelect))
+	data = binary.LittleEndian.AppendUint32(data, uint32(s.IO.joystickIdle))
+	data = append(data, byte(s.RAMSize))
+	data = append(data, byte(len(s.ROMFingerprint)))
+	data = append(data, s.ROMFingerprint...)
+	data = s.appendInput(data)
+
+	return binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+}
+
+// appendInput appends the state of the tape signal, of the keyboard typing, of the tape loading and
+// saving, and the PRI file waiting to be loaded.
+func (s *Snapshot) appendInput(data []byte) []byte {
+	data = appendPulses(data, s.signal.pulses)
+	data = binary.LittleEndian.AppendUint32(data, uint32(s.signal.pos))
+	data = binary.LittleEndian.AppendUint64(data, uint64(s.signal.elapsed))
+	data = binary.LittleEndian.AppendUint64(data, uint64(s.signal.nanos))
+
+	data = append(data, byte(len(s.IO.TypedKeys)))
+	data = append(data, s.IO.TypedKeys...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(s.keyQueue.strokes)))
+	for _, stroke := range s.keyQueue.strokes {
+		data = append(data, byte(len(stroke)))
+		data = append(data, stroke...)
+	}
+	data = append(data, byte(s.keyQueue.frame))
+	data = binary.LittleEndian.AppendUint32(data, uint32(s.InitFrames))
+
+	data = binary.LittleEndian.AppendUint32(data, uint32(s.TapeIdle))
+	data = appendBool(data, s.PendingPRI != nil)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(s.PendingPRI)))
+	data = append(data, s.PendingPRI...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(s.recorded)))
+	for _, blocks := range s.recorded {
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(blocks)))
+		for _, block := range blocks {
+			data = binary.LittleEndian.AppendUint32(data, uint32(len(block)))
+			data = append(data, block...)
+		}
+	}
+	return data
+}
+
+// appendPulses appends the pulses of a tape signal. They are stored in nanoseconds on 64 bits, as
+// the silences of tape recordings can be longer than what fits in 32 bits.
+func appendPulses(data []byte, pulses []time.Duration) []byte {
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(pulses)))
+	for _, pulse := range pulses {
+		data = binary.LittleEndian.AppendUint64(data, uint64(pulse))
+	}
+	return data
+}
+
+func appendBool(data []byte, b bool) []byte {
+	if b {
+		return append(data, 1)
+	}
+	return append(data, 0)
+}
+
+// DecodeSnapshot parses a snapshot created by Encode.
+func DecodeSnapshot(data []byte) (*Snapshot, error) {
+	if len(data) < len(snapshotMagic)+6 || string(data[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, fmt.Errorf("%w: missing header", ErrInvalidSnapshot)
+	}
+
+	payload, checksum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidSnapshot)
+	}
+
+	r := &snapshotReader{data: payload, pos: len(snapshotMagic)}
+	version := r.readUint16()
+	if version != snapshotVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidSnapshot, version)
+	}
+
+	s := &Snapshot{}
+	s.read(r)
+
+	if r.err != nil || r.pos != len(payload) {
+		return nil, fmt.Errorf("%w: unexpected size", ErrInvalidSnapshot)
+	}
+	if !s.ROMType.Validate() || !s.RAMSize.Validate() || s.tapeBytePos > len(s.tape) {
+		return nil, fmt.Errorf("%w: invalid machine state", ErrInvalidSnapshot)
+	}
+	if s.PendingPRI != nil {
+		if _, err := ParsePRI(s.PendingPRI); err != nil {
+			return nil, fmt.Errorf("%w: invalid PRI file waiting to be loaded", ErrInvalidSnapshot)
+		}
+	}
+
+	return s, nil
+}
+
+// read decodes the fields in the same order as Encode appends them.
+func (s *Snapshot) read(r *snapshotReader) {
+	s.ROMType = ROMType(r.readBytes(int(r.readUint8())))
+	for _, reg := range s.byteFields() {
+		*reg = r.readUint8()
+	}
+	for _, reg := range s.wordFields() {
+		*reg = r.readUint16()
+	}
+	for _, f := range s.boolFields() {
+		*f = r.readUint8() != 0
+	}
+	s.CPU.IM = int(r.readUint8())
+	s.LastOpCycles = int(r.readUint8())
+	s.IO.Keys = r.readBytes(int(r.readUint8()))
+	s.ram = r.readBytes(int(r.readUint32()))
+	s.tape = r.readBytes(int(r.readUint32()))
+	s.tapeBytePos = int(r.readUint32())
+	s.FrameCycle = int(r.readUint32())
+	s.IO.Joysticks = [2]Joystick{Joystick(r.readUint8()), Joystick(r.readUint8())}
+	s.IO.joystickSelect = int(r.readUint8())
+	s.IO.joystickIdle = time.Duration(r.readUint32())
+	s.RAMSize = RAMSize(r.readUint8())
+	s.ROMFingerprint = string(r.readBytes(int(r.readUint8())))
+	s.readInput(r)
+}
+
+func (s *Snapshot) readInput(r *snapshotReader) {
+	s.signal.pulses = r.readPulses()
+	s.signal.pos = int(r.readUint32())
+	s.signal.elapsed = time.Duration(r.readUint64())
+	s.signal.nanos = int64(r.readUint64())
+
+	s.IO.TypedKeys = r.readBytes(int(r.readUint8()))
+	strokes := int(r.readUint32())
+	for i := 0; i < strokes && r.err == nil; i++ {
+		s.keyQueue.strokes = append(s.keyQueue.strokes, r.readBytes(int(r.readUint8())))
+	}
+	s.keyQueue.frame = int(r.readUint8())
+	s.InitFrames = int(r.readUint32())
+
+	s.TapeIdle = int(r.readUint32())
+	hasPRI := r.readUint8() != 0
+	if pri := r.readBytes(int(r.readUint32())); hasPRI {
+		s.PendingPRI = append([]byte{}, pri...)
+	}
+	files := int(r.readUint32())
+	for i := 0; i < files && r.err == nil; i++ {
+		file := [][]byte{}
+		blocks := int(r.readUint32())
+		for j := 0; j < blocks && r.err == nil; j++ {
+			file = append(file, r.readBytes(int(r.readUint32())))
+		}
+		s.recorded = append(s.recorded, file)
+	}
+}
+
+// snapshotReader reads consecutive values from a snapshot, remembering if it ran out of data.
+type snapshotReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *snapshotReader) readBytes(n int) []byte {
+	if r.err != nil || r.pos+n > len(r.data) {
+		r.err = ErrInvalidSnapshot
+		return nil
+	}
+	r.pos += n
+	return append([]byte(nil), r.data[r.pos-n:r.pos]...)
+}
+
+func (r *snapshotReader) readUint8() uint8 {
+	if b := r.readBytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *snapshotReader) readUint16() uint16 {
+	if b := r.readBytes(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *snapshotReader) readUint32() uint32 {
+	if b := r.readBytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *snapshotReader) readUint64() uint64 {
+	if b := r.readBytes(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+// readPulses reads the pulses of a tape signal appended by appendPulses.
+func (r *snapshotReader) readPulses() []time.Duration {
+	var pulses []time.Duration
+	count := int(r.readUint32())
+	for i := 0; i < count && r.err == nil; i++ {
+		pulses = append(pulses, time.Duration(r.readUint64()))
+	}
+	return pulses
+}
@@ -0,0 +1,118 @@
+package primo
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testSnapshot returns a snapshot with most of its fields set, playing a tape of the given pulses.
+func testSnapshot(pulses []time.Duration) *Snapshot {
+	s := &Snapshot{
+		ROMType:        ROMTypeA,
+		ROMFingerprint: "fingerprint",
+		RAMSize:        RAMSize48K,
+		LastOpCycles:   11,
+		RAMInitialized: true,
+		FrameCycle:     1234,
+		InitFrames:     56,
+		TapeActive:     true,
+		TapeIdle:       3,
+		PendingPRI:     []byte{priEndBlock},
+		ram:            []byte{1, 2, 3, 4},
+		signal:         TapeSignal{pulses: pulses, pos: 1, elapsed: 250 * time.Millisecond, nanos: 7, level: true},
+		keyQueue:       KeyQueue{strokes: [][]uint8{{1, 2}, {3}}, frame: 2},
+		recorded:       [][][]byte{{{0x83, 0x01}, {0xf1, 0x02, 0x03}}, {}},
+	}
+	s.CPU.AF.Hi = 0x12
+	s.CPU.IR.Lo = 0x34
+	s.CPU.PC = 0x5678
+	s.CPU.SP = 0xfff0
+	s.CPU.IFF1 = true
+	s.CPU.IM = 1
+	s.IO.Keys = []uint8{5, 6}
+	s.IO.TypedKeys = []uint8{7}
+	s.IO.NMIEnabled = true
+	s.IO.Joysticks = [2]Joystick{1, 2}
+	return s
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		pulses []time.Duration
+	}{
+		{"no signal", nil},
+		{"short pulses", []time.Duration{bitOneMark, bitOneSpace, bitZeroMark, bitZeroSpace}},
+		{"long silence", []time.Duration{6 * time.Second, bitOneMark, time.Hour}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := testSnapshot(test.pulses)
+			decoded, err := DecodeSnapshot(s.Encode())
+			if err != nil {
+				t.Fatalf("DecodeSnapshot() error = %v", err)
+			}
+			if !reflect.DeepEqual(decoded, s) {
+				t.Errorf("DecodeSnapshot() = %+v, want %+v", decoded, s)
+			}
+
+			_, wantLength := s.signal.Position()
+			if _, length := decoded.signal.Position(); length != wantLength {
+				t.Errorf("tape length = %v, want %v", length, wantLength)
+			}
+		})
+	}
+}
+
+func TestDecodeSnapshotInvalid(t *testing.T) {
+	data := testSnapshot(nil).Encode()
+	corrupt := append([]byte(nil), data...)
+	corrupt[len(snapshotMagic)+4] ^= 0xff
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"wrong magic", append([]byte("PRIMGOMV"), data[len(snapshotMagic):]...)},
+		{"checksum mismatch", corrupt},
+		{"truncated", data[:len(data)/2]},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := DecodeSnapshot(test.data); !errors.Is(err, ErrInvalidSnapshot) {
+				t.Errorf("DecodeSnapshot() error = %v, want %v", err, ErrInvalidSnapshot)
+			}
+		})
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	s := testSnapshot([]time.Duration{bitOneMark, bitOneSpace})
+	mem := NewMemory(BuiltInROM(ROMTypeA), RAMSize48K)
+	s.ram = make([]byte, len(mem.data)-int(mem.protected))
+	recorder := NewTapeRecorder()
+	recorder.StartFile()
+	recorder.RecordByte(0xff)
+	keyQueue := NewKeyQueue()
+
+	if err := s.Restore(mem, NewTapePlayer(), NewTapeSignal(), recorder, keyQueue); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if !reflect.DeepEqual(recorder.files, s.recorded) {
+		t.Errorf("recorded files = %v, want %v", recorder.files, s.recorded)
+	}
+	if !reflect.DeepEqual(keyQueue.strokes, s.keyQueue.strokes) {
+		t.Errorf("queued keystrokes = %v, want %v", keyQueue.strokes, s.keyQueue.strokes)
+	}
+
+	// the restored files are copies, changing them doesn't change the snapshot
+	recorder.files[0][1][0] = 0
+	if s.recorded[0][1][0] != 0xf1 {
+		t.Errorf("snapshot changed with the tape recorder, recorded files = %v", s.recorded)
+	}
+}
@@ -0,0 +1,124 @@
+package primo
+
+import (
+	"math"
+)
+
+const (
+	// amplitude of the speaker output in 16bit PCM
+	speakerAmplitude = 0x4000
+	// number of fractional sample positions a level change can be placed at
+	blepPhases = 32
+	// length of a band-limited step in output samples
+	blepTaps = 16
+	// the steps don't contain anything above this fraction of the sample rate, which keeps the
+	// high-pitched tones from aliasing
+	blepCutoff = 0.45
+	// the speaker can't follow fast changes, and it doesn't move at all for a constant level
+	speakerLowPassHz  = 6000
+	speakerHighPassHz = 30
+)
+
+// Speaker renders the level changes of the PRIMO's speaker into audio samples. Every change is
+// placed at its exact time as a band-limited step, and the result is filtered like the response of
+// a small speaker.
+type Speaker struct {
+	kernel  [blepPhases][blepTaps]float64
+	pending [blepTaps + 1]float64
+	time    float64
+	level   bool
+	output  float64
+	lowPass float64
+	dcLevel float64
+	samples []int16
+}
+
+func NewSpeaker() *Speaker {
+	s := &Speaker{}
+	s.buildKernel()
+	return s
+}
+
+// buildKernel creates the band-limited steps for every phase from a windowed sinc impulse, each
+// phase summing up to exactly one, so a step always settles at the new level.
+func (s *Speaker) buildKernel() {
+	for phase := 0; phase < blepPhases; phase++ {
+		sum := 0.0
+		for tap := 0; tap < blepTaps; tap++ {
+			// distance from the center of the impulse in samples
+			x := float64(tap) - blepTaps/2 + 1 - float64(phase)/blepPhases
+			window := 0.42 + 0.5*math.Cos(math.Pi*x/(blepTaps/2)) + 0.08*math.Cos(2*math.Pi*x/(blepTaps/2))
+			if math.Abs(x) >= blepTaps/2 {
+				window = 0
+			}
+			s.kernel[phase][tap] = sinc(2*blepCutoff*x) * window
+			sum += s.kernel[phase][tap]
+		}
+		for tap := 0; tap < blepTaps; tap++ {
+			s.kernel[phase][tap] /= sum
+		}
+	}
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// Set changes the level of the speaker at the current time.
+func (s *Speaker) Set(high bool) {
+	if high == s.level {
+		return
+	}
+	s.level = high
+
+	delta := float64(speakerAmplitude)
+	if !high {
+		delta = -delta
+	}
+
+	// the step starts between two samples, so it's spread over the following ones
+	phase := int(s.time * blepPhases)
+	for tap := 0; tap < blepTaps; tap++ {
+		s.pending[tap+1] += delta * s.kernel[phase][tap]
+	}
+}
+
+// Advance moves the time forward by the given number of CPU cycles, and renders the samples that
+// can't be affected by later level changes anymore.
+func (s *Speaker) Advance(cycles, clockSpeed, sampleRate int) {
+	if clockSpeed == 0 || sampleRate == 0 {
+		return
+	}
+
+	s.time += float64(cycles) * float64(sampleRate) / float64(clockSpeed)
+	for s.time >= 1 {
+		s.time--
+		s.output += s.pending[0]
+		copy(s.pending[:], s.pending[1:])
+		s.pending[len(s.pending)-1] = 0
+		s.samples = append(s.samples, s.filter(sampleRate))
+	}
+}
+
+// filter applies the low-pass response of the speaker, and removes the constant part of the signal
+// which the speaker can't reproduce.
+func (s *Speaker) filter(sampleRate int) int16 {
+	s.lowPass += (s.output - s.lowPass) * onePoleCoefficient(speakerLowPassHz, sampleRate)
+	s.dcLevel += (s.lowPass - s.dcLevel) * onePoleCoefficient(speakerHighPassHz, sampleRate)
+	return int16(math.Max(math.Min(s.lowPass-s.dcLevel, math.MaxInt16), math.MinInt16))
+}
+
+// onePoleCoefficient returns the smoothing factor of a one-pole low-pass filter.
+func onePoleCoefficient(cutoff float64, sampleRate int) float64 {
+	return 1 - math.Exp(-2*math.Pi*cutoff/float64(sampleRate))
+}
+
+// Samples returns the samples rendered since the last call.
+func (s *Speaker) Samples() []int16 {
+	samples := s.samples
+	s.samples = nil
+	return samples
+}
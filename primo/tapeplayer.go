@@ -26,6 +26,16 @@ func (t *TapePlayer) Reset() {
 	t.blockSize = 0
 }
 
+// Tape returns the PTP file in the tape player.
+func (t *TapePlayer) Tape() []byte {
+	return t.tape
+}
+
+// Position returns the offset of the next byte to read, and the length of the PTP file.
+func (t *TapePlayer) Position() (int, int) {
+	return t.bytePos, len(t.tape)
+}
+
 func (t *TapePlayer) readBlockHeader() bool {
 	// we can just skip the PTP header
 	if t.tape[t.bytePos] == ptpHeader {
@@ -0,0 +1,73 @@
+package primo
+
+// TapeRecorder collects the blocks written by the ROM's tape saving routines, and encodes them
+// into a PTP file.
+type TapeRecorder struct {
+	files [][][]byte
+}
+
+func NewTapeRecorder() *TapeRecorder {
+	return &TapeRecorder{}
+}
+
+func (t *TapeRecorder) Reset() {
+	t.files = nil
+}
+
+func (t *TapeRecorder) Empty() bool {
+	return len(t.files) == 0
+}
+
+// StartFile starts a new file on the tape, every following block will belong to it.
+func (t *TapeRecorder) StartFile() {
+	t.files = append(t.files, nil)
+}
+
+// StartBlock starts a new block in the current file.
+func (t *TapeRecorder) StartBlock() {
+	if len(t.files) == 0 {
+		t.StartFile()
+	}
+	t.files[len(t.files)-1] = append(t.files[len(t.files)-1], []byte{})
+}
+
+func (t *TapeRecorder) RecordByte(b byte) {
+	// bytes written without a sync sequence first would not be readable anyway
+	if len(t.files) == 0 || len(t.files[len(t.files)-1]) == 0 {
+		return
+	}
+
+	blocks := t.files[len(t.files)-1]
+	blocks[len(blocks)-1] = append(blocks[len(blocks)-1], b)
+}
+
+func appendWord(data []byte, w int) []byte {
+	return append(data, byte(w), byte(w>>8))
+}
+
+// PTP encodes the recorded files into the PTP format. Every file starts with a header containing
+// the size of the file, and the last block of a file is marked as a closing block.
+func (t *TapeRecorder) PTP() []byte {
+	var ptp []byte
+	for _, blocks := range t.files {
+		if len(blocks) == 0 {
+			continue
+		}
+
+		var file []byte
+		for i, block := range blocks {
+			header := byte(dataBlockHeader)
+			if i == len(blocks)-1 {
+				header = closingBlockHeader
+			}
+			file = append(file, header)
+			file = appendWord(file, len(block))
+			file = append(file, block...)
+		}
+
+		ptp = append(ptp, ptpHeader)
+		ptp = appendWord(ptp, len(file)+3)
+		ptp = append(ptp, file...)
+	}
+	return ptp
+}
@@ -2,6 +2,9 @@ package tapes
 
 import (
 	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
 )
 
 //go:embed *.ptp
@@ -15,3 +18,24 @@ func ByName(name string) []byte {
 
 	return data
 }
+
+// Lookup returns the built-in tape with the given name, or false if there is no such tape.
+func Lookup(name string) ([]byte, bool) {
+	data, err := tapeFS.ReadFile(name)
+	return data, err == nil
+}
+
+// ReadFile reads a tape file, falling back to the built-in tape with the same name if there is no
+// such file. It returns the base name of the tape along with its contents.
+func ReadFile(name string) (string, []byte, error) {
+	data, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		if builtIn, ok := Lookup(name); ok {
+			return name, builtIn, nil
+		}
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot read tape: %w", err)
+	}
+	return filepath.Base(name), data, nil
+}
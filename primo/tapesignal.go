@@ -0,0 +1,147 @@
+package primo
+
+import (
+	"time"
+)
+
+// Every bit written by the ROM consists of a positive mark, when the input reads low, and a space,
+// when the input returns to its idle high level. The lengths are the ones measured from the ROM's
+// writing routine at the original clock speed.
+const (
+	bitOneMark    = 318 * time.Microsecond
+	bitOneSpace   = 376 * time.Microsecond
+	bitZeroMark   = 944 * time.Microsecond
+	bitZeroSpace  = 1002 * time.Microsecond
+	leaderLength  = 512
+	leaderByte    = 0xaa
+	syncLength    = 96
+	syncByte      = 0xff
+	syncEndLength = 3
+	syncEndByte   = 0xd3
+	fileGap       = time.Second
+)
+
+// TapeSignal plays back a cassette signal as a series of pulses. The signal starts at the idle high
+// level, and flips at the end of every pulse. After the last pulse it returns to the idle level.
+type TapeSignal struct {
+	pulses  []time.Duration
+	pos     int
+	elapsed time.Duration
+	nanos   int64
+	level   bool
+}
+
+func NewTapeSignal() *TapeSignal {
+	return &TapeSignal{}
+}
+
+func (t *TapeSignal) ChangePulses(pulses []time.Duration) {
+	t.pulses = pulses
+	t.Reset()
+}
+
+func (t *TapeSignal) Reset() {
+	t.pos = 0
+	t.elapsed = 0
+	t.nanos = 0
+	t.level = true
+}
+
+// Advance moves the tape forward by the time it takes to execute the given number of CPU cycles.
+func (t *TapeSignal) Advance(cycles, clockSpeed int) {
+	if t.pos >= len(t.pulses) || clockSpeed == 0 {
+		return
+	}
+
+	// keep the remainder of the division, so the tape speed is exact at every clock speed
+	t.nanos += int64(cycles) * int64(time.Second)
+	t.elapsed += time.Duration(t.nanos / int64(clockSpeed))
+	t.nanos %= int64(clockSpeed)
+
+	for t.pos < len(t.pulses) && t.elapsed >= t.pulses[t.pos] {
+		t.elapsed -= t.pulses[t.pos]
+		t.pos++
+	}
+	t.level = t.pos%2 == 0 || t.pos == len(t.pulses)
+}
+
+// Playing reports whether there are pulses left to play.
+func (t *TapeSignal) Playing() bool {
+	return t.pos < len(t.pulses)
+}
+
+func (t *TapeSignal) Pulses() []time.Duration {
+	return t.pulses
+}
+
+// Position returns the time played from the signal, and its whole length.
+func (t *TapeSignal) Position() (time.Duration, time.Duration) {
+	var played, length time.Duration
+	for i, pulse := range t.pulses {
+		if i < t.pos {
+			played += pulse
+		}
+		length += pulse
+	}
+	if t.pos < len(t.pulses) {
+		played += t.elapsed
+	}
+	return played, length
+}
+
+func (t *TapeSignal) Level() bool {
+	return t.level
+}
+
+func appendBytePulses(pulses []time.Duration, b byte, count int) []time.Duration {
+	for n := 0; n < count; n++ {
+		// bits are written starting with the most significant one
+		for bit := 7; bit >= 0; bit-- {
+			if b&(1<<bit) != 0 {
+				pulses = append(pulses, bitOneMark, bitOneSpace)
+			} else {
+				pulses = append(pulses, bitZeroMark, bitZeroSpace)
+			}
+		}
+	}
+	return pulses
+}
+
+func appendBlockPulses(pulses []time.Duration, block []byte) []time.Duration {
+	pulses = appendBytePulses(pulses, syncByte, syncLength)
+	pulses = appendBytePulses(pulses, syncEndByte, syncEndLength)
+	for _, b := range block {
+		pulses = appendBytePulses(pulses, b, 1)
+	}
+	return pulses
+}
+
+// RenderPTP converts a PTP file into the signal the ROM would have written to the tape: every file
+// starts with some silence and a leader, and every block starts with a sync sequence.
+func RenderPTP(ptp []byte) []time.Duration {
+	// every byte ends at the idle level, so silence can be added by extending the last pulse
+	pulses := []time.Duration{0}
+
+	for pos := 0; pos+3 <= len(ptp); {
+		switch ptp[pos] {
+		case ptpHeader:
+			pulses[len(pulses)-1] += fileGap
+			pulses = appendBytePulses(pulses, leaderByte, leaderLength)
+			pos += 3
+		case dataBlockHeader, closingBlockHeader:
+			size := int(ptp[pos+1]) | int(ptp[pos+2])<<8
+			end := pos + 3 + size
+			if end > len(ptp) {
+				return pulses
+			}
+			pulses = appendBlockPulses(pulses, ptp[pos+3:end])
+			pos = end
+		default:
+			// invalid PTP file
+			return pulses
+		}
+	}
+
+	pulses[len(pulses)-1] += fileGap
+	return pulses
+}
@@ -0,0 +1,101 @@
+package primo
+
+import (
+	"unicode"
+)
+
+// typedKey is the keyboard address of a key, and whether it has to be pressed together with Shift
+// to type a character.
+type typedKey struct {
+	address uint8
+	shift   bool
+}
+
+// letterKeys returns the keys of the letters from "a" to "z".
+func letterKeys() [26]uint8 {
+	return [26]uint8{
+		KeyA, KeyB, KeyC, KeyD, KeyE, KeyF, KeyG, KeyH, KeyI, KeyJ, KeyK, KeyL, KeyM,
+		KeyN, KeyO, KeyP, KeyQ, KeyR, KeyS, KeyT, KeyU, KeyV, KeyW, KeyX, KeyY, KeyZ,
+	}
+}
+
+// digitKeys returns the keys of the digits from "0" to "9".
+func digitKeys() [10]uint8 {
+	return [10]uint8{Key0, Key1, Key2, Key3, Key4, Key5, Key6, Key7, Key8, Key9}
+}
+
+// typedSymbols returns the keys typing the characters other than letters and digits. The "B"
+// version of the ROM places some of the symbols on different keys, and types ő and ű on keys of
+// their own, along with í. The Hungarian accented letters only have lowercase versions on the keys
+// of ó, ő, ú and ű.
+func typedSymbols(romType ROMType) map[rune]typedKey {
+	symbols := map[rune]typedKey{
+		' ': {KeySpace, false}, '\n': {KeyReturn, false},
+		'!': {Key1, true}, '"': {Key2, true}, '#': {Key3, true}, '$': {Key4, true}, '%': {Key5, true},
+		'&': {Key6, true}, '(': {Key8, true}, ')': {Key9, true}, '-': {KeyMinus, false},
+		'.': {KeyPeriod, false}, ',': {KeyComma, false}, '*': {KeyAsterisk, false},
+		'é': {KeyEAcute, false}, 'É': {KeyEAcute, true}, 'á': {KeyAAcute, false}, 'Á': {KeyAAcute, true},
+		'ö': {KeyOUmlaut, false}, 'Ö': {KeyOUmlaut, true}, 'ü': {KeyUUmlaut, false}, 'Ü': {KeyUUmlaut, true},
+		'ó': {KeyOAcute, false}, 'ú': {KeyUAcute, false},
+	}
+
+	layout := map[rune]typedKey{
+		'/': {Key7, true}, '=': {Key0, true}, '+': {KeyPlus, false}, '?': {KeyPlus, true},
+		'>': {KeyGreater, false}, '<': {KeyGreater, true}, ':': {KeyPeriod, true}, ';': {KeyComma, true},
+		'\'': {KeyAsterisk, true}, 'ő': {KeyOAcute, true}, 'ű': {KeyUAcute, true},
+	}
+	if romType == ROMTypeB {
+		layout = map[rune]typedKey{
+			'\'': {Key7, true}, ';': {KeyPlus, false}, '+': {KeyPlus, true}, '/': {KeyGreater, false},
+			'?': {KeyGreater, true}, '=': {KeyMinus, true}, '>': {KeyPeriod, true}, '<': {KeyComma, true},
+			':': {KeyAsterisk, true},
+			'ő': {KeyODoubleAcute, false}, 'ű': {KeyUDoubleAcute, false}, 'í': {KeyIAcute, false},
+		}
+	}
+
+	for r, key := range layout {
+		symbols[r] = key
+	}
+	return symbols
+}
+
+// typedLetterOrDigit returns the key typing a letter or a digit. The letters are lowercase without
+// Shift.
+func typedLetterOrDigit(r rune) (typedKey, bool) {
+	lower := unicode.ToLower(r)
+	switch {
+	case lower >= 'a' && lower <= 'z':
+		return typedKey{letterKeys()[lower-'a'], r != lower}, true
+	case r >= '0' && r <= '9':
+		return typedKey{digitKeys()[r-'0'], false}, true
+	}
+	return typedKey{}, false
+}
+
+// TextKeystrokes converts the text into keystrokes typing it on the keyboard of the given ROM
+// version, ready to be queued on a KeyQueue. Characters without a key are skipped and returned, so
+// the caller can warn about them. Carriage returns are skipped silently, so Windows line endings
+// are typed as a single Return.
+func TextKeystrokes(text string, romType ROMType) (strokes [][]uint8, skipped []rune) {
+	symbols := typedSymbols(romType)
+
+	for _, r := range text {
+		key, ok := typedLetterOrDigit(r)
+		if !ok {
+			key, ok = symbols[r]
+		}
+		if !ok {
+			if r != '\r' {
+				skipped = append(skipped, r)
+			}
+			continue
+		}
+
+		stroke := []uint8{key.address}
+		if key.shift {
+			stroke = append(stroke, KeyShift)
+		}
+		strokes = append(strokes, stroke)
+	}
+	return strokes, skipped
+}
@@ -0,0 +1,38 @@
+package primo_test
+
+import (
+	"reflect"
+	"testing"
+
+	"primgo/primo"
+)
+
+func TestTextKeystrokes(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		romType     primo.ROMType
+		want        [][]uint8
+		wantSkipped []rune
+	}{
+		{"letters and digits", "aZ0\n", primo.ROMTypeA, [][]uint8{{0x0e}, {0x22, 0x03}, {0x25}, {0x37}}, nil},
+		{"windows line ending", "\r\n", primo.ROMTypeA, [][]uint8{{0x37}}, nil},
+		{"accented letters", "őű", primo.ROMTypeA, [][]uint8{{0x3b, 0x03}, {0x33, 0x03}}, nil},
+		{"accented letters on ROM B", "őűí", primo.ROMTypeB, [][]uint8{{0x13}, {0x15}, {0x11}}, nil},
+		{"symbols on ROM B", ";+", primo.ROMTypeB, [][]uint8{{0x23}, {0x23, 0x03}}, nil},
+		{"no key", "~Ő", primo.ROMTypeC, nil, []rune("~Ő")},
+		{"no key in a line", "2^3", primo.ROMTypeA, [][]uint8{{0x0b}, {0x09}}, []rune("^")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, skipped := primo.TextKeystrokes(test.text, test.romType)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("TextKeystrokes(%q) = %v, want %v", test.text, got, test.want)
+			}
+			if !reflect.DeepEqual(skipped, test.wantSkipped) {
+				t.Errorf("TextKeystrokes(%q) skipped %q, want %q", test.text, skipped, test.wantSkipped)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package primo
+
+import (
+	"image"
+)
+
+const (
+	// LinesPerFrame is the number of scanlines in a frame, including the vertical blanking and the
+	// borders.
+	LinesPerFrame = 312
+	// the frame starts with the vertical blanking, which is also when the NMI is triggered
+	vblankLines = 25
+	// the first row of the screen is fetched at this line, after the vertical blanking and the top
+	// border
+	firstDisplayLine = 64
+)
+
+// Video follows the beam of the display through the frame, and fetches every row of the screen from
+// the memory at the moment the beam reaches it. This way changing the screen page, the palette or
+// the screen data while the frame is drawn shows up the same way as on the real machine.
+type Video struct {
+	screen   *image.RGBA
+	drawing  *image.RGBA
+	nextLine int
+}
+
+func NewVideo() *Video {
+	return &Video{
+		screen:  image.NewRGBA(image.Rectangle{Max: image.Point{X: 256, Y: 192}}),
+		drawing: image.NewRGBA(image.Rectangle{Max: image.Point{X: 256, Y: 192}}),
+	}
+}
+
+// BeamLine returns the scanline the beam is on at the given CPU cycle of the frame.
+func BeamLine(frameCycle, frameCycles int) int {
+	return frameCycle * LinesPerFrame / frameCycles
+}
+
+// InVBlank reports whether the scanline is in the vertical blanking interval.
+func InVBlank(line int) bool {
+	return line < vblankLines
+}
+
+// Update fetches every scanline the beam has reached since the last call.
+func (v *Video) Update(mem *Memory, io *IO, line int) {
+	for ; v.nextLine <= line && v.nextLine < LinesPerFrame; v.nextLine++ {
+		if v.nextLine == 0 {
+			v.startFrame(mem, io)
+		}
+
+		row := v.nextLine - firstDisplayLine
+		size := v.drawing.Rect.Size()
+		if row < 0 || row >= size.Y {
+			continue
+		}
+
+		pixels := v.drawing.Pix[row*v.drawing.Stride : (row+1)*v.drawing.Stride]
+		mem.RenderScreenLine(io.screenPage(), size, row, pixels)
+	}
+}
+
+// startFrame picks the resolution of the next frame, which is decided by the screen page displayed
+// at the start of the frame.
+func (v *Video) startFrame(mem *Memory, io *IO) {
+	size := mem.ScreenResolution(io.screenPage())
+	if v.drawing.Rect.Size() != size {
+		v.drawing = image.NewRGBA(image.Rectangle{Max: size})
+	}
+}
+
+// EndFrame fetches the lines not reached by the beam yet, and shows the finished frame.
+func (v *Video) EndFrame(mem *Memory, io *IO) {
+	v.Update(mem, io, LinesPerFrame-1)
+	v.screen, v.drawing = v.drawing, v.screen
+	v.nextLine = 0
+}
+
+// Restart makes the beam fetch every line again from the start of the frame, as the memory changed
+// completely.
+func (v *Video) Restart() {
+	v.nextLine = 0
+}
+
+// Screen returns the last finished frame. It's only valid until the next frame is finished, as the
+// image is reused for drawing.
+func (v *Video) Screen() *image.RGBA {
+	return v.screen
+}
@@ -0,0 +1,129 @@
+package primo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	wavFormatPCM = 1
+
+	// the signal has to cross these fractions of the full scale to count as a level change, this
+	// filters out the noise of recordings made from real tapes
+	wavHysteresis = 0.05
+)
+
+var ErrInvalidWAV = errors.New("invalid WAV file")
+
+type wavFormat struct {
+	channels      int
+	sampleRate    int
+	bitsPerSample int
+}
+
+func parseWAVChunks(data []byte) (wavFormat, []byte, error) {
+	var format wavFormat
+	var samples []byte
+
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return format, nil, fmt.Errorf("%w: missing RIFF header", ErrInvalidWAV)
+	}
+
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		body := data[pos+8 : min(pos+8+size, len(data))]
+
+		switch id {
+		case "fmt ":
+			if len(body) < 16 || binary.LittleEndian.Uint16(body[0:2]) != wavFormatPCM {
+				return format, nil, fmt.Errorf("%w: only PCM files are supported", ErrInvalidWAV)
+			}
+			format.channels = int(binary.LittleEndian.Uint16(body[2:4]))
+			format.sampleRate = int(binary.LittleEndian.Uint32(body[4:8]))
+			format.bitsPerSample = int(binary.LittleEndian.Uint16(body[14:16]))
+		case "data":
+			samples = body
+		}
+
+		// chunks are padded to an even size
+		pos += 8 + size + size%2
+	}
+
+	if format.sampleRate == 0 || format.channels == 0 || samples == nil {
+		return format, nil, fmt.Errorf("%w: missing format or data chunk", ErrInvalidWAV)
+	}
+	if format.bitsPerSample != 8 && format.bitsPerSample != 16 {
+		return format, nil, fmt.Errorf("%w: %d bit samples are not supported", ErrInvalidWAV,
+			format.bitsPerSample)
+	}
+
+	return format, samples, nil
+}
+
+// sample returns the n-th sample of the first channel normalized to the -1..1 range.
+func (f wavFormat) sample(samples []byte, n int) float64 {
+	if f.bitsPerSample == 8 {
+		return (float64(samples[n*f.channels]) - 128) / 128
+	}
+	pos := n * f.channels * 2
+	return float64(int16(binary.LittleEndian.Uint16(samples[pos:pos+2]))) / 32768
+}
+
+// DecodeWAV converts a recording of a tape into a series of pulses for TapeSignal, by finding the
+// points where the signal crosses zero. Like on the real hardware the input reads low while the
+// signal is positive, and high otherwise.
+func DecodeWAV(data []byte) ([]time.Duration, error) {
+	format, samples, err := parseWAVChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	sampleCount := len(samples) / (format.channels * format.bitsPerSample / 8)
+	sampleLength := time.Second / time.Duration(format.sampleRate)
+
+	var pulses []time.Duration
+	var length time.Duration
+	high := true
+	for n := 0; n < sampleCount; n++ {
+		length += sampleLength
+
+		v := format.sample(samples, n)
+		if (high && v > wavHysteresis) || (!high && v < -wavHysteresis) {
+			pulses = append(pulses, length)
+			length = 0
+			high = !high
+		}
+	}
+
+	return append(pulses, length), nil
+}
+
+// EncodeWAV creates a 16bit mono PCM WAV file from the samples.
+func EncodeWAV(samples []int16, sampleRate int) []byte {
+	const bytesPerSample = 2
+	dataSize := len(samples) * bytesPerSample
+
+	wav := make([]byte, 0, 44+dataSize)
+	wav = append(wav, "RIFF"...)
+	wav = binary.LittleEndian.AppendUint32(wav, uint32(36+dataSize))
+	wav = append(wav, "WAVE"...)
+
+	wav = append(wav, "fmt "...)
+	wav = binary.LittleEndian.AppendUint32(wav, 16)
+	wav = binary.LittleEndian.AppendUint16(wav, wavFormatPCM)
+	wav = binary.LittleEndian.AppendUint16(wav, 1)
+	wav = binary.LittleEndian.AppendUint32(wav, uint32(sampleRate))
+	wav = binary.LittleEndian.AppendUint32(wav, uint32(sampleRate*bytesPerSample))
+	wav = binary.LittleEndian.AppendUint16(wav, bytesPerSample)
+	wav = binary.LittleEndian.AppendUint16(wav, bytesPerSample*8)
+
+	wav = append(wav, "data"...)
+	wav = binary.LittleEndian.AppendUint32(wav, uint32(dataSize))
+	for _, smp := range samples {
+		wav = binary.LittleEndian.AppendUint16(wav, uint16(smp))
+	}
+	return wav
+}
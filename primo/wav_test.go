@@ -0,0 +1,109 @@
+package primo_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"primgo/primo"
+)
+
+// wavFile creates a PCM WAV file of 1000 samples per second.
+func wavFile(samples []byte, channels, bits int) []byte {
+	blockAlign := channels * bits / 8
+	wav := []byte("RIFF")
+	wav = binary.LittleEndian.AppendUint32(wav, uint32(36+len(samples)))
+	wav = append(wav, "WAVEfmt "...)
+	wav = binary.LittleEndian.AppendUint32(wav, 16)
+	wav = binary.LittleEndian.AppendUint16(wav, 1)
+	wav = binary.LittleEndian.AppendUint16(wav, uint16(channels))
+	wav = binary.LittleEndian.AppendUint32(wav, 1000)
+	wav = binary.LittleEndian.AppendUint32(wav, uint32(1000*blockAlign))
+	wav = binary.LittleEndian.AppendUint16(wav, uint16(blockAlign))
+	wav = binary.LittleEndian.AppendUint16(wav, uint16(bits))
+	wav = append(wav, "data"...)
+	wav = binary.LittleEndian.AppendUint32(wav, uint32(len(samples)))
+	return append(wav, samples...)
+}
+
+// wav16 creates a 16 bit mono WAV file.
+func wav16(samples []int16) []byte {
+	var data []byte
+	for _, sample := range samples {
+		data = binary.LittleEndian.AppendUint16(data, uint16(sample))
+	}
+	return wavFile(data, 1, 16)
+}
+
+func TestDecodeWAV(t *testing.T) {
+	const ms = time.Millisecond
+
+	silence := make([]int16, 6000)
+	tests := []struct {
+		name string
+		data []byte
+		want []time.Duration
+	}{
+		{
+			"16 bit",
+			wav16([]int16{0, 0, 0, 10000, 10000, -10000, -10000, -10000, -10000}),
+			[]time.Duration{4 * ms, 2 * ms, 3 * ms},
+		},
+		{
+			"noise below the hysteresis",
+			wav16([]int16{0, 1000, -1000, 10000, 1000, -1000, -10000}),
+			[]time.Duration{4 * ms, 3 * ms, 0},
+		},
+		{
+			"long silence",
+			wav16(append(silence, 10000)),
+			[]time.Duration{6001 * ms, 0},
+		},
+		{
+			"8 bit stereo, only the first channel is used",
+			wavFile([]byte{128, 255, 255, 0, 255, 0, 0, 255}, 2, 8),
+			[]time.Duration{2 * ms, 2 * ms, 0},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pulses, err := primo.DecodeWAV(test.data)
+			if err != nil {
+				t.Fatalf("DecodeWAV() error = %v", err)
+			}
+			if !reflect.DeepEqual(pulses, test.want) {
+				t.Errorf("DecodeWAV() = %v, want %v", pulses, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeWAVInvalid(t *testing.T) {
+	wav := wav16([]int16{0})
+	float := append([]byte(nil), wav...)
+	float[20] = 3
+	bits := append([]byte(nil), wav...)
+	bits[34] = 24
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"not RIFF", append([]byte("RIFX"), wav[4:]...)},
+		{"missing data chunk", wav[:36]},
+		{"not PCM", float},
+		{"24 bit", bits},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := primo.DecodeWAV(test.data); !errors.Is(err, primo.ErrInvalidWAV) {
+				t.Errorf("DecodeWAV() error = %v, want %v", err, primo.ErrInvalidWAV)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+
+	"primgo/primo/disasm"
+)
+
+// stopProfiling stops the profiler, prints the hotspots and the cycles of the ROM routines on the
+// terminal, and returns the profile in the callgrind format.
+func (e *Emulator) stopProfiling() []byte {
+	p := e.machine.Profiler().Stop()
+	if p == nil {
+		return nil
+	}
+
+	symbols := disasm.ROMSymbols(e.machine.Memory().ROM())
+	if err := p.WriteReport(os.Stdout, e.machine.Memory(), symbols); err != nil {
+		log.Printf("Error printing profile: %s\n", err.Error())
+	}
+
+	var callgrind bytes.Buffer
+	if err := p.WriteCallgrind(&callgrind, symbols); err != nil {
+		log.Printf("Error saving profile: %s\n", err.Error())
+		return nil
+	}
+	return callgrind.Bytes()
+}
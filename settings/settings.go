@@ -8,27 +8,59 @@ import (
 	"path/filepath"
 )
 
-func storagePath() string {
-	return filepath.Join(localConfigDir(), "primgo", "settings.json")
+// Store saves the settings into a JSON file, and other files next to it.
+type Store struct {
+	path string
 }
 
-func Save(data string) error {
-	path := storagePath()
-	err := os.MkdirAll(filepath.Dir(path), 0777)
+// NewStore creates a store using the settings file at the given path, or at the default location
+// in the user's config directory if the path is empty.
+func NewStore(path string) *Store {
+	if path == "" {
+		path = filepath.Join(localConfigDir(), "primgo", "settings.json")
+	}
+	return &Store{path: path}
+}
+
+func (s *Store) Save(data string) error {
+	err := os.MkdirAll(filepath.Dir(s.path), 0777)
 	if err != nil {
 		return fmt.Errorf("cannot create settings directories: %w", err)
 	}
-	err = os.WriteFile(path, []byte(data), 0600)
+	err = os.WriteFile(s.path, []byte(data), 0600)
 	if err != nil {
 		return fmt.Errorf("cannot write settings file: %w", err)
 	}
 	return nil
 }
 
-func Load() (string, error) {
-	data, err := os.ReadFile(storagePath())
+func (s *Store) Load() (string, error) {
+	data, err := os.ReadFile(s.path)
 	if err != nil && !os.IsNotExist(err) {
 		return "", fmt.Errorf("cannot read settings file: %w", err)
 	}
 	return string(data), nil
 }
+
+// SaveFile stores binary data next to the settings file.
+func (s *Store) SaveFile(name string, data []byte) error {
+	path := filepath.Join(filepath.Dir(s.path), name)
+	err := os.MkdirAll(filepath.Dir(path), 0777)
+	if err != nil {
+		return fmt.Errorf("cannot create settings directories: %w", err)
+	}
+	err = os.WriteFile(path, data, 0600)
+	if err != nil {
+		return fmt.Errorf("cannot write %s: %w", name, err)
+	}
+	return nil
+}
+
+// LoadFile reads data stored by SaveFile, a missing file results in no data without an error.
+func (s *Store) LoadFile(name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(s.path), name))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("cannot read %s: %w", name, err)
+	}
+	return data, nil
+}
@@ -1,16 +1,52 @@
 package settings
 
 import (
+	"encoding/base64"
+	"fmt"
 	"syscall/js"
 )
 
-const key = "primgodata"
+const defaultKey = "primgodata"
 
-func Save(data string) error {
-	js.Global().Get("localStorage").Call("setItem", key, data)
+// Store saves the settings into the local storage of the browser, and other data under keys
+// prefixed by the key of the settings.
+type Store struct {
+	key string
+}
+
+// NewStore creates a store using the given local storage key, or the default one if it's empty.
+func NewStore(key string) *Store {
+	if key == "" {
+		key = defaultKey
+	}
+	return &Store{key: key}
+}
+
+func (s *Store) Save(data string) error {
+	js.Global().Get("localStorage").Call("setItem", s.key, data)
+	return nil
+}
+
+func (s *Store) Load() (string, error) {
+	return js.Global().Get("localStorage").Call("getItem", s.key).String(), nil
+}
+
+// SaveFile stores binary data in the local storage, encoded as base64 text.
+func (s *Store) SaveFile(name string, data []byte) error {
+	js.Global().Get("localStorage").Call("setItem", s.key+"/"+name, base64.StdEncoding.EncodeToString(data))
 	return nil
 }
 
-func Load() (string, error) {
-	return js.Global().Get("localStorage").Call("getItem", key).String(), nil
+// LoadFile reads data stored by SaveFile, a missing file results in no data without an error.
+func (s *Store) LoadFile(name string) ([]byte, error) {
+	value := js.Global().Get("localStorage").Call("getItem", s.key+"/"+name)
+	if value.IsNull() {
+		return nil, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(value.String())
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode %s: %w", name, err)
+	}
+	return data, nil
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"primgo/primo/machine"
+)
+
+// startTrace streams the trace of the executed instructions into the file given on the command
+// line.
+func (e *Emulator) startTrace(cl commandLine) error {
+	if cl.trace == "" {
+		return nil
+	}
+
+	options, err := traceOptions(cl)
+	if err != nil {
+		return err
+	}
+	if e.traceFile, err = os.Create(cl.trace); err != nil {
+		return fmt.Errorf("cannot create trace: %w", err)
+	}
+	e.machine.Tracer().Start(e.traceFile, options)
+	return nil
+}
+
+// traceOptions returns the filter and the triggers of the trace given on the command line. Tracing
+// can wait for an address, the first breakpoint, or Scroll Lock to be pressed.
+func traceOptions(cl commandLine) (machine.TraceOptions, error) {
+	var options machine.TraceOptions
+	if cl.traceRange != "" {
+		traceRange, err := machine.ParseTraceRange(cl.traceRange)
+		if err != nil {
+			return options, fmt.Errorf("%w: %w", ErrInvalidFlag, err)
+		}
+		options.Range = &traceRange
+	}
+
+	switch cl.traceStart {
+	case "key":
+		options.Paused = true
+	case "break":
+		options.Breakpoints = true
+	default:
+		if err := parseTraceAddress(cl.traceStart, &options.StartAt); err != nil {
+			return options, err
+		}
+	}
+	return options, parseTraceAddress(cl.traceStop, &options.StopAt)
+}
+
+// parseTraceAddress sets the address of a trigger, if it was given.
+func parseTraceAddress(text string, trigger **uint16) error {
+	if text == "" {
+		return nil
+	}
+	address, err := strconv.ParseUint(text, 0, 16)
+	if err != nil {
+		return fmt.Errorf("%w: invalid address %q", ErrInvalidFlag, text)
+	}
+	*trigger = ptr(uint16(address))
+	return nil
+}
+
+// toggleTrace pauses or resumes the trace started on the command line.
+func (e *Emulator) toggleTrace() {
+	tracer := e.machine.Tracer()
+	if !tracer.Started() {
+		return
+	}
+
+	tracer.Toggle()
+	if tracer.Active() {
+		log.Println("Tracing resumed")
+	} else {
+		log.Println("Tracing paused")
+	}
+}
+
+func (e *Emulator) stopTrace() {
+	if e.traceFile == nil {
+		return
+	}
+
+	if err := e.machine.Tracer().Stop(); err != nil {
+		log.Fatalf("Error saving trace: %s\n", err.Error())
+	}
+	if err := e.traceFile.Close(); err != nil {
+		log.Fatalf("Error saving trace: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,232 @@
+package ui
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"primgo/primo/monitor"
+)
+
+const (
+	debuggerItemID    = "{debugger}"
+	debugPanelWidth   = 330
+	debugLineHeight   = 20
+	debugCodeLines    = 10
+	debugOutputLines  = 4
+	debugCodeFirstRow = 10
+)
+
+// DebugPanel is an overlay showing the registers and the code of the machine, with a command line
+// for the debugger commands. Clicking an instruction runs the machine to it.
+type DebugPanel struct {
+	IsOpen    bool
+	OnCommand func(command string) (string, error)
+	OnView    func(codeLines int) monitor.View
+
+	res          Resources
+	view         monitor.View
+	input        string
+	output       []string
+	screenSize   image.Point
+	clickHandler *ClickHandler[int]
+}
+
+func NewDebugPanel(res Resources) *DebugPanel {
+	panel := &DebugPanel{res: res}
+
+	rows := make([]int, debugCodeLines)
+	for i := range rows {
+		rows[i] = i
+	}
+	panel.clickHandler = NewClickHandler(rows, panel.boundingRectangleForCodeLine)
+	panel.clickHandler.OnReleased = panel.onCodeLineReleased
+
+	return panel
+}
+
+func (p *DebugPanel) Open() {
+	p.IsOpen = true
+}
+
+func (p *DebugPanel) Close() {
+	p.IsOpen = false
+}
+
+func (p *DebugPanel) boundingRectangle() image.Rectangle {
+	return image.Rect(0, 0, debugPanelWidth, p.screenSize.Y-statusBarHeight)
+}
+
+func (p *DebugPanel) boundingRectangleForCodeLine(row int) image.Rectangle {
+	top := textMargin + (debugCodeFirstRow+row)*debugLineHeight
+	return image.Rect(0, top, debugPanelWidth, top+debugLineHeight)
+}
+
+// onCodeLineReleased runs the machine to the clicked instruction.
+func (p *DebugPanel) onCodeLineReleased(row int) {
+	if row < len(p.view.Code) {
+		p.execute(fmt.Sprintf("until %04X", p.view.Code[row].Address))
+	}
+}
+
+func (p *DebugPanel) execute(command string) {
+	if p.OnCommand == nil {
+		return
+	}
+
+	out, err := p.OnCommand(command)
+	if err != nil {
+		out = err.Error()
+	}
+	if out != "" {
+		p.output = append(p.output, strings.Split(out, "\n")...)
+		p.output = p.output[max(len(p.output)-debugOutputLines, 0):]
+	}
+}
+
+// updateInput edits the command line with the characters typed, and executes it on Return.
+func (p *DebugPanel) updateInput() {
+	p.input += string(ebiten.AppendInputChars(nil))
+
+	if repeatingKeyPressed(ebiten.KeyBackspace) && len(p.input) > 0 {
+		p.input = p.input[:len(p.input)-1]
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) || inpututil.IsKeyJustPressed(ebiten.KeyNumpadEnter) {
+		p.execute(p.input)
+		p.input = ""
+	}
+}
+
+// repeatingKeyPressed reports whether the key was just pressed, or it's held down long enough to
+// repeat it.
+func repeatingKeyPressed(key ebiten.Key) bool {
+	const (
+		delay    = 30
+		interval = 3
+	)
+	d := inpututil.KeyPressDuration(key)
+	return d == 1 || (d >= delay && (d-delay)%interval == 0)
+}
+
+func (p *DebugPanel) Update(ignoreInput *bool) {
+	if !p.IsOpen {
+		return
+	}
+
+	p.updateInput()
+	if p.OnView != nil {
+		p.view = p.OnView(debugCodeLines)
+	}
+
+	if !*ignoreInput {
+		p.clickHandler.Update()
+		x, y := ebiten.CursorPosition()
+		*ignoreInput = image.Pt(x, y).In(p.boundingRectangle())
+	}
+}
+
+func (p *DebugPanel) drawLine(screen *ebiten.Image, row int, line string, c color.Color) {
+	text.Draw(screen, line, p.res.font, textMargin, textMargin+(row+1)*debugLineHeight-5, c)
+}
+
+func (p *DebugPanel) drawCode(screen *ebiten.Image) {
+	for row, line := range p.view.Code {
+		c := color.RGBA{0x97, 0x97, 0x97, 0xff}
+		if line.Current || p.clickHandler.Hover(row) {
+			c = color.RGBA{0xff, 0xff, 0xff, 0xff}
+		}
+
+		label := line.Text
+		if line.Label != "" {
+			label += "   ; " + line.Label
+		}
+		if line.Current {
+			label = "> " + label
+		}
+		p.drawLine(screen, debugCodeFirstRow+row, label, c)
+
+		if line.Breakpoint {
+			bound := p.boundingRectangleForCodeLine(row)
+			vector.DrawFilledCircle(
+				screen,
+				float32(textMargin/2),
+				float32(bound.Min.Y+debugLineHeight/2),
+				4,
+				color.RGBA{0xe0, 0x40, 0x40, 0xff},
+				true)
+		}
+	}
+}
+
+func (p *DebugPanel) Draw(screen *ebiten.Image) {
+	if !p.IsOpen {
+		return
+	}
+
+	bound := p.boundingRectangle()
+	vector.DrawFilledRect(
+		screen,
+		float32(bound.Min.X), float32(bound.Min.Y),
+		float32(bound.Dx()), float32(bound.Dy()),
+		color.RGBA{R: 0x1f, G: 0x1f, B: 0x1f, A: 0xe8},
+		false)
+
+	p.drawLine(screen, 0, p.view.Status, color.RGBA{0xff, 0xff, 0xff, 0xff})
+	for row, line := range p.view.Registers {
+		p.drawLine(screen, row+1, line, color.RGBA{0x97, 0x97, 0x97, 0xff})
+	}
+	p.drawCode(screen)
+
+	outputRow := debugCodeFirstRow + debugCodeLines + 1
+	for row, line := range p.output {
+		p.drawLine(screen, outputRow+row, line, color.RGBA{0x97, 0x97, 0x97, 0xff})
+	}
+	p.drawLine(screen, outputRow+debugOutputLines, "> "+p.input+"_", color.RGBA{0xff, 0xff, 0xff, 0xff})
+}
+
+func (p *DebugPanel) Layout(w, h int) {
+	p.screenSize = image.Point{X: w, Y: h}
+}
+
+// ToggleDebugger shows or hides the debugger panel. While it's shown, the keys typed are taken as
+// debugger commands instead of being sent to the machine, so the memory viewer is hidden.
+func (s *UI) ToggleDebugger() {
+	if s.debugPanel.IsOpen {
+		s.debugPanel.Close()
+		s.speedList.SetItemLabel(debuggerItemID, "Debugger")
+		return
+	}
+
+	if s.memoryViewer.IsOpen {
+		s.ToggleMemoryViewer()
+	}
+	s.listingPanel.Close()
+	s.debugPanel.Open()
+	s.speedList.SetItemLabel(debuggerItemID, "Hide debugger")
+}
+
+func (s *UI) onDebugCommand(command string) (string, error) {
+	if s.OnDebugCommand == nil {
+		return "", nil
+	}
+	return s.OnDebugCommand(command)
+}
+
+func (s *UI) onDebugView(codeLines int) monitor.View {
+	if s.OnDebugView == nil {
+		return monitor.View{}
+	}
+	return s.OnDebugView(codeLines)
+}
+
+// DebuggerOpen reports whether the debugger panel is shown.
+func (s *UI) DebuggerOpen() bool {
+	return s.debugPanel.IsOpen
+}
@@ -0,0 +1,77 @@
+//go:build !wasm
+
+package dialog
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// clipboardCommands lists the commands printing the text on the clipboard, the first one that
+// works is used.
+func clipboardCommands() [][]string {
+	switch runtime.GOOS {
+	case "windows":
+		return [][]string{{"powershell", "-NoProfile", "-Command", "Get-Clipboard"}}
+	case "darwin":
+		return [][]string{{"pbpaste"}}
+	}
+	return [][]string{
+		{"wl-paste", "--no-newline"},
+		{"xclip", "-selection", "clipboard", "-o"},
+		{"xsel", "--clipboard", "--output"},
+	}
+}
+
+func ReadClipboard() chan *string {
+	res := make(chan *string)
+
+	go func() {
+		for _, command := range clipboardCommands() {
+			output, err := exec.Command(command[0], command[1:]...).Output()
+			if err == nil {
+				text := string(output)
+				res <- &text
+				return
+			}
+		}
+		res <- nil
+	}()
+
+	return res
+}
+
+// clipboardWriteCommands lists the commands putting their standard input on the clipboard, the
+// first one that works is used.
+func clipboardWriteCommands() [][]string {
+	switch runtime.GOOS {
+	case "windows":
+		return [][]string{{"powershell", "-NoProfile", "-Command", "$input | Set-Clipboard"}}
+	case "darwin":
+		return [][]string{{"pbcopy"}}
+	}
+	return [][]string{
+		{"wl-copy"},
+		{"xclip", "-selection", "clipboard", "-i"},
+		{"xsel", "--clipboard", "--input"},
+	}
+}
+
+func WriteClipboard(text string) chan bool {
+	res := make(chan bool)
+
+	go func() {
+		for _, command := range clipboardWriteCommands() {
+			cmd := exec.Command(command[0], command[1:]...)
+			cmd.Stdin = strings.NewReader(text)
+			if cmd.Run() == nil {
+				res <- true
+				return
+			}
+		}
+		res <- false
+	}()
+
+	return res
+}
@@ -0,0 +1,62 @@
+package dialog
+
+import (
+	"syscall/js"
+)
+
+func ReadClipboard() chan *string {
+	res := make(chan *string)
+
+	clipboard := js.Global().Get("navigator").Get("clipboard")
+	if clipboard.IsUndefined() {
+		go func() {
+			res <- nil
+		}()
+		return res
+	}
+
+	promise := clipboard.Call("readText")
+	promise.Call("then", js.FuncOf(func(this js.Value, p []js.Value) interface{} {
+		text := p[0].String()
+		go func() {
+			res <- &text
+		}()
+		return nil
+	}))
+	promise.Call("catch", js.FuncOf(func(this js.Value, p []js.Value) interface{} {
+		go func() {
+			res <- nil
+		}()
+		return nil
+	}))
+
+	return res
+}
+
+func WriteClipboard(text string) chan bool {
+	res := make(chan bool)
+
+	clipboard := js.Global().Get("navigator").Get("clipboard")
+	if clipboard.IsUndefined() {
+		go func() {
+			res <- false
+		}()
+		return res
+	}
+
+	promise := clipboard.Call("writeText", text)
+	promise.Call("then", js.FuncOf(func(this js.Value, p []js.Value) interface{} {
+		go func() {
+			res <- true
+		}()
+		return nil
+	}))
+	promise.Call("catch", js.FuncOf(func(this js.Value, p []js.Value) interface{} {
+		go func() {
+			res <- false
+		}()
+		return nil
+	}))
+
+	return res
+}
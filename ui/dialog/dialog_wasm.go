@@ -9,6 +9,7 @@ func BrowseFile() chan *OpenedFile {
 
 	fileInput := js.Global().Get("document").Call("createElement", "input")
 	fileInput.Set("type", "file")
+	fileInput.Set("accept", ".ptp,.pri,.wav,.rom,.bin,.json,.txt,.bas,.pmv")
 
 	fileInput.Call("addEventListener", "change", js.FuncOf(func(this js.Value, p []js.Value) interface{} {
 		files := fileInput.Get("files")
@@ -44,3 +45,27 @@ func BrowseFile() chan *OpenedFile {
 
 	return res
 }
+
+func SaveFile(name string, data []byte) chan bool {
+	res := make(chan bool)
+
+	content := js.Global().Get("Uint8Array").New(len(data))
+	js.CopyBytesToJS(content, data)
+	blob := js.Global().Get("Blob").New([]interface{}{content}, map[string]interface{}{
+		"type": "application/octet-stream",
+	})
+	url := js.Global().Get("URL").Call("createObjectURL", blob)
+
+	link := js.Global().Get("document").Call("createElement", "a")
+	link.Set("href", url)
+	link.Set("download", name)
+	link.Call("click")
+	js.Global().Get("URL").Call("revokeObjectURL", url)
+
+	// the browser doesn't tell us if the download was successful, so we just assume it is
+	go func() {
+		res <- true
+	}()
+
+	return res
+}
@@ -5,6 +5,7 @@ package dialog
 import (
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/ncruces/zenity"
 )
@@ -15,7 +16,11 @@ func BrowseFile() chan *OpenedFile {
 	go func() {
 		fileName, err := zenity.SelectFile(
 			zenity.FileFilters{
-				{Name: "Primo tape files", Patterns: []string{"*.ptp"}, CaseFold: false},
+				{
+					Name:     "Primo files",
+					Patterns: []string{"*.ptp", "*.pri", "*.wav", "*.rom", "*.bin", "*.json", "*.txt", "*.bas", "*.pmv"},
+					CaseFold: true,
+				},
 			})
 		if err != nil {
 			res <- nil
@@ -33,3 +38,36 @@ func BrowseFile() chan *OpenedFile {
 
 	return res
 }
+
+func SaveFile(name string, data []byte) chan bool {
+	res := make(chan bool)
+
+	go func() {
+		fileName, err := zenity.SelectFileSave(
+			zenity.Filename(name),
+			zenity.ConfirmOverwrite(),
+			zenity.FileFilters{
+				{Name: saveFilterName(name), Patterns: []string{"*" + filepath.Ext(name)}, CaseFold: true},
+			})
+		if err != nil {
+			res <- false
+			return
+		}
+
+		err = os.WriteFile(fileName, data, 0600)
+		res <- err == nil
+	}()
+
+	return res
+}
+
+// saveFilterName describes the type of the saved file based on its extension.
+func saveFilterName(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".wav":
+		return "WAV audio files"
+	case ".pmv":
+		return "PrimGO movie files"
+	}
+	return "Primo tape files"
+}
@@ -0,0 +1,140 @@
+package ui
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"golang.org/x/exp/slices"
+
+	"primgo/primo"
+)
+
+// the stick of a gamepad has to be moved this far from the center to close a switch
+const gamepadAxisThreshold = 0.5
+
+// JoystickKeys are the keyboard keys emulating the switches of a joystick.
+type JoystickKeys struct {
+	Up    ebiten.Key `json:"up"`
+	Down  ebiten.Key `json:"down"`
+	Left  ebiten.Key `json:"left"`
+	Right ebiten.Key `json:"right"`
+	Fire  ebiten.Key `json:"fire"`
+}
+
+// defaultJoystickKeys binds the numpad to the first joystick, as it's not used by the PRIMO
+// keyboard.
+func defaultJoystickKeys() []JoystickKeys {
+	return []JoystickKeys{
+		{
+			Up:    ebiten.KeyNumpad8,
+			Down:  ebiten.KeyNumpad2,
+			Left:  ebiten.KeyNumpad4,
+			Right: ebiten.KeyNumpad6,
+			Fire:  ebiten.KeyNumpad0,
+		},
+	}
+}
+
+func (j JoystickKeys) switches() map[ebiten.Key]primo.Joystick {
+	return map[ebiten.Key]primo.Joystick{
+		j.Up:    primo.JoystickUp,
+		j.Down:  primo.JoystickDown,
+		j.Left:  primo.JoystickLeft,
+		j.Right: primo.JoystickRight,
+		j.Fire:  primo.JoystickFire,
+	}
+}
+
+// standardGamepadJoystick reads a gamepad with a known layout, where both the d-pad and the left
+// stick can be used for moving, and any of the right buttons for firing.
+func standardGamepadJoystick(id ebiten.GamepadID) primo.Joystick {
+	var joystick primo.Joystick
+	buttons := map[ebiten.StandardGamepadButton]primo.Joystick{
+		ebiten.StandardGamepadButtonLeftTop:     primo.JoystickUp,
+		ebiten.StandardGamepadButtonLeftBottom:  primo.JoystickDown,
+		ebiten.StandardGamepadButtonLeftLeft:    primo.JoystickLeft,
+		ebiten.StandardGamepadButtonLeftRight:   primo.JoystickRight,
+		ebiten.StandardGamepadButtonRightBottom: primo.JoystickFire,
+		ebiten.StandardGamepadButtonRightRight:  primo.JoystickFire,
+		ebiten.StandardGamepadButtonRightLeft:   primo.JoystickFire,
+		ebiten.StandardGamepadButtonRightTop:    primo.JoystickFire,
+	}
+	for button, sw := range buttons {
+		if ebiten.IsStandardGamepadButtonPressed(id, button) {
+			joystick |= sw
+		}
+	}
+
+	return joystick | axisJoystick(
+		ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickHorizontal),
+		ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickVertical))
+}
+
+// gamepadJoystick reads a gamepad with an unknown layout, using its first two axes for moving and
+// its first button for firing.
+func gamepadJoystick(id ebiten.GamepadID) primo.Joystick {
+	if ebiten.IsStandardGamepadLayoutAvailable(id) {
+		return standardGamepadJoystick(id)
+	}
+
+	var joystick primo.Joystick
+	if ebiten.GamepadButtonCount(id) > 0 && ebiten.IsGamepadButtonPressed(id, ebiten.GamepadButton0) {
+		joystick |= primo.JoystickFire
+	}
+	if ebiten.GamepadAxisCount(id) < 2 {
+		return joystick
+	}
+	return joystick | axisJoystick(ebiten.GamepadAxisValue(id, 0), ebiten.GamepadAxisValue(id, 1))
+}
+
+func axisJoystick(x, y float64) primo.Joystick {
+	var joystick primo.Joystick
+	if x < -gamepadAxisThreshold {
+		joystick |= primo.JoystickLeft
+	}
+	if x > gamepadAxisThreshold {
+		joystick |= primo.JoystickRight
+	}
+	if y < -gamepadAxisThreshold {
+		joystick |= primo.JoystickUp
+	}
+	if y > gamepadAxisThreshold {
+		joystick |= primo.JoystickDown
+	}
+	return joystick
+}
+
+// Joysticks returns the state of the two joysticks, driven by the keys bound to them and by the
+// connected gamepads. The first gamepad drives the first joystick, the second one the second.
+func (s *UI) Joysticks(keys []ebiten.Key) [2]primo.Joystick {
+	var joysticks [2]primo.Joystick
+
+	for n, bindings := range s.joystickKeys {
+		if n >= len(joysticks) {
+			break
+		}
+		for key, sw := range bindings.switches() {
+			if slices.Contains(keys, key) {
+				joysticks[n] |= sw
+			}
+		}
+	}
+
+	for n, id := range ebiten.AppendGamepadIDs(nil) {
+		if n >= len(joysticks) {
+			break
+		}
+		joysticks[n] |= gamepadJoystick(id)
+	}
+
+	return joysticks
+}
+
+// RemoveJoystickKeys filters out the keys bound to the joysticks, so they don't press any keys on
+// the PRIMO keyboard at the same time.
+func (s *UI) RemoveJoystickKeys(keys []ebiten.Key) []ebiten.Key {
+	return slices.DeleteFunc(keys, func(key ebiten.Key) bool {
+		return slices.ContainsFunc(s.joystickKeys, func(bindings JoystickKeys) bool {
+			_, ok := bindings.switches()[key]
+			return ok
+		})
+	})
+}
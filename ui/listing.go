@@ -0,0 +1,279 @@
+package ui
+
+import (
+	"image"
+	"image/color"
+	"log"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"golang.org/x/image/font"
+
+	"primgo/ui/dialog"
+)
+
+const (
+	listProgramItemID = "{list_program}"
+	listTapeItemID    = "{list_tape}"
+	savedListingName  = "listing.bas"
+	listingPanelWidth = 600
+	listingButtonGap  = 24
+	listingCopyID     = "Copy"
+	listingSaveID     = "Save"
+	listingCloseID    = "Close"
+)
+
+// ListingPanel is an overlay sliding in from the right, showing a BASIC program listing, with
+// buttons for copying it to the clipboard and saving it to a file.
+type ListingPanel struct {
+	IsOpen bool
+	OnCopy func(listing string)
+	OnSave func(listing string)
+
+	res          Resources
+	title        string
+	listing      string
+	lines        []string
+	wrapWidth    int
+	firstLine    int
+	scroll       float64
+	tweens       Tweens
+	screenSize   image.Point
+	clickHandler *ClickHandler[string]
+}
+
+func NewListingPanel(res Resources) *ListingPanel {
+	panel := &ListingPanel{res: res, scroll: 1.0}
+	panel.clickHandler = NewClickHandler(listingButtons(), panel.boundingRectangleForButton)
+	panel.clickHandler.OnReleased = panel.onButtonReleased
+	return panel
+}
+
+func listingButtons() []string {
+	return []string{listingCopyID, listingSaveID, listingCloseID}
+}
+
+// Show opens the panel with the listing, scrolled to its start.
+func (p *ListingPanel) Show(title, listing string) {
+	p.title = title
+	p.listing = listing
+	p.lines = nil
+	p.firstLine = 0
+	p.tweens.CancelAll()
+	p.tweens.Add(NewTween(&p.scroll, 0.0, animLength))
+	p.IsOpen = true
+}
+
+func (p *ListingPanel) Close() {
+	p.tweens.CancelAll()
+	p.tweens.Add(NewTween(&p.scroll, 1.0, animLength))
+	p.IsOpen = false
+}
+
+func (p *ListingPanel) boundingRectangle() image.Rectangle {
+	width := min(listingPanelWidth, p.screenSize.X)
+	left := p.screenSize.X - width + int(float64(width)*p.scroll)
+	return image.Rect(left, 0, left+width, p.screenSize.Y-statusBarHeight)
+}
+
+func (p *ListingPanel) textWidth(s string) int {
+	bounds, _ := font.BoundString(p.res.font, s)
+	return bounds.Max.X.Round() - bounds.Min.X.Round()
+}
+
+// boundingRectangleForButton places the buttons right aligned in the first row of the panel.
+func (p *ListingPanel) boundingRectangleForButton(id string) image.Rectangle {
+	if !p.IsOpen {
+		return image.Rectangle{}
+	}
+
+	right := p.boundingRectangle().Max.X - textMargin
+	buttons := listingButtons()
+	for i := len(buttons) - 1; i >= 0; i-- {
+		left := right - p.textWidth(buttons[i])
+		if buttons[i] == id {
+			return image.Rect(left, textMargin, right, textMargin+debugLineHeight)
+		}
+		right = left - listingButtonGap
+	}
+	return image.Rectangle{}
+}
+
+func (p *ListingPanel) onButtonReleased(id string) {
+	switch id {
+	case listingCopyID:
+		if p.OnCopy != nil {
+			p.OnCopy(p.listing)
+		}
+	case listingSaveID:
+		if p.OnSave != nil {
+			p.OnSave(p.listing)
+		}
+	case listingCloseID:
+		p.Close()
+	}
+}
+
+// visibleLines returns the number of listing lines fitting the panel below the title.
+func (p *ListingPanel) visibleLines() int {
+	return max((p.screenSize.Y-statusBarHeight-textMargin)/debugLineHeight-1, 1)
+}
+
+// wrap breaks the lines of the listing that don't fit the panel, continuing them indented.
+func (p *ListingPanel) wrap(width int) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(p.listing, "\n"), "\n") {
+		runes := []rune(line)
+		// at least one character of the line is taken even if it doesn't fit, after the indentation
+		// of the continued lines
+		taken := 1
+		for len(runes) > 0 {
+			n := len(runes)
+			for n > taken && p.textWidth(string(runes[:n])) > width {
+				n--
+			}
+			lines = append(lines, string(runes[:n]))
+			runes = runes[n:]
+			if len(runes) > 0 {
+				runes = append([]rune("    "), runes...)
+				taken = 5
+			}
+		}
+		if line == "" {
+			lines = append(lines, "")
+		}
+	}
+	return lines
+}
+
+// updateScroll scrolls the listing by the arrow and page keys, and by the mouse wheel over the
+// panel.
+func (p *ListingPanel) updateScroll(overPanel bool) {
+	lines := 0
+	if repeatingKeyPressed(ebiten.KeyUp) {
+		lines--
+	}
+	if repeatingKeyPressed(ebiten.KeyDown) {
+		lines++
+	}
+	if repeatingKeyPressed(ebiten.KeyPageUp) {
+		lines -= p.visibleLines()
+	}
+	if repeatingKeyPressed(ebiten.KeyPageDown) {
+		lines += p.visibleLines()
+	}
+	if _, dy := ebiten.Wheel(); overPanel && dy != 0 {
+		lines -= int(dy * 3)
+	}
+	p.firstLine = max(min(p.firstLine+lines, len(p.lines)-p.visibleLines()), 0)
+}
+
+func (p *ListingPanel) Update(ignoreInput *bool) {
+	p.tweens.Update()
+	if !p.IsOpen {
+		return
+	}
+
+	width := min(listingPanelWidth, p.screenSize.X) - 2*textMargin
+	if p.lines == nil || width != p.wrapWidth {
+		p.lines = p.wrap(width)
+		p.wrapWidth = width
+	}
+
+	x, y := ebiten.CursorPosition()
+	overPanel := image.Pt(x, y).In(p.boundingRectangle())
+	p.updateScroll(overPanel && !*ignoreInput)
+
+	if !*ignoreInput {
+		p.clickHandler.Update()
+		*ignoreInput = overPanel
+	}
+}
+
+func (p *ListingPanel) drawText(screen *ebiten.Image, x, row int, line string, c color.Color) {
+	text.Draw(screen, line, p.res.font, x, textMargin+(row+1)*debugLineHeight-5, c)
+}
+
+func (p *ListingPanel) drawButtons(screen *ebiten.Image) {
+	for _, id := range listingButtons() {
+		c := color.RGBA{0x97, 0x97, 0x97, 0xff}
+		if p.clickHandler.Hover(id) {
+			c = color.RGBA{0xff, 0xff, 0xff, 0xff}
+		}
+		p.drawText(screen, p.boundingRectangleForButton(id).Min.X, 0, id, c)
+	}
+}
+
+func (p *ListingPanel) Draw(screen *ebiten.Image) {
+	if p.scroll >= 1.0 {
+		return
+	}
+
+	bound := p.boundingRectangle()
+	vector.DrawFilledRect(
+		screen,
+		float32(bound.Min.X), float32(bound.Min.Y),
+		float32(bound.Dx()), float32(bound.Dy()),
+		color.RGBA{R: 0x1f, G: 0x1f, B: 0x1f, A: 0xf0},
+		false)
+
+	left := bound.Min.X + textMargin
+	p.drawText(screen, left, 0, p.title, color.RGBA{0xff, 0xff, 0xff, 0xff})
+	p.drawButtons(screen)
+
+	last := min(p.firstLine+p.visibleLines(), len(p.lines))
+	for row, line := range p.lines[p.firstLine:last] {
+		p.drawText(screen, left, row+1, line, color.RGBA{0xc8, 0xc8, 0xc8, 0xff})
+	}
+}
+
+func (p *ListingPanel) Layout(w, h int) {
+	p.screenSize = image.Point{X: w, Y: h}
+}
+
+// ShowProgramListing lists the BASIC program in the memory of the machine.
+func (s *UI) ShowProgramListing() {
+	if s.OnListProgram == nil {
+		return
+	}
+	s.showListing("BASIC program in memory", s.OnListProgram)
+}
+
+// ShowTapeListing lists the BASIC programs on the tape inserted.
+func (s *UI) ShowTapeListing() {
+	if s.OnListTape == nil {
+		return
+	}
+	s.showListing("BASIC programs on "+s.LoadedTape, s.OnListTape)
+}
+
+func (s *UI) showListing(title string, list func() (string, error)) {
+	listing, err := list()
+	if err != nil {
+		log.Printf("Error listing BASIC program: %s\n", err.Error())
+		return
+	}
+
+	if s.debugPanel.IsOpen {
+		s.ToggleDebugger()
+	}
+	if s.memoryViewer.IsOpen {
+		s.ToggleMemoryViewer()
+	}
+	s.listingPanel.Show(title, listing)
+}
+
+func (s *UI) onListingCopy(listing string) {
+	s.copiedListingChan = dialog.WriteClipboard(listing)
+}
+
+func (s *UI) onListingSave(listing string) {
+	s.savedListingChan = dialog.SaveFile(savedListingName, []byte(listing))
+}
+
+// ListingOpen reports whether the listing panel is shown.
+func (s *UI) ListingOpen() bool {
+	return s.listingPanel.IsOpen
+}
@@ -0,0 +1,364 @@
+package ui
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"primgo/primo/monitor"
+)
+
+const (
+	memoryItemID         = "{memory}"
+	memoryViewerWidth    = 600
+	memoryLineLength     = 16
+	memoryMaxLines       = 64
+	memoryAddressWidth   = 50
+	memoryHexCellWidth   = 22
+	memoryASCIICellWidth = 10
+	memoryColumnGap      = 12
+	// the lines of the panel besides the memory, the status, the output and the command line
+	memoryExtraLines = 3
+)
+
+// MemoryViewer is an overlay sliding in from the right, showing the memory as hexadecimal bytes
+// and ASCII characters, with a command line for jumping around, searching and editing it. Clicking
+// a byte starts a poke command for it.
+type MemoryViewer struct {
+	IsOpen    bool
+	OnView    func(address uint16, lines int) []monitor.MemoryLine
+	OnCommand func(command string) (string, error)
+	OnLocate  func(target string) (uint16, error)
+	OnFind    func(pattern string, from uint16) (uint16, error)
+
+	res          Resources
+	address      uint16
+	cursor       uint16
+	lines        []monitor.MemoryLine
+	input        string
+	output       string
+	scroll       float64
+	tweens       Tweens
+	screenSize   image.Point
+	clickHandler *ClickHandler[int]
+}
+
+func NewMemoryViewer(res Resources) *MemoryViewer {
+	viewer := &MemoryViewer{res: res, scroll: 1.0}
+
+	cells := make([]int, memoryMaxLines*memoryLineLength)
+	for i := range cells {
+		cells[i] = i
+	}
+	viewer.clickHandler = NewClickHandler(cells, viewer.boundingRectangleForCell)
+	viewer.clickHandler.OnReleased = viewer.onCellReleased
+
+	return viewer
+}
+
+func (v *MemoryViewer) Open() {
+	v.tweens.CancelAll()
+	v.tweens.Add(NewTween(&v.scroll, 0.0, animLength))
+	v.IsOpen = true
+}
+
+func (v *MemoryViewer) Close() {
+	v.tweens.CancelAll()
+	v.tweens.Add(NewTween(&v.scroll, 1.0, animLength))
+	v.IsOpen = false
+}
+
+func (v *MemoryViewer) boundingRectangle() image.Rectangle {
+	width := min(memoryViewerWidth, v.screenSize.X)
+	left := v.screenSize.X - width + int(float64(width)*v.scroll)
+	return image.Rect(left, 0, left+width, v.screenSize.Y-statusBarHeight)
+}
+
+// visibleLines returns the number of memory lines fitting the panel.
+func (v *MemoryViewer) visibleLines() int {
+	lines := (v.screenSize.Y-statusBarHeight-textMargin)/debugLineHeight - memoryExtraLines
+	return max(min(lines, memoryMaxLines), 1)
+}
+
+func (v *MemoryViewer) boundingRectangleForCell(cell int) image.Rectangle {
+	row, col := cell/memoryLineLength, cell%memoryLineLength
+	if row >= len(v.lines) {
+		return image.Rectangle{}
+	}
+	left := v.boundingRectangle().Min.X + textMargin + memoryAddressWidth + col*memoryHexCellWidth
+	top := textMargin + (row+1)*debugLineHeight
+	return image.Rect(left, top, left+memoryHexCellWidth, top+debugLineHeight)
+}
+
+// onCellReleased selects the clicked byte, and starts typing a poke command for it.
+func (v *MemoryViewer) onCellReleased(cell int) {
+	v.cursor = v.address + uint16(cell)
+	v.input = fmt.Sprintf("poke %04X ", v.cursor)
+}
+
+// jump selects the address, and scrolls to it if it's not shown.
+func (v *MemoryViewer) jump(address uint16) {
+	v.cursor = address
+	offset := int(address - v.address)
+	if offset >= len(v.lines)*memoryLineLength {
+		v.address = address &^ (memoryLineLength - 1)
+	}
+}
+
+// execute runs the goto and the find commands of the viewer, and passes the others to the
+// debugger.
+func (v *MemoryViewer) execute(command string) {
+	name, args, _ := strings.Cut(strings.TrimSpace(command), " ")
+	var address uint16
+	var err error
+	switch strings.ToLower(name) {
+	case "goto", "g":
+		if v.OnLocate == nil {
+			return
+		}
+		address, err = v.OnLocate(args)
+	case "find":
+		if v.OnFind == nil {
+			return
+		}
+		address, err = v.OnFind(args, v.cursor+1)
+	default:
+		if v.OnCommand != nil {
+			v.output, err = v.OnCommand(command)
+		}
+		if err != nil {
+			v.output = err.Error()
+		}
+		return
+	}
+
+	v.output = ""
+	if err != nil {
+		v.output = err.Error()
+		return
+	}
+	v.jump(address)
+}
+
+// updateInput edits the command line with the characters typed, and executes it on Return.
+func (v *MemoryViewer) updateInput() {
+	v.input += string(ebiten.AppendInputChars(nil))
+
+	if repeatingKeyPressed(ebiten.KeyBackspace) && len(v.input) > 0 {
+		v.input = v.input[:len(v.input)-1]
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) || inpututil.IsKeyJustPressed(ebiten.KeyNumpadEnter) {
+		v.execute(v.input)
+		v.input = ""
+	}
+}
+
+// updateScroll scrolls the memory by the arrow and page keys, and by the mouse wheel over the panel.
+func (v *MemoryViewer) updateScroll(overPanel bool) {
+	lines := 0
+	if repeatingKeyPressed(ebiten.KeyUp) {
+		lines--
+	}
+	if repeatingKeyPressed(ebiten.KeyDown) {
+		lines++
+	}
+	if repeatingKeyPressed(ebiten.KeyPageUp) {
+		lines -= v.visibleLines()
+	}
+	if repeatingKeyPressed(ebiten.KeyPageDown) {
+		lines += v.visibleLines()
+	}
+	if _, dy := ebiten.Wheel(); overPanel && dy != 0 {
+		lines -= int(dy * 3)
+	}
+	v.address += uint16(lines * memoryLineLength)
+}
+
+func (v *MemoryViewer) Update(ignoreInput *bool) {
+	v.tweens.Update()
+	if !v.IsOpen {
+		return
+	}
+
+	x, y := ebiten.CursorPosition()
+	overPanel := image.Pt(x, y).In(v.boundingRectangle())
+	v.updateInput()
+	v.updateScroll(overPanel && !*ignoreInput)
+	if v.OnView != nil {
+		v.lines = v.OnView(v.address, v.visibleLines())
+	}
+
+	if !*ignoreInput {
+		v.clickHandler.Update()
+		*ignoreInput = overPanel
+	}
+}
+
+// byteColor shows the ROM in blue with its routines brighter, the missing memory dimmed, and the
+// recent writes highlighted.
+func byteColor(b monitor.MemoryByte) color.RGBA {
+	c := color.RGBA{0xc8, 0xc8, 0xc8, 0xff}
+	switch {
+	case b.Unpopulated:
+		return color.RGBA{0x50, 0x50, 0x50, 0xff}
+	case b.Label != "":
+		return color.RGBA{0xb4, 0xd2, 0xff, 0xff}
+	case b.ROM:
+		c = color.RGBA{0x6a, 0x86, 0xb8, 0xff}
+	}
+
+	blend := func(from, to uint8) uint8 {
+		return uint8(float64(from) + (float64(to)-float64(from))*b.Heat)
+	}
+	return color.RGBA{blend(c.R, 0xff), blend(c.G, 0x70), blend(c.B, 0x40), 0xff}
+}
+
+func printable(value uint8) string {
+	if value < 0x20 || value > 0x7e {
+		return "."
+	}
+	return string(rune(value))
+}
+
+func (v *MemoryViewer) drawText(screen *ebiten.Image, x, row int, line string, c color.Color) {
+	text.Draw(screen, line, v.res.font, x, textMargin+(row+1)*debugLineHeight-5, c)
+}
+
+func (v *MemoryViewer) drawLine(screen *ebiten.Image, row int, line monitor.MemoryLine) {
+	bound := v.boundingRectangle()
+	if line.Bytes[0].ROM {
+		vector.DrawFilledRect(
+			screen,
+			float32(bound.Min.X), float32(textMargin+row*debugLineHeight),
+			float32(bound.Dx()), float32(debugLineHeight),
+			color.RGBA{R: 0x24, G: 0x2a, B: 0x38, A: 0xe8},
+			false)
+	}
+
+	left := bound.Min.X + textMargin
+	v.drawText(screen, left, row, fmt.Sprintf("%04X", line.Address), color.RGBA{0x97, 0x97, 0x97, 0xff})
+
+	asciiLeft := left + memoryAddressWidth + memoryLineLength*memoryHexCellWidth + memoryColumnGap
+	for i, b := range line.Bytes {
+		c := byteColor(b)
+		v.drawText(screen, left+memoryAddressWidth+i*memoryHexCellWidth, row, fmt.Sprintf("%02X", b.Value), c)
+		v.drawText(screen, asciiLeft+i*memoryASCIICellWidth, row, printable(b.Value), c)
+	}
+}
+
+// drawCursor frames the selected byte if it's shown.
+func (v *MemoryViewer) drawCursor(screen *ebiten.Image) {
+	offset := int(v.cursor - v.address)
+	if offset >= len(v.lines)*memoryLineLength {
+		return
+	}
+	bound := v.boundingRectangleForCell(offset)
+	vector.StrokeRect(
+		screen,
+		float32(bound.Min.X-3), float32(bound.Min.Y+1),
+		float32(bound.Dx()-2), float32(bound.Dy()-2),
+		1,
+		color.RGBA{0xff, 0xff, 0xff, 0xff},
+		false)
+}
+
+// status describes the byte under the mouse, or the selected one.
+func (v *MemoryViewer) status() string {
+	address := v.cursor
+	for _, cell := range v.clickHandler.AppendAllHover(nil) {
+		address = v.address + uint16(cell)
+	}
+
+	offset := int(address - v.address)
+	if offset >= len(v.lines)*memoryLineLength {
+		return fmt.Sprintf("$%04X", address)
+	}
+	b := v.lines[offset/memoryLineLength].Bytes[offset%memoryLineLength]
+	status := fmt.Sprintf("$%04X = $%02X (%d)", address, b.Value, b.Value)
+	if b.ROM {
+		status += "   ROM"
+	}
+	if b.Label != "" {
+		status += "   " + b.Label
+	}
+	return status
+}
+
+func (v *MemoryViewer) Draw(screen *ebiten.Image) {
+	if v.scroll >= 1.0 {
+		return
+	}
+
+	bound := v.boundingRectangle()
+	vector.DrawFilledRect(
+		screen,
+		float32(bound.Min.X), float32(bound.Min.Y),
+		float32(bound.Dx()), float32(bound.Dy()),
+		color.RGBA{R: 0x1f, G: 0x1f, B: 0x1f, A: 0xe8},
+		false)
+
+	left := bound.Min.X + textMargin
+	v.drawText(screen, left, 0, v.status(), color.RGBA{0xff, 0xff, 0xff, 0xff})
+	for row, line := range v.lines {
+		v.drawLine(screen, row+1, line)
+	}
+	v.drawCursor(screen)
+
+	outputRow := len(v.lines) + 1
+	v.drawText(screen, left, outputRow, v.output, color.RGBA{0x97, 0x97, 0x97, 0xff})
+	v.drawText(screen, left, outputRow+1, "> "+v.input+"_", color.RGBA{0xff, 0xff, 0xff, 0xff})
+}
+
+func (v *MemoryViewer) Layout(w, h int) {
+	v.screenSize = image.Point{X: w, Y: h}
+}
+
+// ToggleMemoryViewer slides the memory viewer in or out. It takes the keys typed like the debugger
+// panel, so the debugger panel is hidden while it's shown.
+func (s *UI) ToggleMemoryViewer() {
+	if s.memoryViewer.IsOpen {
+		s.memoryViewer.Close()
+		s.speedList.SetItemLabel(memoryItemID, "Memory viewer")
+		return
+	}
+
+	if s.debugPanel.IsOpen {
+		s.ToggleDebugger()
+	}
+	s.listingPanel.Close()
+	s.memoryViewer.Open()
+	s.speedList.SetItemLabel(memoryItemID, "Hide memory viewer")
+}
+
+func (s *UI) onMemoryView(address uint16, lines int) []monitor.MemoryLine {
+	if s.OnMemoryView == nil {
+		return nil
+	}
+	return s.OnMemoryView(address, lines)
+}
+
+func (s *UI) onMemoryLocate(target string) (uint16, error) {
+	if s.OnMemoryLocate == nil {
+		return 0, nil
+	}
+	return s.OnMemoryLocate(target)
+}
+
+func (s *UI) onMemoryFind(pattern string, from uint16) (uint16, error) {
+	if s.OnMemoryFind == nil {
+		return 0, nil
+	}
+	return s.OnMemoryFind(pattern, from)
+}
+
+// MemoryViewerOpen reports whether the memory viewer is shown.
+func (s *UI) MemoryViewerOpen() bool {
+	return s.memoryViewer.IsOpen
+}
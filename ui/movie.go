@@ -0,0 +1,68 @@
+package ui
+
+import (
+	"log"
+
+	"primgo/primo"
+	"primgo/ui/dialog"
+)
+
+const (
+	recordMovieItemID     = "{record_movie}"
+	recordMovieHereItemID = "{record_movie_here}"
+	playMovieItemID       = "{play_movie}"
+	savedMovieName        = "recorded.pmv"
+)
+
+func movieItems() []ItemInfo {
+	return []ItemInfo{
+		{Label: "Record movie from power-on", ID: recordMovieItemID},
+		{Label: "Record movie from here", ID: recordMovieHereItemID},
+		{Label: "Play movie", ID: playMovieItemID},
+	}
+}
+
+// ToggleMovieRecording starts recording a movie either from power-on or from the current state, or
+// stops it and saves the movie to a file.
+func (s *UI) ToggleMovieRecording(fromPowerOn bool) {
+	if s.OnMovieRecord == nil || s.OnMovieStop == nil {
+		return
+	}
+
+	s.recordingMovie = !s.recordingMovie
+	if s.recordingMovie {
+		s.OnMovieRecord(fromPowerOn)
+		s.stateList.SetItemLabel(recordMovieItemID, "Stop recording movie")
+		s.stateList.SetItemLabel(recordMovieHereItemID, "Stop recording movie")
+		log.Println("Movie recording started")
+		return
+	}
+
+	s.stateList.SetItemLabel(recordMovieItemID, "Record movie from power-on")
+	s.stateList.SetItemLabel(recordMovieHereItemID, "Record movie from here")
+	if movie := s.OnMovieStop(); movie != nil {
+		s.savedMovieChan = dialog.SaveFile(savedMovieName, movie.Encode())
+	}
+}
+
+// PlayMovie replays a movie file, switching to the model it was recorded with.
+func (s *UI) PlayMovie(data []byte) {
+	movie, err := primo.DecodeMovie(data)
+	if err != nil {
+		log.Printf("Error loading movie: %s\n", err.Error())
+		return
+	}
+
+	if s.recordingMovie {
+		s.ToggleMovieRecording(false)
+	}
+	if s.OnMoviePlay != nil {
+		if err = s.OnMoviePlay(movie); err != nil {
+			log.Printf("Error playing movie: %s\n", err.Error())
+			return
+		}
+	}
+
+	s.followMachineModel(movie.ROMType, movie.RAMSize, movie.MatchesROM(s.ROM))
+	log.Printf("Playing movie of %d frames\n", len(movie.Frames))
+}
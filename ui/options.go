@@ -0,0 +1,59 @@
+package ui
+
+import (
+	"primgo/primo"
+)
+
+// Options are the settings given on the command line. Every field left nil keeps the saved setting,
+// while the others take precedence over it for the session, without being saved.
+type Options struct {
+	// SettingsFile is an alternative settings file, the default one is used if it's empty.
+	SettingsFile   string
+	ROMType        *primo.ROMType
+	RAMSize        *primo.RAMSize
+	ClockSpeed     *ClockSpeed
+	WholeScaleOnly *bool
+	Muted          *bool
+}
+
+// apply overrides the settings with the options given. Selecting a ROM type also replaces the
+// opened ROM image with the built-in one.
+func (o Options) apply(ps *primgoSettings) {
+	if o.ROMType != nil {
+		ps.ROMType = *o.ROMType
+		ps.UserROM = false
+	}
+	if o.RAMSize != nil {
+		ps.RAMSize = *o.RAMSize
+	}
+	if o.ClockSpeed != nil {
+		ps.ClockSpeed = *o.ClockSpeed
+	}
+	if o.WholeScaleOnly != nil {
+		ps.WholeScaleOnly = *o.WholeScaleOnly
+	}
+	if o.Muted != nil {
+		ps.Muted = *o.Muted
+	}
+}
+
+// restore puts back the saved values of the settings overridden by the options, so they are not
+// saved.
+func (o Options) restore(ps *primgoSettings, saved primgoSettings) {
+	if o.ROMType != nil {
+		ps.ROMType = saved.ROMType
+		ps.UserROM = saved.UserROM
+	}
+	if o.RAMSize != nil {
+		ps.RAMSize = saved.RAMSize
+	}
+	if o.ClockSpeed != nil {
+		ps.ClockSpeed = saved.ClockSpeed
+	}
+	if o.WholeScaleOnly != nil {
+		ps.WholeScaleOnly = saved.WholeScaleOnly
+	}
+	if o.Muted != nil {
+		ps.Muted = saved.Muted
+	}
+}
@@ -71,8 +71,8 @@ func NewPopupList(items []ItemInfo, anchor Boundable, align PopupAlign, res Reso
 
 func (p *PopupList) onReleased(id string) {
 	if p.OnClick != nil && id != listBackgroundItemID {
-		p.OnClick(id)
 		p.selectedItem = id
+		p.OnClick(id)
 	}
 
 	if id == listBackgroundItemID {
@@ -80,6 +80,19 @@ func (p *PopupList) onReleased(id string) {
 	}
 }
 
+// Select marks the item with the given ID as the selected one.
+func (p *PopupList) Select(id string) {
+	p.selectedItem = id
+}
+
+// SetItemLabel changes the label of the item with the given ID.
+func (p *PopupList) SetItemLabel(id, label string) {
+	idx := slices.IndexFunc(p.items, func(ii ItemInfo) bool { return ii.ID == id })
+	if idx >= 0 {
+		p.items[idx].Label = label
+	}
+}
+
 func (p *PopupList) Open() {
 	p.tweens.CancelAll()
 	p.tweens.Add(NewTween(&p.positionOffset, 0, animLength))
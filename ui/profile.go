@@ -0,0 +1,33 @@
+package ui
+
+import (
+	"log"
+
+	"primgo/ui/dialog"
+)
+
+const (
+	profileItemID    = "{profile}"
+	savedProfileName = "callgrind.out.primgo"
+)
+
+// ToggleProfiling starts profiling where the CPU spends its cycles, or stops it and saves the
+// profile to a file.
+func (s *UI) ToggleProfiling() {
+	if s.OnProfileStart == nil || s.OnProfileStop == nil {
+		return
+	}
+
+	s.profiling = !s.profiling
+	if s.profiling {
+		s.OnProfileStart()
+		s.speedList.SetItemLabel(profileItemID, "Stop profiling")
+		log.Println("Profiling started")
+		return
+	}
+
+	s.speedList.SetItemLabel(profileItemID, "Start profiling")
+	if profile := s.OnProfileStop(); profile != nil {
+		s.savedProfileChan = dialog.SaveFile(savedProfileName, profile)
+	}
+}
@@ -26,6 +26,11 @@ type Resources struct {
 	rom3IconImage         *ebiten.Image
 	scale1IconImage       *ebiten.Image
 	scale2IconImage       *ebiten.Image
+	stateIconImage        *ebiten.Image
+	runIconImage          *ebiten.Image
+	pauseIconImage        *ebiten.Image
+	warpIconImage         *ebiten.Image
+	pasteIconImage        *ebiten.Image
 	keyboard              *ebiten.Image
 	font                  font.Face
 }
@@ -82,6 +87,11 @@ func NewResources() Resources {
 		rom3IconImage:         LoadPNGAsset("assets/rom3.png"),
 		scale1IconImage:       LoadPNGAsset("assets/scale1.png"),
 		scale2IconImage:       LoadPNGAsset("assets/scale2.png"),
+		stateIconImage:        LoadPNGAsset("assets/state.png"),
+		runIconImage:          LoadPNGAsset("assets/run.png"),
+		pauseIconImage:        LoadPNGAsset("assets/pause.png"),
+		warpIconImage:         LoadPNGAsset("assets/warp.png"),
+		pasteIconImage:        LoadPNGAsset("assets/paste.png"),
 		keyboard:              LoadPNGAsset("assets/primo_zold.png"),
 		font:                  LoadTTFAsset("assets/Roboto-Regular.ttf", 16, 72),
 	}
@@ -0,0 +1,181 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+
+	"primgo/primo"
+	"primgo/ui/dialog"
+)
+
+// romModel is a ROM version combined with the amount of RAM it was sold with.
+type romModel struct {
+	romType primo.ROMType
+	ramSize primo.RAMSize
+}
+
+func (r romModel) name() string {
+	return primo.ModelName(r.romType, r.ramSize)
+}
+
+// romModels lists every model of the PRIMO, the three ROM versions were sold with 16K, 32K or 48K
+// RAM.
+func romModels() []romModel {
+	var models []romModel
+	for _, romType := range []primo.ROMType{primo.ROMTypeA, primo.ROMTypeB, primo.ROMTypeC} {
+		for _, ramSize := range []primo.RAMSize{primo.RAMSize16K, primo.RAMSize32K, primo.RAMSize48K} {
+			models = append(models, romModel{romType: romType, ramSize: ramSize})
+		}
+	}
+	return models
+}
+
+func romItems() []ItemInfo {
+	var items []ItemInfo
+	for _, model := range romModels() {
+		items = append(items, ItemInfo{
+			Label: fmt.Sprintf("Reset to %s (%dK RAM)", model.name(), model.ramSize),
+			ID:    model.name(),
+		})
+	}
+	return append(items, ItemInfo{Label: "Open ROM image", ID: openROMItemID, Highlight: true})
+}
+
+func (s *UI) onROMListClicked(id string) {
+	if id == openROMItemID {
+		s.openedFileChan = dialog.BrowseFile()
+		return
+	}
+
+	for _, model := range romModels() {
+		if id == model.name() {
+			s.RAMSize = model.ramSize
+			s.userROM = false
+			s.unknownROM = nil
+			s.setROM(s.builtInROM(model.romType))
+		}
+	}
+}
+
+// setROM resets the machine with the given ROM and the selected RAM size.
+func (s *UI) setROM(rom *primo.ROM) {
+	s.ROM = rom
+	s.ROMType = rom.Type
+	if s.OnROMChange != nil {
+		s.OnROMChange(s.ROM, s.RAMSize)
+	}
+	s.updateROMIcon()
+	s.saveSettings()
+}
+
+// builtInROM returns the ROM shipped with the emulator, with the labels overridden if there is an
+// override file for it.
+func (s *UI) builtInROM(romType primo.ROMType) *primo.ROM {
+	rom := primo.BuiltInROM(romType)
+	s.applyROMLabels(rom)
+	return rom
+}
+
+// savedROM returns the last opened ROM image if it's still in use, or the built-in ROM otherwise.
+func (s *UI) savedROM(romType primo.ROMType) *primo.ROM {
+	if !s.userROM {
+		return s.builtInROM(romType)
+	}
+
+	data, err := s.settings.LoadFile(userROMFileName)
+	if err == nil {
+		var rom *primo.ROM
+		rom, err = primo.NewROM(data)
+		if err == nil {
+			s.applyROMLabels(rom)
+			err = rom.Validate()
+		}
+		if err == nil {
+			return rom
+		}
+	}
+
+	log.Printf("Error loading ROM image: %s\n", err.Error())
+	s.userROM = false
+	return s.builtInROM(romType)
+}
+
+// applyROMLabels overrides the labels of the ROM with its override file, if there is one.
+func (s *UI) applyROMLabels(rom *primo.ROM) {
+	data, err := s.settings.LoadFile(rom.LabelsFileName())
+	if err != nil {
+		log.Printf("Error reading ROM labels: %s\n", err.Error())
+		return
+	}
+	if data == nil {
+		return
+	}
+
+	err = rom.OverrideLabels(data)
+	if err != nil {
+		log.Printf("Error loading ROM labels: %s\n", err.Error())
+	}
+}
+
+// loadROM replaces the ROM with an image opened by the user, keeping the selected RAM size. The
+// image is stored next to the settings, so it stays in use after a restart. Images that can't be
+// used as they are wait for a label override file to be opened.
+func (s *UI) loadROM(data []byte) {
+	rom, err := primo.NewROM(data)
+	if err == nil {
+		s.applyROMLabels(rom)
+		err = rom.Validate()
+	}
+	if err != nil {
+		log.Printf("Error loading ROM image: %s\n", err.Error())
+		s.unknownROM = data
+		return
+	}
+
+	s.useROMImage(rom, data)
+}
+
+func (s *UI) useROMImage(rom *primo.ROM, data []byte) {
+	err := s.settings.SaveFile(userROMFileName, data)
+	if err != nil {
+		log.Printf("Error saving ROM image: %s\n", err.Error())
+	}
+
+	s.unknownROM = nil
+	s.userROM = true
+	s.setROM(rom)
+}
+
+// loadROMLabels applies a label override file to the last opened ROM image if it couldn't be used,
+// or to the current ROM otherwise. The file is stored for the next time the same ROM is used.
+func (s *UI) loadROMLabels(data []byte) {
+	rom := *s.ROM
+	if s.unknownROM != nil {
+		unknown, err := primo.NewROM(s.unknownROM)
+		if err != nil {
+			log.Printf("Error loading ROM image: %s\n", err.Error())
+			return
+		}
+		rom = *unknown
+	}
+
+	err := rom.OverrideLabels(data)
+	if err == nil {
+		err = rom.Validate()
+	}
+	if err != nil {
+		log.Printf("Error loading ROM labels: %s\n", err.Error())
+		return
+	}
+
+	err = s.settings.SaveFile(rom.LabelsFileName(), data)
+	if err != nil {
+		log.Printf("Error saving ROM labels: %s\n", err.Error())
+	}
+
+	if s.unknownROM != nil {
+		s.useROMImage(&rom, s.unknownROM)
+		return
+	}
+	s.setROM(&rom)
+}
@@ -0,0 +1,130 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+
+	"golang.org/x/exp/slices"
+)
+
+const (
+	pauseItemID = "{pause}"
+	stepItemID  = "{step}"
+	warpItemID  = "{warp}"
+	normalSpeed = 100
+)
+
+// speedLevels lists the selectable emulation speeds in percent of the real time, independently
+// from the emulated CPU frequency.
+func speedLevels() []int {
+	return []int{10, 25, 50, 100, 200, 400}
+}
+
+func speedItems() []ItemInfo {
+	items := make([]ItemInfo, 0, len(speedLevels())+6)
+	for _, speed := range speedLevels() {
+		items = append(items, ItemInfo{Label: speedItemID(speed), ID: speedItemID(speed)})
+	}
+	return append(items,
+		ItemInfo{Label: "Pause (F6)", ID: pauseItemID, Highlight: true},
+		ItemInfo{Label: "Next frame (F7)", ID: stepItemID},
+		ItemInfo{Label: "Warp (F8)", ID: warpItemID},
+		ItemInfo{Label: "Debugger", ID: debuggerItemID},
+		ItemInfo{Label: "Memory viewer", ID: memoryItemID},
+		ItemInfo{Label: "Start profiling", ID: profileItemID},
+	)
+}
+
+func speedItemID(speed int) string {
+	return fmt.Sprintf("Speed %d%%", speed)
+}
+
+func (s *UI) onSpeedClicked() {
+	if !s.speedList.IsOpen {
+		s.speedList.Open()
+	}
+}
+
+func (s *UI) onSpeedListClicked(id string) {
+	switch id {
+	case pauseItemID:
+		s.TogglePause()
+	case stepItemID:
+		s.StepFrame()
+	case warpItemID:
+		s.ToggleWarp()
+	case debuggerItemID:
+		s.ToggleDebugger()
+	case memoryItemID:
+		s.ToggleMemoryViewer()
+	case profileItemID:
+		s.ToggleProfiling()
+	default:
+		for _, speed := range speedLevels() {
+			if id == speedItemID(speed) {
+				s.Speed = speed
+			}
+		}
+		s.updateSpeed()
+	}
+}
+
+// TogglePause stops or resumes the emulation.
+func (s *UI) TogglePause() {
+	s.Paused = !s.Paused
+	s.updateSpeed()
+}
+
+// StepFrame pauses the emulation, and runs a single frame.
+func (s *UI) StepFrame() {
+	s.Paused = true
+	s.updateSpeed()
+	if s.OnFrameStep != nil {
+		s.OnFrameStep()
+	}
+}
+
+// ToggleWarp turns on or off running the emulation as fast as the host can.
+func (s *UI) ToggleWarp() {
+	s.Warp = !s.Warp
+	s.updateSpeed()
+}
+
+// ChangeSpeed selects the next faster or slower emulation speed, depending on the sign of the
+// direction.
+func (s *UI) ChangeSpeed(direction int) {
+	levels := speedLevels()
+	index := slices.Index(levels, s.Speed) + direction
+	s.Speed = levels[min(max(index, 0), len(levels)-1)]
+	s.updateSpeed()
+	log.Printf("Emulation speed: %d%%\n", s.Speed)
+}
+
+// RealTime reports whether the emulation runs at the same speed as the real machine, the audio can
+// only be played while it does.
+func (s *UI) RealTime() bool {
+	return !s.Paused && !s.Warp && s.Speed == normalSpeed
+}
+
+func (s *UI) updateSpeed() {
+	switch {
+	case s.Paused:
+		s.speedButton.Icon = s.res.pauseIconImage
+	case s.Warp:
+		s.speedButton.Icon = s.res.warpIconImage
+	default:
+		s.speedButton.Icon = s.res.runIconImage
+	}
+
+	if s.Paused {
+		s.speedList.SetItemLabel(pauseItemID, "Resume (F6)")
+	} else {
+		s.speedList.SetItemLabel(pauseItemID, "Pause (F6)")
+	}
+	if s.Warp {
+		s.speedList.SetItemLabel(warpItemID, "Stop warp (F8)")
+	} else {
+		s.speedList.SetItemLabel(warpItemID, "Warp (F8)")
+	}
+	s.speedList.Select(speedItemID(s.Speed))
+}
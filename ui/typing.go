@@ -0,0 +1,58 @@
+package ui
+
+import (
+	"primgo/ui/dialog"
+)
+
+const (
+	pasteItemID   = "{paste}"
+	typeLoadID    = "{type_load}"
+	typeRunID     = "{type_run}"
+	typeListingID = "{type_listing}"
+)
+
+func pasteItems() []ItemInfo {
+	return []ItemInfo{
+		{Label: "Paste text (F12)", ID: pasteItemID, Highlight: true},
+		{Label: "Open text file", ID: typeListingID},
+		{Label: "Type LOAD", ID: typeLoadID},
+		{Label: "Type RUN", ID: typeRunID},
+		{Label: "List BASIC program", ID: listProgramItemID},
+		{Label: "List BASIC on tape", ID: listTapeItemID},
+	}
+}
+
+func (s *UI) onPasteClicked() {
+	if !s.pasteList.IsOpen {
+		s.pasteList.Open()
+	}
+}
+
+func (s *UI) onPasteListClicked(id string) {
+	switch id {
+	case pasteItemID:
+		s.PasteText()
+	case typeListingID:
+		s.openedFileChan = dialog.BrowseFile()
+	case typeLoadID:
+		s.TypeText("LOAD\n")
+	case typeRunID:
+		s.TypeText("RUN\n")
+	case listProgramItemID:
+		s.ShowProgramListing()
+	case listTapeItemID:
+		s.ShowTapeListing()
+	}
+}
+
+// PasteText types in the text on the clipboard.
+func (s *UI) PasteText() {
+	s.clipboardChan = dialog.ReadClipboard()
+}
+
+// TypeText types in the text on the emulated keyboard.
+func (s *UI) TypeText(text string) {
+	if s.OnTypeText != nil {
+		s.OnTypeText(text)
+	}
+}
@@ -2,37 +2,50 @@ package ui
 
 import (
 	"encoding/json"
+	"fmt"
 	"image"
 	"image/color"
+	"io/fs"
 	"log"
 	"math"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/text"
 	"github.com/hajimehoshi/ebiten/v2/vector"
+	"golang.org/x/exp/slices"
 	"golang.org/x/image/font"
 
 	"primgo/primo"
+	"primgo/primo/machine"
+	"primgo/primo/monitor"
 	"primgo/primo/tapes"
 	"primgo/settings"
 	"primgo/ui/dialog"
 )
 
-type ClockSpeed int
+type ClockSpeed = machine.ClockSpeed
 
 const (
-	ClockSpeedNormal   = 2500000
-	ClockSpeedSpectrum = 3500000
-	ClockSpeedTurbo    = 3750000
+	ClockSpeedNormal   = machine.ClockSpeedNormal
+	ClockSpeedSpectrum = machine.ClockSpeedSpectrum
+	ClockSpeedTurbo    = machine.ClockSpeedTurbo
 )
 
-func (c ClockSpeed) Validate() bool {
-	return map[ClockSpeed]bool{
-		ClockSpeedNormal:   true,
-		ClockSpeedSpectrum: true,
-		ClockSpeedTurbo:    true,
-	}[c]
+type TapeMode string
+
+const (
+	TapeModeFast   TapeMode = "fast"
+	TapeModeSignal TapeMode = "signal"
+)
+
+func (t TapeMode) Validate() bool {
+	return map[TapeMode]bool{
+		TapeModeFast:   true,
+		TapeModeSignal: true,
+	}[t]
 }
 
 const (
@@ -40,7 +53,19 @@ const (
 	statusBarHeight = 48
 	textMargin      = 14
 	animLength      = 200 * time.Millisecond
-	openPTPItemID   = "{ptp}"
+	openFileItemID  = "{file}"
+	saveTapeItemID  = "{save}"
+	tapeModeItemID  = "{mode}"
+	autoWarpItemID  = "{auto_warp}"
+	savedTapeName   = "recorded.ptp"
+	saveStateItemID = "{save_state}"
+	loadStateItemID = "{load_state}"
+	stateSlotCount  = 4
+	openROMItemID   = "{open_rom}"
+	muteItemID      = "{mute}"
+	recordItemID    = "{record}"
+	savedAudioName  = "recorded.wav"
+	userROMFileName = "rom.bin"
 )
 
 type Widget interface {
@@ -50,68 +75,151 @@ type Widget interface {
 }
 
 type primgoSettings struct {
-	Muted          bool          `json:"muted"`
-	WholeScaleOnly bool          `json:"whole_scale"`
-	ClockSpeed     ClockSpeed    `json:"clock_speed"`
-	ROMType        primo.ROMType `json:"rom_type"`
+	Muted          bool           `json:"muted"`
+	Volume         int            `json:"volume"`
+	WholeScaleOnly bool           `json:"whole_scale"`
+	ClockSpeed     ClockSpeed     `json:"clock_speed"`
+	ROMType        primo.ROMType  `json:"rom_type"`
+	RAMSize        primo.RAMSize  `json:"ram_size"`
+	UserROM        bool           `json:"user_rom"`
+	TapeMode       TapeMode       `json:"tape_mode"`
+	AutoWarp       bool           `json:"auto_warp"`
+	StateSlot      int            `json:"state_slot"`
+	JoystickKeys   []JoystickKeys `json:"joystick_keys"`
 }
 
 type UI struct {
-	Muted           bool
-	ClockSpeed      ClockSpeed
-	ROMType         primo.ROMType
-	LoadedTape      string
-	MesauredClock   string
-	OnTapeChange    func(data []byte)
-	OnROMTypeChange func(romType primo.ROMType)
-
-	res             Resources
-	wholeScaleOnly  bool
-	upscaledScreens map[int]*ebiten.Image
-	openedFileChan  chan *dialog.OpenedFile
+	Muted         bool
+	Volume        int
+	ClockSpeed    ClockSpeed
+	ROM           *primo.ROM
+	ROMType       primo.ROMType
+	RAMSize       primo.RAMSize
+	TapeMode      TapeMode
+	AutoWarp      bool
+	LoadedTape    string
+	MesauredClock string
+	OnTapeChange  func(data []byte)
+	OnTapeSignal  func(pulses []time.Duration)
+	OnROMChange   func(rom *primo.ROM, ramSize primo.RAMSize)
+	OnPRILoad     func(pri *primo.PRIFile)
+	OnTapeSave    func() []byte
+	OnTapeSaved   func()
+	OnStateSave   func() *primo.Snapshot
+	OnStateLoad   func(snapshot *primo.Snapshot) error
+	OnAudioStart  func()
+	OnAudioStop   func() []byte
+	OnFrameStep   func()
+	OnTypeText    func(text string)
+	OnMovieRecord func(fromPowerOn bool)
+	OnMovieStop   func() *primo.Movie
+	OnMoviePlay   func(movie *primo.Movie) error
+	// OnDebugCommand executes a debugger command typed into the debugger panel, and OnDebugView
+	// describes the machine for the panel.
+	OnDebugCommand func(command string) (string, error)
+	OnDebugView    func(codeLines int) monitor.View
+	// OnMemoryView returns the memory lines shown by the memory viewer, OnMemoryLocate reads an
+	// address typed into it, and OnMemoryFind searches the memory for the bytes typed into it. Its
+	// other commands are executed by OnDebugCommand.
+	OnMemoryView   func(address uint16, lines int) []monitor.MemoryLine
+	OnMemoryLocate func(target string) (uint16, error)
+	OnMemoryFind   func(pattern string, from uint16) (uint16, error)
+	// OnProfileStart starts profiling the CPU, and OnProfileStop stops it and returns the profile in
+	// the callgrind format.
+	OnProfileStart func()
+	OnProfileStop  func() []byte
+	// OnListProgram lists the BASIC program in the memory, and OnListTape the BASIC programs on the
+	// tape inserted.
+	OnListProgram func() (string, error)
+	OnListTape    func() (string, error)
+	Paused        bool
+	Warp          bool
+	Speed         int
+
+	res               Resources
+	settings          *settings.Store
+	options           Options
+	savedSettings     primgoSettings
+	wholeScaleOnly    bool
+	upscaledScreens   map[int]*ebiten.Image
+	openedFileChan    chan *dialog.OpenedFile
+	savedFileChan     chan bool
+	savedAudioChan    chan bool
+	savedMovieChan    chan bool
+	savedProfileChan  chan bool
+	savedListingChan  chan bool
+	copiedListingChan chan bool
+	clipboardChan     chan *string
+	recordingAudio    bool
+	recordingMovie    bool
+	profiling         bool
+	stateSlot         int
+	userROM           bool
+	unknownROM        []byte
+	joystickKeys      []JoystickKeys
 
 	volumeButton   *Button
 	tapeButton     *Button
 	keyboardButton *Button
 	freqButton     *Button
+	speedButton    *Button
 	romButton      *Button
 	displayButton  *Button
+	stateButton    *Button
+	pasteButton    *Button
 	keyboard       *Keyboard
+	debugPanel     *DebugPanel
+	memoryViewer   *MemoryViewer
+	listingPanel   *ListingPanel
 	tapeList       *PopupList
 	romList        *PopupList
+	stateList      *PopupList
+	volumeList     *PopupList
+	speedList      *PopupList
+	pasteList      *PopupList
 }
 
-func New(res Resources) *UI {
+func New(res Resources, options Options) *UI {
 	upscaledScreens := make(map[int]*ebiten.Image, maxWholeUpscale)
 
-	tapeButton := NewIconButton(res.tapeIconImage, ButtonAlignBottomRight, 2)
+	tapeButton := NewIconButton(res.tapeIconImage, ButtonAlignBottomRight, 4)
+	stateButton := NewIconButton(res.stateIconImage, ButtonAlignBottomRight, 3)
+	pasteButton := NewIconButton(res.pasteIconImage, ButtonAlignBottomRight, 2)
 	romButton := NewIconButton(res.rom1IconImage, ButtonAlignBottomLeft, 0)
+	volumeButton := NewIconButton(res.volumeIconImage, ButtonAlignBottomRight, 0)
+	speedButton := NewIconButton(res.runIconImage, ButtonAlignBottomLeft, 2)
 
 	ui := &UI{
-		volumeButton:   NewIconButton(res.volumeIconImage, ButtonAlignBottomRight, 0),
-		keyboardButton: NewIconButton(res.keyboardUpIconImage, ButtonAlignBottomRight, 1),
-		tapeButton:     tapeButton,
-		romButton:      romButton,
-		freqButton:     NewIconButton(res.cpu1IconImage, ButtonAlignBottomLeft, 1),
-		displayButton:  NewIconButton(res.scale2IconImage, ButtonAlignTopRight, 0),
-		keyboard:       NewKeyboard(res),
-		tapeList:       NewPopupList(tapeItems(), tapeButton, PopupAlignLeft, res),
-		romList: NewPopupList(
-			[]ItemInfo{
-				{Label: "Reset to A64", ID: string(primo.ROMTypeA)},
-				{Label: "Reset to B64", ID: string(primo.ROMTypeB)},
-				{Label: "Reset to C64", ID: string(primo.ROMTypeC)},
-			},
-			romButton,
-			PopupAlignRight,
-			res),
+		volumeButton:    volumeButton,
+		keyboardButton:  NewIconButton(res.keyboardUpIconImage, ButtonAlignBottomRight, 1),
+		tapeButton:      tapeButton,
+		stateButton:     stateButton,
+		pasteButton:     pasteButton,
+		romButton:       romButton,
+		freqButton:      NewIconButton(res.cpu1IconImage, ButtonAlignBottomLeft, 1),
+		speedButton:     speedButton,
+		displayButton:   NewIconButton(res.scale2IconImage, ButtonAlignTopRight, 0),
+		keyboard:        NewKeyboard(res),
+		debugPanel:      NewDebugPanel(res),
+		memoryViewer:    NewMemoryViewer(res),
+		listingPanel:    NewListingPanel(res),
+		tapeList:        NewPopupList(tapeItems(), tapeButton, PopupAlignLeft, res),
+		stateList:       NewPopupList(stateItems(), stateButton, PopupAlignLeft, res),
+		romList:         NewPopupList(romItems(), romButton, PopupAlignRight, res),
+		volumeList:      NewPopupList(volumeItems(), volumeButton, PopupAlignLeft, res),
+		speedList:       NewPopupList(speedItems(), speedButton, PopupAlignRight, res),
+		pasteList:       NewPopupList(pasteItems(), pasteButton, PopupAlignLeft, res),
+		Speed:           normalSpeed,
 		res:             res,
+		settings:        settings.NewStore(options.SettingsFile),
+		options:         options,
 		LoadedTape:      "[empty]",
 		upscaledScreens: upscaledScreens,
 	}
 
 	ui.registerCallbacks()
 	ui.loadSettings()
+	ui.updateSpeed()
 
 	return ui
 }
@@ -127,12 +235,83 @@ func tapeItems() []ItemInfo {
 		{Label: "hammm.ptp", ID: "hammm.ptp"},
 		{Label: "himnusz.ptp", ID: "himnusz.ptp"},
 		{Label: "foldrajz.ptp", ID: "foldrajz.ptp"},
-		{Label: "Open PTP file", ID: openPTPItemID, Highlight: true},
+		{Label: "Open file", ID: openFileItemID, Highlight: true},
+		{Label: "Save recorded PTP", ID: saveTapeItemID},
+		{Label: "Loading: fast", ID: tapeModeItemID},
+		{Label: "Auto warp: off", ID: autoWarpItemID},
+	}
+}
+
+func stateItems() []ItemInfo {
+	items := make([]ItemInfo, 0, stateSlotCount+2+len(movieItems()))
+	for slot := 1; slot <= stateSlotCount; slot++ {
+		items = append(items, ItemInfo{Label: stateSlotItemID(slot), ID: stateSlotItemID(slot)})
+	}
+	items = append(items,
+		ItemInfo{Label: "Save state (F2)", ID: saveStateItemID, Highlight: true},
+		ItemInfo{Label: "Load state (F3)", ID: loadStateItemID},
+	)
+	return append(items, movieItems()...)
+}
+
+func stateSlotItemID(slot int) string {
+	return fmt.Sprintf("Slot %d", slot)
+}
+
+// volumeLevels lists the selectable volumes in percent.
+func volumeLevels() []int {
+	return []int{100, 75, 50, 25}
+}
+
+func volumeItems() []ItemInfo {
+	items := make([]ItemInfo, 0, len(volumeLevels())+1)
+	for _, volume := range volumeLevels() {
+		items = append(items, ItemInfo{Label: volumeItemID(volume), ID: volumeItemID(volume)})
+	}
+	return append(items,
+		ItemInfo{Label: "Mute", ID: muteItemID, Highlight: true},
+		ItemInfo{Label: "Record audio (F5)", ID: recordItemID},
+	)
+}
+
+func volumeItemID(volume int) string {
+	return fmt.Sprintf("Volume %d%%", volume)
+}
+
+// setDefaults replaces the missing or invalid values with the default ones.
+func (ps *primgoSettings) setDefaults() {
+	if !ps.ClockSpeed.Validate() {
+		ps.ClockSpeed = ClockSpeedNormal
+	}
+
+	if !ps.ROMType.Validate() {
+		ps.ROMType = primo.ROMTypeA
+	}
+
+	// settings saved before the RAM size could be chosen were used with 48K RAM
+	if !ps.RAMSize.Validate() {
+		ps.RAMSize = primo.RAMSize48K
+	}
+
+	if !ps.TapeMode.Validate() {
+		ps.TapeMode = TapeModeFast
+	}
+
+	if !slices.Contains(volumeLevels(), ps.Volume) {
+		ps.Volume = 100
+	}
+
+	if ps.StateSlot < 1 || ps.StateSlot > stateSlotCount {
+		ps.StateSlot = 1
+	}
+
+	if ps.JoystickKeys == nil {
+		ps.JoystickKeys = defaultJoystickKeys()
 	}
 }
 
 func (s *UI) loadSettings() {
-	data, err := settings.Load()
+	data, err := s.settings.Load()
 	if err != nil {
 		log.Printf("Error loading settings: %s\n", err.Error())
 	}
@@ -146,37 +325,54 @@ func (s *UI) loadSettings() {
 		}
 	}
 
-	if !ps.ClockSpeed.Validate() {
-		ps.ClockSpeed = ClockSpeedNormal
-	}
-
-	if !ps.ROMType.Validate() {
-		ps.ROMType = primo.ROMTypeA
-	}
+	ps.setDefaults()
+	s.savedSettings = ps
+	s.options.apply(&ps)
 
 	s.Muted = ps.Muted
+	s.Volume = ps.Volume
 	s.wholeScaleOnly = ps.WholeScaleOnly
 	s.ClockSpeed = ps.ClockSpeed
-	s.ROMType = ps.ROMType
-
-	s.updateVolumeIcon()
+	s.RAMSize = ps.RAMSize
+	s.userROM = ps.UserROM
+	s.ROM = s.savedROM(ps.ROMType)
+	s.ROMType = s.ROM.Type
+	s.TapeMode = ps.TapeMode
+	s.AutoWarp = ps.AutoWarp
+	s.stateSlot = ps.StateSlot
+	s.joystickKeys = ps.JoystickKeys
+
+	s.updateVolume()
 	s.updateDisplayIcon()
 	s.updateFreqIcon()
 	s.updateROMIcon()
+	s.updateTapeModeLabel()
+	s.stateList.Select(stateSlotItemID(s.stateSlot))
 }
 
 func (s *UI) saveSettings() {
-	data, err := json.Marshal(primgoSettings{
+	ps := primgoSettings{
 		Muted:          s.Muted,
+		Volume:         s.Volume,
 		WholeScaleOnly: s.wholeScaleOnly,
 		ClockSpeed:     s.ClockSpeed,
 		ROMType:        s.ROMType,
-	})
+		RAMSize:        s.RAMSize,
+		UserROM:        s.userROM,
+		TapeMode:       s.TapeMode,
+		AutoWarp:       s.AutoWarp,
+		StateSlot:      s.stateSlot,
+		JoystickKeys:   s.joystickKeys,
+	}
+	s.options.restore(&ps, s.savedSettings)
+	s.savedSettings = ps
+
+	data, err := json.Marshal(ps)
 	if err != nil {
 		log.Printf("Error marshalling settings: %s\n", err.Error())
 		return
 	}
-	err = settings.Save(string(data))
+	err = s.settings.Save(string(data))
 	if err != nil {
 		log.Printf("Error saving settings: %s\n", err.Error())
 	}
@@ -186,11 +382,21 @@ func (s *UI) widgets() []Widget {
 	return []Widget{
 		s.tapeList,
 		s.romList,
+		s.stateList,
+		s.volumeList,
+		s.speedList,
+		s.pasteList,
+		s.debugPanel,
+		s.memoryViewer,
+		s.listingPanel,
 		s.volumeButton,
 		s.tapeButton,
+		s.stateButton,
+		s.pasteButton,
 		s.keyboardButton,
 		s.romButton,
 		s.freqButton,
+		s.speedButton,
 		s.displayButton,
 		s.keyboard,
 	}
@@ -202,9 +408,24 @@ func (s *UI) registerCallbacks() {
 	s.romButton.OnReleased = s.onROMClicked
 	s.keyboardButton.OnReleased = s.onKeyboardClicked
 	s.tapeButton.OnReleased = s.onTapeClicked
+	s.stateButton.OnReleased = s.onStateClicked
 	s.displayButton.OnReleased = s.onDisplayClicked
 	s.tapeList.OnClick = s.onTapeListClicked
 	s.romList.OnClick = s.onROMListClicked
+	s.stateList.OnClick = s.onStateListClicked
+	s.volumeList.OnClick = s.onVolumeListClicked
+	s.speedButton.OnReleased = s.onSpeedClicked
+	s.speedList.OnClick = s.onSpeedListClicked
+	s.pasteButton.OnReleased = s.onPasteClicked
+	s.pasteList.OnClick = s.onPasteListClicked
+	s.debugPanel.OnCommand = s.onDebugCommand
+	s.debugPanel.OnView = s.onDebugView
+	s.memoryViewer.OnView = s.onMemoryView
+	s.memoryViewer.OnCommand = s.onDebugCommand
+	s.memoryViewer.OnLocate = s.onMemoryLocate
+	s.memoryViewer.OnFind = s.onMemoryFind
+	s.listingPanel.OnCopy = s.onListingCopy
+	s.listingPanel.OnSave = s.onListingSave
 }
 
 func (s *UI) updateDisplayIcon() {
@@ -222,40 +443,221 @@ func (s *UI) onDisplayClicked() {
 }
 
 func (s *UI) onTapeListClicked(id string) {
-	if id != openPTPItemID {
+	switch id {
+	case openFileItemID:
+		s.openedFileChan = dialog.BrowseFile()
+	case saveTapeItemID:
+		s.saveRecordedTape()
+	case tapeModeItemID:
+		if s.TapeMode == TapeModeFast {
+			s.setTapeMode(TapeModeSignal)
+		} else {
+			s.setTapeMode(TapeModeFast)
+		}
+	case autoWarpItemID:
+		s.AutoWarp = !s.AutoWarp
+		s.updateTapeModeLabel()
+		s.saveSettings()
+	default:
 		if s.OnTapeChange != nil {
 			s.OnTapeChange(tapes.ByName(id))
 		}
 		s.LoadedTape = id
+	}
+}
+
+func (s *UI) updateTapeModeLabel() {
+	switch s.TapeMode {
+	case TapeModeFast:
+		s.tapeList.SetItemLabel(tapeModeItemID, "Loading: fast")
+	case TapeModeSignal:
+		s.tapeList.SetItemLabel(tapeModeItemID, "Loading: real signal")
+	}
+
+	if s.AutoWarp {
+		s.tapeList.SetItemLabel(autoWarpItemID, "Auto warp: on")
+	} else {
+		s.tapeList.SetItemLabel(autoWarpItemID, "Auto warp: off")
+	}
+}
+
+func (s *UI) setTapeMode(mode TapeMode) {
+	s.TapeMode = mode
+	s.updateTapeModeLabel()
+	s.saveSettings()
+}
+
+// saveRecordedTape writes everything saved by the emulated machine since the last save into a new
+// PTP file.
+func (s *UI) saveRecordedTape() {
+	if s.OnTapeSave == nil {
+		return
+	}
+
+	data := s.OnTapeSave()
+	if len(data) == 0 {
+		log.Println("Nothing has been saved to the tape yet")
+		return
+	}
+
+	s.savedFileChan = dialog.SaveFile(savedTapeName, data)
+}
+
+func (s *UI) onStateListClicked(id string) {
+	switch id {
+	case saveStateItemID:
+		s.SaveState()
+	case loadStateItemID:
+		s.LoadState()
+	case recordMovieItemID:
+		s.ToggleMovieRecording(true)
+	case recordMovieHereItemID:
+		s.ToggleMovieRecording(false)
+	case playMovieItemID:
+		s.openedFileChan = dialog.BrowseFile()
+	default:
+		for slot := 1; slot <= stateSlotCount; slot++ {
+			if id == stateSlotItemID(slot) {
+				s.selectStateSlot(slot)
+			}
+		}
+	}
+
+	// keep showing the selected slot, even after clicking one of the actions
+	s.stateList.Select(stateSlotItemID(s.stateSlot))
+}
+
+func (s *UI) selectStateSlot(slot int) {
+	s.stateSlot = slot
+	s.stateList.Select(stateSlotItemID(slot))
+	s.saveSettings()
+}
+
+// NextStateSlot selects the save state slot after the current one, wrapping around after the last.
+func (s *UI) NextStateSlot() {
+	s.selectStateSlot(s.stateSlot%stateSlotCount + 1)
+	log.Printf("Selected save state slot %d\n", s.stateSlot)
+}
+
+func stateFileName(slot int) string {
+	return fmt.Sprintf("state%d.sav", slot)
+}
+
+// SaveState stores the current state of the machine in the selected slot.
+func (s *UI) SaveState() {
+	if s.OnStateSave == nil {
 		return
 	}
 
-	s.openedFileChan = dialog.BrowseFile()
+	err := s.settings.SaveFile(stateFileName(s.stateSlot), s.OnStateSave().Encode())
+	if err != nil {
+		log.Printf("Error saving state: %s\n", err.Error())
+		return
+	}
+	log.Printf("State saved to slot %d\n", s.stateSlot)
 }
 
-func (s *UI) onROMListClicked(id string) {
-	s.ROMType = primo.ROMType(id)
-	if s.OnROMTypeChange != nil {
-		s.OnROMTypeChange(s.ROMType)
+// LoadState restores the machine from the selected slot, switching to the ROM type it was saved with.
+func (s *UI) LoadState() {
+	data, err := s.settings.LoadFile(stateFileName(s.stateSlot))
+	if err != nil {
+		log.Printf("Error reading state: %s\n", err.Error())
+		return
 	}
+	if len(data) == 0 {
+		log.Printf("Save state slot %d is empty\n", s.stateSlot)
+		return
+	}
+
+	snapshot, err := primo.DecodeSnapshot(data)
+	if err != nil {
+		log.Printf("Error loading state: %s\n", err.Error())
+		return
+	}
+	if s.OnStateLoad != nil {
+		err = s.OnStateLoad(snapshot)
+		if err != nil {
+			log.Printf("Error loading state: %s\n", err.Error())
+			return
+		}
+	}
+	s.followMachineModel(snapshot.ROMType, snapshot.RAMSize, snapshot.MatchesROM(s.ROM))
+}
+
+// followMachineModel selects the model the machine was switched to by loading a state or a movie.
+// The machine switches back to the built-in ROM if they were saved with that.
+func (s *UI) followMachineModel(romType primo.ROMType, ramSize primo.RAMSize, matchesROM bool) {
+	if !matchesROM {
+		s.ROM = primo.BuiltInROM(romType)
+		s.userROM = false
+	}
+	s.ROMType = romType
+	s.RAMSize = ramSize
 	s.updateROMIcon()
 	s.saveSettings()
 }
 
-func (s *UI) updateVolumeIcon() {
+func (s *UI) updateVolume() {
 	if s.Muted {
 		s.volumeButton.Icon = s.res.muteIconImage
+		s.volumeList.SetItemLabel(muteItemID, "Unmute")
 	} else {
 		s.volumeButton.Icon = s.res.volumeIconImage
+		s.volumeList.SetItemLabel(muteItemID, "Mute")
 	}
+	s.volumeList.Select(volumeItemID(s.Volume))
 }
 
 func (s *UI) onVolumeClicked() {
-	s.Muted = !s.Muted
-	s.updateVolumeIcon()
+	if !s.volumeList.IsOpen {
+		s.volumeList.Open()
+	}
+}
+
+func (s *UI) onVolumeListClicked(id string) {
+	switch id {
+	case muteItemID:
+		s.Muted = !s.Muted
+	case recordItemID:
+		s.ToggleAudioRecording()
+	}
+	for _, volume := range volumeLevels() {
+		if id == volumeItemID(volume) {
+			s.Volume = volume
+			s.Muted = false
+		}
+	}
+	s.updateVolume()
 	s.saveSettings()
 }
 
+// ToggleAudioRecording starts recording the audio, or stops it and saves the recording to a WAV
+// file.
+func (s *UI) ToggleAudioRecording() {
+	if s.OnAudioStart == nil || s.OnAudioStop == nil {
+		return
+	}
+
+	s.recordingAudio = !s.recordingAudio
+	if s.recordingAudio {
+		s.OnAudioStart()
+		s.volumeList.SetItemLabel(recordItemID, "Stop recording (F5)")
+		log.Println("Audio recording started")
+		return
+	}
+
+	s.volumeList.SetItemLabel(recordItemID, "Record audio (F5)")
+	s.savedAudioChan = dialog.SaveFile(savedAudioName, s.OnAudioStop())
+}
+
+// OutputVolume returns the volume the audio should be played at, between 0 and 1.
+func (s *UI) OutputVolume() float64 {
+	if s.Muted {
+		return 0
+	}
+	return float64(s.Volume) / 100
+}
+
 func (s *UI) onKeyboardClicked() {
 	if s.keyboard.IsOpen {
 		s.keyboardButton.Icon = s.res.keyboardUpIconImage
@@ -272,6 +674,12 @@ func (s *UI) onTapeClicked() {
 	}
 }
 
+func (s *UI) onStateClicked() {
+	if !s.stateList.IsOpen {
+		s.stateList.Open()
+	}
+}
+
 func (s *UI) onROMClicked() {
 	if !s.romList.IsOpen {
 		s.romList.Open()
@@ -386,7 +794,7 @@ func (s *UI) drawStatusBar(screen *ebiten.Image) {
 		screen,
 		s.MesauredClock,
 		s.res.font,
-		s.freqButton.BoundingRectangle().Max.X+textMargin,
+		s.speedButton.BoundingRectangle().Max.X+textMargin,
 		screen.Bounds().Max.Y-statusBarHeight/2+fontHeight/2,
 		color.RGBA{0x97, 0x97, 0x97, 0xff})
 
@@ -404,19 +812,29 @@ func (s *UI) drawStatusBar(screen *ebiten.Image) {
 func (s *UI) Draw(screen, primoScreen *ebiten.Image) {
 	s.drawEmulatorScreen(screen, primoScreen)
 
+	s.debugPanel.Draw(screen)
+	s.memoryViewer.Draw(screen)
+	s.listingPanel.Draw(screen)
 	s.keyboard.Draw(screen)
 
 	s.drawStatusBar(screen)
 
 	s.volumeButton.Draw(screen)
 	s.tapeButton.Draw(screen)
+	s.stateButton.Draw(screen)
+	s.pasteButton.Draw(screen)
 	s.keyboardButton.Draw(screen)
 	s.freqButton.Draw(screen)
+	s.speedButton.Draw(screen)
 	s.romButton.Draw(screen)
 	s.displayButton.Draw(screen)
 
 	s.tapeList.Draw(screen)
 	s.romList.Draw(screen)
+	s.stateList.Draw(screen)
+	s.volumeList.Draw(screen)
+	s.speedList.Draw(screen)
+	s.pasteList.Draw(screen)
 }
 
 func (s *UI) Update() {
@@ -425,16 +843,133 @@ func (s *UI) Update() {
 		widget.Update(&ignoreInput)
 	}
 
+	s.receiveDialogResults()
+	s.loadDroppedFiles()
+}
+
+// receiveDialogResults handles the results of the file dialogs and the clipboard, which arrive
+// asynchronously.
+func (s *UI) receiveDialogResults() {
 	select {
 	case openedFile := <-s.openedFileChan:
 		if openedFile != nil {
-			if s.OnTapeChange != nil {
-				s.OnTapeChange(openedFile.Data)
-			}
-			s.LoadedTape = openedFile.Name
+			s.LoadFile(openedFile.Name, openedFile.Data)
 		}
 	default:
 	}
+
+	select {
+	case saved := <-s.savedFileChan:
+		if saved && s.OnTapeSaved != nil {
+			s.OnTapeSaved()
+		}
+	default:
+	}
+
+	receiveUnsaved(s.savedAudioChan, "Audio recording was not saved")
+	receiveUnsaved(s.savedMovieChan, "Movie was not saved")
+	receiveUnsaved(s.savedProfileChan, "Profile was not saved")
+	receiveUnsaved(s.savedListingChan, "Listing was not saved")
+	receiveUnsaved(s.copiedListingChan, "Listing was not copied to the clipboard")
+
+	select {
+	case text := <-s.clipboardChan:
+		if text == nil {
+			log.Println("Error reading the clipboard")
+		} else {
+			s.TypeText(*text)
+		}
+	default:
+	}
+}
+
+// receiveUnsaved logs the message if the recording saved by a dialog was not saved.
+func receiveUnsaved(savedChan chan bool, message string) {
+	select {
+	case saved := <-savedChan:
+		if !saved {
+			log.Println(message)
+		}
+	default:
+	}
+}
+
+// LoadFile inserts PTP and WAV files as tapes, loads PRI files directly into the memory, replaces
+// the ROM with ROM images, types in text files, and plays movies.
+func (s *UI) LoadFile(name string, data []byte) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".pri":
+		s.loadPRI(data)
+	case ".wav":
+		s.loadWAV(name, data)
+	case ".rom", ".bin":
+		s.loadROM(data)
+	case ".json":
+		s.loadROMLabels(data)
+	case ".txt", ".bas":
+		s.TypeText(string(data))
+	case ".pmv":
+		s.PlayMovie(data)
+	default:
+		if s.OnTapeChange != nil {
+			s.OnTapeChange(data)
+		}
+		s.LoadedTape = name
+	}
+}
+
+// loadWAV inserts a tape recording, which can only be loaded by following the signal.
+func (s *UI) loadWAV(name string, data []byte) {
+	pulses, err := primo.DecodeWAV(data)
+	if err != nil {
+		log.Printf("Error loading WAV file: %s\n", err.Error())
+		return
+	}
+	if s.OnTapeSignal != nil {
+		s.OnTapeSignal(pulses)
+	}
+	s.LoadedTape = name
+	s.setTapeMode(TapeModeSignal)
+}
+
+func (s *UI) loadPRI(data []byte) {
+	pri, err := primo.ParsePRI(data)
+	if err != nil {
+		log.Printf("Error loading PRI file: %s\n", err.Error())
+		return
+	}
+	if s.OnPRILoad != nil {
+		s.OnPRILoad(pri)
+	}
+}
+
+func (s *UI) loadDroppedFiles() {
+	dropped := ebiten.DroppedFiles()
+	if dropped == nil {
+		return
+	}
+
+	entries, err := fs.ReadDir(dropped, ".")
+	if err != nil {
+		log.Printf("Error reading dropped files: %s\n", err.Error())
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		s.loadDroppedFile(dropped, entry.Name())
+	}
+}
+
+func (s *UI) loadDroppedFile(dropped fs.FS, name string) {
+	data, err := fs.ReadFile(dropped, name)
+	if err != nil {
+		log.Printf("Error reading dropped file: %s\n", err.Error())
+		return
+	}
+	s.LoadFile(name, data)
 }
 
 func (s UI) Layout(w, h int) {